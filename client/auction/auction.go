@@ -0,0 +1,151 @@
+package auction
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"pbl/client/models"
+	"pbl/client/utils"
+	"pbl/shared"
+	"pbl/style"
+
+	"github.com/nats-io/nats.go"
+)
+
+func MenuAuction(nc *nats.Conn, server models.ServerInfo, clientID string, user *shared.User) {
+	for {
+		switch utils.ShowMenuLeiloes() {
+		case "1":
+			style.Clear()
+			listAuctions(nc, server, clientID, user)
+		case "2":
+			style.Clear()
+			createAuction(nc, server, clientID)
+		case "3":
+			return
+		default:
+			fmt.Println("Opção inválida.")
+		}
+	}
+}
+
+// lê um número inteiro positivo; 0 volta ao menu
+func readNumber(prompt string) (int, bool) {
+	for {
+		fmt.Print(prompt)
+		value, err := strconv.Atoi(utils.ReadLineSafe())
+		if err == nil && value == 0 {
+			return 0, false
+		}
+		if err == nil && value > 0 {
+			return value, true
+		}
+		style.PrintMag("Valor inválido, digite um número positivo (ou 0 para voltar)!\n")
+	}
+}
+
+func listAuctions(nc *nats.Conn, server models.ServerInfo, clientID string, user *shared.User) {
+	response, ok := utils.SendRequest(nc, server, clientID, "LIST_AUCTIONS", nil)
+	if !ok {
+		return
+	}
+	var house shared.AuctionHouse
+	if err := json.Unmarshal(response.Data, &house); err != nil {
+		log.Printf("Erro ao decodificar os leilões: %v", err)
+		return
+	}
+
+	fmt.Println("\n----------------------------------")
+	fmt.Println("         Casa de leilões          ")
+	fmt.Println("----------------------------------")
+	style.PrintAma(fmt.Sprintf("Suas moedas: %d\n\n", house.Coins))
+	if len(house.Auctions) == 0 {
+		fmt.Println("Nenhum leilão aberto.")
+		return
+	}
+	for i, a := range house.Auctions {
+		fmt.Printf("[%d] - ", i+1)
+		utils.PrintCartaCor(a.Card)
+		fmt.Printf(" | vendedor: %s | mínimo: %d", a.Seller, a.ReservePrice)
+		if a.HighestBidder != "" {
+			fmt.Printf(" | maior lance: %d (%s)", a.HighestBid, a.HighestBidder)
+		}
+		fmt.Printf(" | termina em %s\n", time.Until(a.EndsAt).Round(time.Second))
+	}
+
+	choice, ok := readNumber("\nDigite o número do leilão para dar um lance (0 para voltar): ")
+	if !ok {
+		return
+	}
+	if choice > len(house.Auctions) {
+		style.PrintMag("Leilão inválido.\n")
+		return
+	}
+	chosen := house.Auctions[choice-1]
+	if chosen.Seller == user.UserName {
+		style.PrintMag("Não é possível dar lance no próprio leilão.\n")
+		return
+	}
+
+	amount, ok := readNumber("Valor do lance: ")
+	if !ok {
+		return
+	}
+	bid := shared.BidRequest{AuctionID: chosen.ID, Amount: amount}
+	if _, ok := utils.SendRequest(nc, server, clientID, "BID", bid); ok {
+		style.PrintVerd(fmt.Sprintf("\nLance de %d moedas registrado! As moedas ficam retidas até o fim do leilão.\n", amount))
+	}
+}
+
+func createAuction(nc *nats.Conn, server models.ServerInfo, clientID string) {
+	cards, ok := utils.FetchCards(nc, server, clientID, "SEE_CARDS", nil)
+	if !ok || len(cards) == 0 {
+		return
+	}
+	utils.MostrarInventario(cards)
+
+	index, ok := utils.ChooseIndex("Digite o número da carta a leiloar (-1 para voltar): ", len(cards))
+	if !ok {
+		return
+	}
+	price, ok := readNumber("Lance mínimo (moedas): ")
+	if !ok {
+		return
+	}
+	minutes, ok := readNumber("Duração em minutos: ")
+	if !ok {
+		return
+	}
+
+	req := shared.CreateAuctionRequest{
+		CardID:          cards[index].Id,
+		ReservePrice:    price,
+		DurationSeconds: minutes * 60,
+	}
+	if _, ok := utils.SendRequest(nc, server, clientID, "CREATE_AUCTION", req); ok {
+		style.PrintVerd("\nCarta colocada em leilão!\n")
+	}
+}
+
+// mostra as notificações de leilão que chegam na inbox do cliente
+func PrintNotification(resp shared.Response) {
+	var a shared.Auction
+	if err := json.Unmarshal(resp.Data, &a); err != nil {
+		return
+	}
+
+	cardString := fmt.Sprintf("%s %s", a.Card.Element, a.Card.Type)
+	switch resp.Action {
+	case "AUCTION_OUTBID":
+		style.PrintMag(fmt.Sprintf("\n[LEILÃO] Seu lance em %s foi coberto por %s (%d moedas). Suas moedas foram devolvidas.\n", cardString, a.HighestBidder, a.HighestBid))
+	case "AUCTION_SOLD":
+		style.PrintVerd(fmt.Sprintf("\n[LEILÃO] Sua carta %s foi vendida para %s por %d moedas!\n", cardString, a.HighestBidder, a.HighestBid))
+	case "AUCTION_UNSOLD":
+		style.PrintAma(fmt.Sprintf("\n[LEILÃO] Sua carta %s não recebeu lances e voltou para o inventário.\n", cardString))
+	case "AUCTION_WON":
+		style.PrintVerd(fmt.Sprintf("\n[LEILÃO] Você arrematou %s por %d moedas!\n", cardString, a.HighestBid))
+	}
+}
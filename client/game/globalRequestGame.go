@@ -4,8 +4,11 @@ import (
 	"log"
 	"fmt"
 	"time"
+	"encoding/hex"
+	"crypto/rand"
 	"encoding/json"
 
+	"pbl/client/utils"
 	"pbl/shared"
 	"pbl/style"
 
@@ -77,7 +80,10 @@ func PlayGlobalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.Use
 	}
 
 	gameOver := false
+	var reconnectBy time.Time // prazo do adversário que caiu, se houver
 	alreadyPlayed := false
+	var play *globalPlay // jogada da rodada atual, revelada quando os dois tiverem jogado
+	opponentPlayed := false
 	gameMsgChan := make(chan shared.GameMessage, 10)
 
 	clientTopic := fmt.Sprintf("server.%d.client.%s", currentUser.ServerID, currentUser.UserId)
@@ -102,11 +108,12 @@ func PlayGlobalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.Use
 	if isMyTurn {
 		card, ok := ChooseCard(currentUser)
 		if !ok {
+			SendSurrenderGlobal(nc, room, currentUser)
 			fmt.Println("Você desistiu da partida.")
 			return
 		}
 
-		SendCardPlayGlobal(nc, room, currentUser, card)
+		play = SendCardPlayGlobal(nc, room, currentUser, card)
 		fmt.Printf("\nVocê jogou: %s (%s)\n", card.Element, card.Type)
 		fmt.Println("Aguardando adversário...")
 		alreadyPlayed = true
@@ -118,25 +125,20 @@ func PlayGlobalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.Use
 			switch gameMsg.Type {
 			case "PLAY_CARD":
 				if gameMsg.From == opponent.UserId {
-					var card shared.Card
-					if len(gameMsg.Data) > 0 {
-						if err := json.Unmarshal(gameMsg.Data, &card); err != nil {
-							log.Println("Erro ao decodificar carta:", err)
-							continue
-						}
-					}
-
-					//fmt.Printf("\n%s jogou: %s (%s)\n", opponent.UserName, card.Element, card.Type)
+					// só o aviso de que o adversário jogou; a carta vem no resultado
+					opponentPlayed = true
+					fmt.Printf("\n%s já jogou.\n", opponent.UserName)
 
 					if gameMsg.Turn == currentUser.UserId && !alreadyPlayed {
 						fmt.Println("\n✓ Sua vez de jogar!")
 						chosenCard, ok := ChooseCard(currentUser)
 						if ok {
-							SendCardPlayGlobal(nc, room, currentUser, chosenCard)
+							play = SendCardPlayGlobal(nc, room, currentUser, chosenCard)
 							fmt.Printf("Você jogou: %s (%s)\n", chosenCard.Element, chosenCard.Type)
 							fmt.Println("Aguardando resultado...")
 							alreadyPlayed = true
 						} else {
+							SendSurrenderGlobal(nc, room, currentUser)
 							fmt.Println("Você desistiu da partida.")
 							return
 						}
@@ -146,22 +148,111 @@ func PlayGlobalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.Use
 				}
 
 			case "ROUND_RESULT":
-				fmt.Println("\n--------------------------------")
-				fmt.Println("            Resultado           ")
-				fmt.Println("--------------------------------")
-
-				if gameMsg.Winner == nil {
-					fmt.Println("Empate dos jogadores!")
-				} else {
-					fmt.Println("Vencedor: ", gameMsg.Winner.UserName)
+				printRoundResult(gameMsg, currentUser, opponent)
+				alreadyPlayed = false
+				play = nil
+				opponentPlayed = false
+
+				// Turn vazio: a partida acabou e o MATCH_RESULT vem em seguida
+				if gameMsg.Turn == currentUser.UserId {
+					fmt.Println("\n✓ Você começa a próxima rodada!")
+					chosenCard, ok := ChooseCard(currentUser)
+					if !ok {
+						SendSurrenderGlobal(nc, room, currentUser)
+						fmt.Println("Você desistiu da partida.")
+						return
+					}
+					play = SendCardPlayGlobal(nc, room, currentUser, chosenCard)
+					fmt.Printf("Você jogou: %s (%s)\n", chosenCard.Element, chosenCard.Type)
+					fmt.Println("Aguardando adversário...")
+					alreadyPlayed = true
+				} else if gameMsg.Turn != "" {
+					fmt.Printf("\n%s começa a próxima rodada. Aguarde...\n", opponent.UserName)
 				}
 
-				alreadyPlayed = false
+			case "PLAY_REJECTED":
+				retry, endMatch := printPlayRejected(gameMsg)
+				if endMatch {
+					gameOver = true
+				}
+				if !retry {
+					continue
+				}
+				if play != nil && play.revealed {
+					// o hash já foi aceito: só a revelação precisa ser reenviada
+					play.revealed = false
+					RevealCardGlobal(nc, room, currentUser, play)
+					continue
+				}
+				chosenCard, ok := ChooseCard(currentUser)
+				if !ok {
+					SendSurrenderGlobal(nc, room, currentUser)
+					fmt.Println("Você desistiu da partida.")
+					return
+				}
+				play = SendCardPlayGlobal(nc, room, currentUser, chosenCard)
+				fmt.Printf("Você jogou: %s (%s)\n", chosenCard.Element, chosenCard.Type)
+				alreadyPlayed = true
+
+			case "PLAY_COMMITTED":
+				if play != nil {
+					play.committed = true
+				}
+
+			case shared.EndTurnTimeout:
+				printTurnTimeout(gameMsg, currentUser, opponent)
+
+			case shared.EndSurrender:
+				printSurrender(opponent)
+
+			case shared.EndDisconnect:
+				printDisconnectLoss(gameMsg, currentUser, opponent)
+
+			case "MATCH_RESUMED":
+				// mensagens podem ter se perdido durante a queda: vale o estado do servidor
+				resumed := printMatchResumed(gameMsg, currentUser, opponent)
+				_, alreadyPlayed = resumed.Commitments[currentUser.UserId]
+				_, opponentPlayed = resumed.Commitments[opponent.UserId]
+				if !alreadyPlayed {
+					play = nil
+				} else if play != nil {
+					_, revealed := resumed.PlayersCards[currentUser.UserId]
+					play.committed = true
+					play.revealed = revealed
+				}
+				if resumed.Turn == currentUser.UserId && !alreadyPlayed {
+					fmt.Println("\n✓ Sua vez de jogar!")
+					chosenCard, ok := ChooseCard(currentUser)
+					if !ok {
+						SendSurrenderGlobal(nc, room, currentUser)
+						fmt.Println("Você desistiu da partida.")
+						return
+					}
+					play = SendCardPlayGlobal(nc, room, currentUser, chosenCard)
+					fmt.Printf("Você jogou: %s (%s)\n", chosenCard.Element, chosenCard.Type)
+					alreadyPlayed = true
+				}
+
+			case "OPPONENT_RECONNECTING":
+				reconnectBy = printOpponentReconnecting(gameMsg, opponent)
+
+			case "OPPONENT_RECONNECTED":
+				reconnectBy = time.Time{}
+				printOpponentReconnected(opponent)
+
+			case "MATCH_RESULT":
+				printMatchResult(gameMsg, currentUser, opponent)
 				gameOver = true
 
 			}	
 
-		case <-time.After(30 * time.Second):
+			// os dois jogaram: agora a carta pode ser revelada
+			if play != nil && play.committed && !play.revealed && opponentPlayed {
+				RevealCardGlobal(nc, room, currentUser, play)
+			}
+
+		// o servidor encerra a partida quando a vez expira; aqui só se ele não responder
+		case <-time.After(matchWait(reconnectBy)):
 			fmt.Println("\nTimeout: servidor não respondeu.")
 			fmt.Println("A partida foi cancelada.")
 			gameOver = true
@@ -174,8 +265,21 @@ func PlayGlobalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.Use
 	style.Clear()
 }
 
-func SendCardPlayGlobal(nc *nats.Conn, room *shared.GameRoom, client shared.User, card shared.Card) {
-	dataBytes, _ := json.Marshal(card)
+// jogada global em andamento: a carta e o nonce ficam só no cliente até a revelação
+type globalPlay struct {
+	card      shared.Card
+	nonce     string
+	committed bool
+	revealed  bool
+}
+
+// envia só o hash da carta; o servidor e o adversário não ficam sabendo qual foi
+func SendCardPlayGlobal(nc *nats.Conn, room *shared.GameRoom, client shared.User, card shared.Card) *globalPlay {
+	nonceBytes := make([]byte, 16)
+	rand.Read(nonceBytes)
+	play := &globalPlay{card: card, nonce: hex.EncodeToString(nonceBytes)}
+
+	dataBytes, _ := json.Marshal(shared.PlayCommit{Commitment: shared.CommitCard(card.Id, play.nonce)})
 
 	gameMsg := shared.GameMessage{
 		Type:   "PLAY_CARD_GLOBAL",
@@ -190,6 +294,7 @@ func SendCardPlayGlobal(nc *nats.Conn, room *shared.GameRoom, client shared.User
 		ClientID: client.UserId,
 		Action:   "GAME_MESSAGE_GLOBAL",
 		Payload:  payload,
+		Token:    utils.SessionToken(),
 	}
 
 	reqBytes, _ := json.Marshal(req)
@@ -198,4 +303,53 @@ func SendCardPlayGlobal(nc *nats.Conn, room *shared.GameRoom, client shared.User
 	//log.Printf("[DEBUG] Enviando jogada para o servidor %d (sala %s): %+v\n", client.ServerID, room.ID, card)
 
 	nc.Publish(topic, reqBytes)
+	return play
+}
+
+// avisa o servidor que o jogador desistiu; o adversário fica com a vitória
+func SendSurrenderGlobal(nc *nats.Conn, room *shared.GameRoom, client shared.User) {
+	gameMsg := shared.GameMessage{
+		Type:   shared.EndSurrender,
+		From:   client.UserId,
+		RoomID: room.ID,
+	}
+
+	payload, _ := json.Marshal(gameMsg)
+
+	req := shared.Request{
+		ClientID: client.UserId,
+		Action:   "GAME_MESSAGE_GLOBAL",
+		Payload:  payload,
+		Token:    utils.SessionToken(),
+	}
+
+	reqBytes, _ := json.Marshal(req)
+	nc.Publish(fmt.Sprintf("server.%d.requests", client.ServerID), reqBytes)
+}
+
+// revela carta e nonce para o servidor conferir com o hash enviado antes
+func RevealCardGlobal(nc *nats.Conn, room *shared.GameRoom, client shared.User, play *globalPlay) {
+	dataBytes, _ := json.Marshal(shared.PlayReveal{CardID: play.card.Id, Nonce: play.nonce})
+
+	gameMsg := shared.GameMessage{
+		Type:   "REVEAL_CARD",
+		From:   client.UserId,
+		RoomID: room.ID,
+		Data:   dataBytes,
+	}
+
+	payload, _ := json.Marshal(gameMsg)
+
+	req := shared.Request{
+		ClientID: client.UserId,
+		Action:   "GAME_MESSAGE_GLOBAL",
+		Payload:  payload,
+		Token:    utils.SessionToken(),
+	}
+
+	reqBytes, _ := json.Marshal(req)
+	topic := fmt.Sprintf("server.%d.requests", client.ServerID)
+
+	nc.Publish(topic, reqBytes)
+	play.revealed = true
 }
@@ -65,6 +65,7 @@ func SendCardPlayLocal(nc *nats.Conn, room *shared.GameRoom, fromUserID string,
 		ClientID: fromUserID,
 		Action:   "GAME_MESSAGE",
 		Payload:  payload,
+		Token:    utils.SessionToken(),
 	}
 
 	reqBytes, _ := json.Marshal(req)
@@ -75,6 +76,27 @@ func SendCardPlayLocal(nc *nats.Conn, room *shared.GameRoom, fromUserID string,
 	nc.Publish(topic, reqBytes)
 }
 
+// avisa o servidor que o jogador desistiu; o adversário fica com a vitória
+func SendSurrenderLocal(nc *nats.Conn, room *shared.GameRoom, fromUserID string) {
+	gameMsg := shared.GameMessage{
+		Type:   shared.EndSurrender,
+		From:   fromUserID,
+		RoomID: room.ID,
+	}
+
+	payload, _ := json.Marshal(gameMsg)
+
+	req := shared.Request{
+		ClientID: fromUserID,
+		Action:   "GAME_MESSAGE",
+		Payload:  payload,
+		Token:    utils.SessionToken(),
+	}
+
+	reqBytes, _ := json.Marshal(req)
+	nc.Publish(fmt.Sprintf("server.%d.requests", room.ServerID), reqBytes)
+}
+
 func StartGameListener(nc *nats.Conn, clientID string, matchChan chan<- MatchInfo, currentUser shared.User) *nats.Subscription {
 	clientTopic := fmt.Sprintf("client.%s.inbox", clientID)
 
@@ -138,6 +160,7 @@ func PlayLocalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.User
 	}
 
 	gameOver := false
+	var reconnectBy time.Time // prazo do adversário que caiu, se houver
 	alreadyPlayed := false // faz o controle das jogadas
 	gameMsgChan := make(chan shared.GameMessage, 10)
 
@@ -159,6 +182,7 @@ func PlayLocalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.User
 	if isMyTurn {
 		card, ok := ChooseCard(currentUser)
 		if !ok {
+			SendSurrenderLocal(nc, room, currentUser.UserId)
 			fmt.Println("Você desistiu da partida.")
 			return
 		}
@@ -175,15 +199,8 @@ func PlayLocalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.User
 			case "PLAY_CARD":
 				//Mensagem do adversário jogando
 				if gameMsg.From == opponent.UserId {
-					var card shared.Card
-					if len(gameMsg.Data) > 0 {
-						if err := json.Unmarshal(gameMsg.Data, &card); err != nil {
-							log.Println("Erro ao decodificar carta:", err)
-							continue
-						}
-					}
-
-					//fmt.Printf("\n%s jogou: %s (%s)\n", opponent.UserName, card.Element, card.Type)
+					// a carta do adversário só aparece no resultado da rodada
+					fmt.Printf("\n%s já jogou.\n", opponent.UserName)
 
 					if !alreadyPlayed {
 						room.Turn = currentUser.UserId
@@ -196,6 +213,7 @@ func PlayLocalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.User
 							fmt.Println("Aguardando resultado...")
 							alreadyPlayed = true //cliente jogou
 						} else {
+							SendSurrenderLocal(nc, room, currentUser.UserId)
 							fmt.Println("Você desistiu da partida.")
 							return
 						}
@@ -205,23 +223,86 @@ func PlayLocalGame(nc *nats.Conn, room *shared.GameRoom, currentUser shared.User
 				}
 
 			case "ROUND_RESULT":
-				fmt.Println("\n--------------------------------")
-				fmt.Println("            Resultado           ")
-				fmt.Println("--------------------------------")
-				
-				if gameMsg.Winner == nil {
-					fmt.Println("Empate dos jogadores!")
-				} else {
-					fmt.Println("Vencedor: ", gameMsg.Winner.UserName)
+				printRoundResult(gameMsg, currentUser, opponent)
+				alreadyPlayed = false
+
+				// Turn vazio: a partida acabou e o MATCH_RESULT vem em seguida
+				if gameMsg.Turn == currentUser.UserId {
+					fmt.Println("\nVocê começa a próxima rodada!")
+					chosenCard, ok := ChooseCard(currentUser)
+					if !ok {
+						SendSurrenderLocal(nc, room, currentUser.UserId)
+						fmt.Println("Você desistiu da partida.")
+						return
+					}
+					SendCardPlayLocal(nc, room, currentUser.UserId, chosenCard)
+					fmt.Printf("Você jogou: %s (%s)\n", chosenCard.Element, chosenCard.Type)
+					fmt.Println("Aguardando adversário...")
+					alreadyPlayed = true
+				} else if gameMsg.Turn != "" {
+					fmt.Printf("\n%s começa a próxima rodada. Aguarde...\n", opponent.UserName)
 				}
 
-				alreadyPlayed = false
+			case "PLAY_REJECTED":
+				retry, endMatch := printPlayRejected(gameMsg)
+				if endMatch {
+					gameOver = true
+				}
+				if !retry {
+					continue
+				}
+				chosenCard, ok := ChooseCard(currentUser)
+				if !ok {
+					SendSurrenderLocal(nc, room, currentUser.UserId)
+					fmt.Println("Você desistiu da partida.")
+					return
+				}
+				SendCardPlayLocal(nc, room, currentUser.UserId, chosenCard)
+				fmt.Printf("Você jogou: %s (%s)\n", chosenCard.Element, chosenCard.Type)
+				alreadyPlayed = true
+
+			case shared.EndTurnTimeout:
+				printTurnTimeout(gameMsg, currentUser, opponent)
+
+			case shared.EndSurrender:
+				printSurrender(opponent)
+
+			case shared.EndDisconnect:
+				printDisconnectLoss(gameMsg, currentUser, opponent)
+
+			case "MATCH_RESUMED":
+				// mensagens podem ter se perdido durante a queda: vale o estado do servidor
+				resumed := printMatchResumed(gameMsg, currentUser, opponent)
+				_, alreadyPlayed = resumed.PlayersCards[currentUser.UserId]
+				if resumed.Turn == currentUser.UserId && !alreadyPlayed {
+					fmt.Println("\nSua vez!")
+					chosenCard, ok := ChooseCard(currentUser)
+					if !ok {
+						SendSurrenderLocal(nc, room, currentUser.UserId)
+						fmt.Println("Você desistiu da partida.")
+						return
+					}
+					SendCardPlayLocal(nc, room, currentUser.UserId, chosenCard)
+					fmt.Printf("Você jogou: %s (%s)\n", chosenCard.Element, chosenCard.Type)
+					alreadyPlayed = true
+				}
+
+			case "OPPONENT_RECONNECTING":
+				reconnectBy = printOpponentReconnecting(gameMsg, opponent)
+
+			case "OPPONENT_RECONNECTED":
+				reconnectBy = time.Time{}
+				printOpponentReconnected(opponent)
+
+			case "MATCH_RESULT":
+				printMatchResult(gameMsg, currentUser, opponent)
 				gameOver = true
 
 			}
 
 	
-		case <-time.After(30 * time.Second):
+		// o servidor encerra a partida quando a vez expira; aqui só se ele não responder
+		case <-time.After(matchWait(reconnectBy)):
 			fmt.Println("\nTimeout: servidor não respondeu.")
 			gameOver = true
 		}
@@ -0,0 +1,144 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"pbl/shared"
+	"pbl/style"
+)
+
+// placar do jogador e do adversário a partir da sala enviada junto com o resultado
+func score(gameMsg shared.GameMessage, currentUser shared.User) (shared.GameRoom, int, int) {
+	var room shared.GameRoom
+	if err := json.Unmarshal(gameMsg.Data, &room); err != nil || room.Player1 == nil {
+		return room, 0, 0
+	}
+	if room.Player1.UserId == currentUser.UserId {
+		return room, room.Score1, room.Score2
+	}
+	return room, room.Score2, room.Score1
+}
+
+func printRoundResult(gameMsg shared.GameMessage, currentUser shared.User, opponent shared.User) {
+	room, mine, theirs := score(gameMsg, currentUser)
+
+	fmt.Println("\n--------------------------------")
+	if room.BestOf > 0 {
+		fmt.Printf("   Resultado da rodada %d de %d\n", room.Round, room.BestOf)
+	} else {
+		fmt.Println("            Resultado           ")
+	}
+	fmt.Println("--------------------------------")
+
+	// as cartas só são reveladas depois que os dois jogaram
+	if myCard, ok := room.LastRound[currentUser.UserId]; ok {
+		fmt.Printf("Você jogou: %s (%s)\n", myCard.Element, myCard.Type)
+	}
+	if theirCard, ok := room.LastRound[opponent.UserId]; ok {
+		fmt.Printf("%s jogou: %s (%s)\n", opponent.UserName, theirCard.Element, theirCard.Type)
+	}
+
+	switch {
+	case gameMsg.Winner == nil:
+		style.PrintAma("Empate na rodada!\n")
+	case gameMsg.Winner.UserId == currentUser.UserId:
+		style.PrintVerd("Você venceu a rodada!\n")
+	default:
+		style.PrintVerm(fmt.Sprintf("%s venceu a rodada.\n", gameMsg.Winner.UserName))
+	}
+	fmt.Printf("Placar: você %d x %d %s\n", mine, theirs, opponent.UserName)
+}
+
+func printMatchResult(gameMsg shared.GameMessage, currentUser shared.User, opponent shared.User) {
+	_, mine, theirs := score(gameMsg, currentUser)
+
+	fmt.Println("\n================================")
+	fmt.Println("        Fim da partida          ")
+	fmt.Println("================================")
+	switch {
+	case gameMsg.Winner == nil:
+		style.PrintAma("A partida terminou empatada!\n")
+	case gameMsg.Winner.UserId == currentUser.UserId:
+		style.PrintVerd("Você venceu a partida!\n")
+	default:
+		style.PrintVerm(fmt.Sprintf("%s venceu a partida.\n", gameMsg.Winner.UserName))
+	}
+	fmt.Printf("Placar final: você %d x %d %s\n", mine, theirs, opponent.UserName)
+}
+
+// a vez expirou e quem não jogou a tempo perdeu. O MATCH_RESULT vem em seguida
+func printTurnTimeout(gameMsg shared.GameMessage, currentUser shared.User, opponent shared.User) {
+	switch {
+	case gameMsg.Winner == nil:
+		style.PrintAma("\nO tempo acabou sem que nenhum dos dois jogasse.\n")
+	case gameMsg.Winner.UserId == currentUser.UserId:
+		style.PrintAma(fmt.Sprintf("\n%s não jogou a tempo e perdeu a partida.\n", opponent.UserName))
+	default:
+		style.PrintVerm("\nSeu tempo acabou e você perdeu a partida.\n")
+	}
+}
+
+// estado da sala reenviado pelo servidor depois que a sessão foi retomada
+func printMatchResumed(gameMsg shared.GameMessage, currentUser shared.User, opponent shared.User) shared.GameRoom {
+	room, mine, theirs := score(gameMsg, currentUser)
+	style.PrintVerd(fmt.Sprintf("\nConexão restabelecida. Rodada %d, placar: você %d x %d %s\n", room.Round+1, mine, theirs, opponent.UserName))
+	return room
+}
+
+// quanto o cliente espera por uma mensagem antes de desistir da partida. O servidor
+// encerra a partida quando a vez ou o prazo de reconexão do adversário expira
+func matchWait(reconnectBy time.Time) time.Duration {
+	wait := shared.TurnTimeout
+	if until := time.Until(reconnectBy); until > wait {
+		wait = until
+	}
+	return wait + 15*time.Second
+}
+
+// o adversário caiu; retorna o prazo que ele tem para voltar
+func printOpponentReconnecting(gameMsg shared.GameMessage, opponent shared.User) time.Time {
+	var room shared.GameRoom
+	json.Unmarshal(gameMsg.Data, &room)
+	style.PrintAma(fmt.Sprintf("\n%s caiu e está tentando reconectar (até %s). A partida está pausada.\n", opponent.UserName, room.ReconnectBy.Format(time.TimeOnly)))
+	return room.ReconnectBy
+}
+
+func printOpponentReconnected(opponent shared.User) {
+	style.PrintVerd(fmt.Sprintf("\n%s voltou! A partida continua.\n", opponent.UserName))
+}
+
+// quem caiu não voltou a tempo e perdeu. O MATCH_RESULT vem em seguida
+func printDisconnectLoss(gameMsg shared.GameMessage, currentUser shared.User, opponent shared.User) {
+	if gameMsg.Winner != nil && gameMsg.Winner.UserId == currentUser.UserId {
+		style.PrintVerd(fmt.Sprintf("\n%s não voltou a tempo. A vitória é sua!\n", opponent.UserName))
+		return
+	}
+	style.PrintVerm("\nVocê ficou desconectado por tempo demais e perdeu a partida.\n")
+}
+
+// só quem ficou na partida recebe o aviso; o MATCH_RESULT vem em seguida
+func printSurrender(opponent shared.User) {
+	style.PrintVerd(fmt.Sprintf("\n%s desistiu da partida. A vitória é sua!\n", opponent.UserName))
+}
+
+// mostra por que o servidor recusou a jogada. retry indica que dá para escolher
+// outra carta; endMatch, que não há mais como jogar nesta sala
+func printPlayRejected(gameMsg shared.GameMessage) (retry bool, endMatch bool) {
+	var rejection shared.PlayRejection
+	json.Unmarshal(gameMsg.Data, &rejection)
+
+	style.PrintVerm(fmt.Sprintf("\nJogada recusada pelo servidor: %s\n", rejection.Message))
+	switch rejection.Code {
+	case shared.PlayCardNotInDeck:
+		style.PrintMag("Confira seu deck no menu \"Ver/alterar deck\".\n")
+		return true, false
+	case shared.PlayFailed:
+		return true, false
+	case shared.PlayAlreadyPlayed, shared.PlayOpponentPending, shared.PlayNotYourTurn:
+		fmt.Println("Aguardando resultado da rodada...")
+		return false, false
+	}
+	return false, true
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"pbl/client/models"
+	"pbl/client/utils"
 	"pbl/shared"
 
 	"github.com/nats-io/nats.go"
@@ -30,8 +31,10 @@ func JoinQueue(nc *nats.Conn, server models.ServerInfo, user *shared.User, clien
 	}
 
 	req := shared.Request{
-		Action:  "JOIN_QUEUE",
-		Payload: json.RawMessage(payload),
+		ClientID: user.UserId,
+		Action:   "JOIN_QUEUE",
+		Payload:  json.RawMessage(payload),
+		Token:    utils.SessionToken(),
 	}
 
 	reqData, err := json.Marshal(req)
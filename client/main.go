@@ -7,11 +7,15 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"pbl/client/auction"
 	"pbl/client/game"
 	"pbl/client/models"
+	"pbl/client/profile"
+	"pbl/client/trade"
 	"pbl/client/utils"
 	"pbl/shared"
 	"pbl/style"
@@ -19,6 +23,9 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+// tentativas de reconexão ao NATS (a cada 2s) antes de desistir
+const reconnectAttempts = 60
+
 func main() {
 	servers := []models.ServerInfo{
 		{ID: 1, Name: "Servidor 1", NATS: "nats://localhost:4223"},
@@ -35,14 +42,30 @@ func main() {
 	chosenServer := servers[chooseInt-1]
 	fmt.Printf("\nVocê escolheu: %s (ID=%d)\n", chosenServer.Name, chosenServer.ID)
 
-	nc, err := nats.Connect(chosenServer.NATS, nats.MaxReconnects(0), 
+	clientID := fmt.Sprintf("cliente%d", utils.GerarIdAleatorio())
+
+	// o NATS escolhido vem primeiro; os outros só são usados se ele não voltar
+	// (quando os NATS estão em cluster, as mensagens chegam ao servidor escolhido)
+	natsURLs := []string{chosenServer.NATS}
+	for _, s := range servers {
+		if s.ID != chosenServer.ID {
+			natsURLs = append(natsURLs, s.NATS)
+		}
+	}
+
+	nc, err := nats.Connect(strings.Join(natsURLs, ","),
+		nats.DontRandomize(),
+		nats.MaxReconnects(reconnectAttempts),
+		nats.ReconnectWait(2*time.Second),
 		nats.DisconnectErrHandler(func(nc *nats.Conn, err error){
-			fmt.Println("CONEXÃO PERDIDA COM O SERVER")
-			if err != nil {
-				log.Fatalf("Erro ao conectar no NATS do servidor escolhido: %v", err)
-			}
-			fmt.Println("Cliente encerrando em 2 segundos...")
-			time.Sleep(2*time.Second)
+			fmt.Println("\nCONEXÃO PERDIDA COM O SERVER, tentando reconectar...")
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			fmt.Println("\nReconectado ao NATS:", nc.ConnectedUrl())
+			go resumeSession(nc, chosenServer, clientID)
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			fmt.Println("\nNão foi possível reconectar. Cliente encerrando...")
 			os.Exit(1)
 		}),
 	)
@@ -50,8 +73,6 @@ func main() {
 		log.Fatalf("Erro ao conectar no NATS do servidor escolhido: %v", err)
 	}
 	fmt.Println("Conectado ao NATS do servidor escolhido:", chosenServer.NATS)
-
-	clientID := fmt.Sprintf("cliente%d", utils.GerarIdAleatorio())
 	fmt.Printf("\nSeu ID desta sessão é: %s\n", clientID)
 
 	sigs := make(chan os.Signal, 1)
@@ -76,6 +97,8 @@ func handleMainMenu(nc *nats.Conn, server models.ServerInfo, clientID string) {
 				startGameLoop(nc, server, clientID, user)
 			}
 		case "2":
+			sendRegisterRequest(nc, server, clientID)
+		case "3":
 			fmt.Println("Até mais!")
 			return
 		default:
@@ -84,6 +107,19 @@ func handleMainMenu(nc *nats.Conn, server models.ServerInfo, clientID string) {
 	}
 }
 
+// cria a conta no cluster; o login é feito depois, pelo menu inicial
+func sendRegisterRequest(nc *nats.Conn, server models.ServerInfo, clientID string) {
+	account := utils.Cadastro()
+	response, ok := utils.SendRequest(nc, server, clientID, "REGISTER", account)
+	if !ok {
+		return
+	}
+
+	var user shared.User
+	json.Unmarshal(response.Data, &user)
+	style.PrintVerd(fmt.Sprintf("\nConta %s criada com %d cartas iniciais. Faça login para jogar.\n", user.UserName, len(user.Cards)))
+}
+
 func sendLoginRequest(nc *nats.Conn, server models.ServerInfo, clientID string) (shared.User, bool) {
 	credentials := utils.Login()
 	jsonData, err := json.Marshal(credentials)
@@ -119,6 +155,8 @@ func sendLoginRequest(nc *nats.Conn, server models.ServerInfo, clientID string)
 			fmt.Printf("\nErro ao decodificar dados do usuário: %v", err)
 			return shared.User{}, false
 		}
+		utils.SetSessionToken(user.SessionToken)
+		user.SessionToken = ""
 		fmt.Println("\nLogin realizado com sucesso!")
 		return user, true
 	}
@@ -182,14 +220,20 @@ func startGameLoop(nc *nats.Conn, server models.ServerInfo, clientID string, use
 			handleClientDrawCard(nc, server, clientID)
 		case "4":
 			style.Clear()
-			fmt.Println("Troca de cartas não implementada")
+			trade.MenuTrade(nc, server, clientID, &user)
 		case "5":
 			style.Clear()
-			utils.ShowRules()
+			auction.MenuAuction(nc, server, clientID, &user)
 		case "6":
 			style.Clear()
-			fmt.Println("Ping não implementado")
+			profile.MenuProfile(nc, server, clientID, &user)
 		case "7":
+			style.Clear()
+			utils.ShowRules()
+		case "8":
+			style.Clear()
+			fmt.Println("Ping não implementado")
+		case "9":
 			style.Clear()
 			fmt.Println("Deslogando...")
 			logout(nc, server, clientID)
@@ -226,6 +270,7 @@ func logout(nc *nats.Conn, server models.ServerInfo, clientID string) {
 	req := shared.Request{
 		ClientID: clientID,
 		Action:   "LOGOUT",
+		Token:    utils.SessionToken(),
 	}
 	reqData, _ := json.Marshal(req)
 
@@ -243,6 +288,7 @@ func logout(nc *nats.Conn, server models.ServerInfo, clientID string) {
 	}
 
 	if response.Status == "success" {
+		utils.SetSessionToken("")
 		fmt.Printf("\nLogout realizado com sucesso no servidor %d.", response.Server)
 	} else {
 		fmt.Printf("\nFalha no logout: %s", response.Error)
@@ -255,6 +301,7 @@ func handleClientDrawCard(nc *nats.Conn, server models.ServerInfo, clienteID str
 		ClientID: clienteID,
 		Action:   "OPEN_PACK",
 		Payload:  nil,
+		Token:    utils.SessionToken(),
 	}
 	reqData, _ := json.Marshal(req)
 
@@ -300,6 +347,7 @@ func handleClientSeeCards(nc *nats.Conn, server models.ServerInfo, clientID stri
 		ClientID: clientID,
 		Action: "SEE_CARDS",
 		Payload: nil,
+		Token:    utils.SessionToken(),
 	}
 	reqData,_ := json.Marshal(req)
 
@@ -340,46 +388,77 @@ func handleClientSeeCards(nc *nats.Conn, server models.ServerInfo, clientID stri
 
 func handleChangeDeck(nc *nats.Conn, server models.ServerInfo, clientID string, user *shared.User){
 	cards := handleClientSeeCards(nc, server, clientID)
-	deck := choseDeck(cards)
-	utils.MostrarInventario(deck)
-
-
-	deckCodf, err := json.Marshal(deck)
-	if err!=nil{
-		fmt.Printf("\nErro ao converter para JSON: %v", err)
+	if cards == nil {
 		return
 	}
-	req := shared.Request{
-		ClientID: clientID,
-		Action: "CHANGE_DECK",
-		Payload: deckCodf,
-	}
-	reqData, _ := json.Marshal(req)
-	topic := fmt.Sprintf("server.%d.requests", server.ID)
-	msg, err := nc.Request(topic, reqData, 5*time.Second)
-	if err != nil{
-		fmt.Printf("\nErro ao salvar deck: %v", err)
-		return
-
-	}
-	var response shared.Response
-	if err := json.Unmarshal(msg.Data, &response); err != nil {
-		fmt.Printf("\nErro ao decodificar resposta do servidor: %v", err)
+	if len(cards) < shared.DeckSize {
+		style.PrintMag(fmt.Sprintf("Você precisa de pelo menos %d cartas para montar um deck.\n", shared.DeckSize))
 		return
 	}
-	if response.Status == "success"{
-		user.Deck = deck 
-		style.PrintVerd("Deck salvo!")
-	} else {
-		style.PrintVerm("Erro ao salvar deck, tente novamente")
+
+	var deckErr *shared.DeckError
+	for {
+		deck := choseDeck(cards, deckErr)
+		utils.MostrarInventario(deck)
+
+		deckCodf, err := json.Marshal(deck)
+		if err!=nil{
+			fmt.Printf("\nErro ao converter para JSON: %v", err)
+			return
+		}
+		req := shared.Request{
+			ClientID: clientID,
+			Action: "CHANGE_DECK",
+			Payload: deckCodf,
+			Token:    utils.SessionToken(),
+		}
+		reqData, _ := json.Marshal(req)
+		topic := fmt.Sprintf("server.%d.requests", server.ID)
+		msg, err := nc.Request(topic, reqData, 5*time.Second)
+		if err != nil{
+			fmt.Printf("\nErro ao salvar deck: %v", err)
+			return
+
+		}
+		var response shared.Response
+		if err := json.Unmarshal(msg.Data, &response); err != nil {
+			fmt.Printf("\nErro ao decodificar resposta do servidor: %v", err)
+			return
+		}
+		if response.Status == "success"{
+			user.Deck = deck 
+			style.PrintVerd("Deck salvo!")
+			return
+		}
+
+		// o servidor explica o motivo em Data; servidores antigos só mandam o texto
+		deckErr = &shared.DeckError{Message: response.Error}
+		if len(response.Data) > 0 {
+			json.Unmarshal(response.Data, deckErr)
+		}
+		fmt.Print("\nMontar o deck de novo? (s/n): ")
+		if utils.ReadLineSafe() != "s" {
+			return
+		}
+		utils.MostrarInventario(cards)
 	}
 }
 
-func choseDeck(cards []shared.Card) []shared.Card{
+// escolhe as cartas do deck; se o servidor recusou o deck anterior, mostra o motivo antes
+func choseDeck(cards []shared.Card, deckErr *shared.DeckError) []shared.Card{
+	if deckErr != nil {
+		style.PrintVerm(fmt.Sprintf("\nO servidor recusou o deck: %s\n", deckErr.Message))
+		for i, carta := range cards {
+			if deckErr.CardID != "" && carta.Id == deckErr.CardID {
+				style.PrintMag(fmt.Sprintf("Carta com problema: [%d] - %s %s\n", i, carta.Element, carta.Type))
+			}
+		}
+	}
+
 	var selectedCards []int
 	var deck []shared.Card
 	if cards != nil{
-		for i := range(4){
+		for i := range(shared.DeckSize){
 			valida := false
 			for ! valida{
 				fmt.Printf("Digite o número da %d° carta para o baralho: ", i+1)
@@ -409,6 +488,7 @@ func handleClientSeeDeck(nc *nats.Conn, server models.ServerInfo, clientID strin
 		ClientID: clientID,
 		Action: "SEE_DECK",
 		Payload: nil,
+		Token:    utils.SessionToken(),
 	}
 	reqData,_ := json.Marshal(req)
 
@@ -453,8 +533,10 @@ func startHeartbeat(nc *nats.Conn, clientID, serverTopic string) {
 	go func() {
 		for {
 			req := shared.Request{
-				Action:  "HEARTBEAT",
-				Payload: nil,
+				ClientID: clientID,
+				Action:   "HEARTBEAT",
+				Payload:  nil,
+				Token:    utils.SessionToken(),
 			}
 			data, _ := json.Marshal(req)
 			nc.Publish(serverTopic, data)
@@ -472,8 +554,13 @@ func startClientListener(nc *nats.Conn, clientID string, pongChan chan bool) {
 			return
 		}
 
-		if resp.Action == "PONG" {
+		switch resp.Action {
+		case "PONG":
 			pongChan <- true // sinaliza que servidor respondeu
+		case "TRADE_PROPOSED", "TRADE_ACCEPTED", "TRADE_REJECTED":
+			trade.PrintNotification(resp)
+		case "AUCTION_OUTBID", "AUCTION_SOLD", "AUCTION_UNSOLD", "AUCTION_WON":
+			auction.PrintNotification(resp)
 		}
 	})
 }
@@ -488,6 +575,7 @@ func startPingLoop(nc *nats.Conn, clientID string, serverTopic string) {
 			req := shared.Request{
 				ClientID: clientID,
 				Action:   "PING",
+				Token:    utils.SessionToken(),
 			}
 			data, _ := json.Marshal(req)
 			nc.Publish(serverTopic, data)
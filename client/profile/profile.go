@@ -0,0 +1,132 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"pbl/client/models"
+	"pbl/client/utils"
+	"pbl/shared"
+	"pbl/style"
+
+	"github.com/nats-io/nats.go"
+)
+
+func MenuProfile(nc *nats.Conn, server models.ServerInfo, clientID string, user *shared.User) {
+	for {
+		switch utils.ShowMenuPerfil() {
+		case "1":
+			style.Clear()
+			ShowProfile(nc, server, clientID, "")
+		case "2":
+			style.Clear()
+			fmt.Print("Nome do jogador: ")
+			ShowProfile(nc, server, clientID, utils.ReadLineSafe())
+		case "3":
+			style.Clear()
+			showLeaderboard(nc, server, clientID, user, shared.LeaderboardByRating)
+		case "4":
+			style.Clear()
+			showLeaderboard(nc, server, clientID, user, shared.LeaderboardByWins)
+		case "5":
+			return
+		default:
+			fmt.Println("Opção inválida.")
+		}
+	}
+}
+
+// mostra a nota Elo e as estatísticas do jogador (o próprio, se userName for vazio)
+func ShowProfile(nc *nats.Conn, server models.ServerInfo, clientID, userName string) {
+	var payload interface{}
+	if userName != "" {
+		payload = map[string]string{"username": userName}
+	}
+	response, ok := utils.SendRequest(nc, server, clientID, "SEE_PROFILE", payload)
+	if !ok {
+		return
+	}
+	var p shared.PlayerProfile
+	if err := json.Unmarshal(response.Data, &p); err != nil {
+		log.Printf("Erro ao decodificar o perfil: %v", err)
+		return
+	}
+
+	fmt.Println("\n----------------------------------")
+	fmt.Printf("  Perfil de %s\n", p.UserName)
+	fmt.Println("----------------------------------")
+	style.PrintAma(fmt.Sprintf(" Nota (Elo): %d\n", p.Rating))
+	style.PrintVerd(fmt.Sprintf(" Vitórias:   %d\n", p.Wins))
+	style.PrintVerm(fmt.Sprintf(" Derrotas:   %d\n", p.Losses))
+	fmt.Printf(" Empates:    %d\n", p.Draws)
+	fmt.Println("----------------------------------")
+}
+
+// mostra o ranking em tabela, página por página
+func showLeaderboard(nc *nats.Conn, server models.ServerInfo, clientID string, user *shared.User, sortBy string) {
+	page := 1
+	for {
+		req := shared.LeaderboardRequest{SortBy: sortBy, Page: page}
+		response, ok := utils.SendRequest(nc, server, clientID, "LEADERBOARD", req)
+		if !ok {
+			return
+		}
+		var board shared.Leaderboard
+		if err := json.Unmarshal(response.Data, &board); err != nil {
+			log.Printf("Erro ao decodificar o ranking: %v", err)
+			return
+		}
+		printLeaderboard(board, user.UserName)
+
+		lastPage := (board.Total + board.PageSize - 1) / board.PageSize
+		fmt.Print("\n[p] próxima página | [a] página anterior | [enter] voltar: ")
+		switch utils.ReadLineSafe() {
+		case "p":
+			if page < lastPage {
+				page++
+			}
+		case "a":
+			if page > 1 {
+				page--
+			}
+		default:
+			return
+		}
+		style.Clear()
+	}
+}
+
+func printLeaderboard(board shared.Leaderboard, me string) {
+	title := "nota"
+	if board.SortBy == shared.LeaderboardByWins {
+		title = "vitórias"
+	}
+	lastPage := (board.Total + board.PageSize - 1) / board.PageSize
+	if lastPage == 0 {
+		lastPage = 1
+	}
+
+	fmt.Println("\n--------------------------------------------------")
+	fmt.Printf("  Ranking por %s (página %d de %d)\n", title, board.Page, lastPage)
+	fmt.Println("--------------------------------------------------")
+	style.PrintCian(fmt.Sprintf(" %-4s %-16s %6s %4s %4s %4s\n", "#", "Jogador", "Nota", "V", "D", "E"))
+	if len(board.Entries) == 0 {
+		fmt.Println(" Nenhum jogador nesta página.")
+	}
+	for _, e := range board.Entries {
+		line := fmt.Sprintf(" %-4d %-16s %6d %4d %4d %4d\n", e.Rank, e.UserName, e.Rating, e.Wins, e.Losses, e.Draws)
+		switch {
+		case e.UserName == me:
+			style.PrintVerd(line)
+		case e.Rank <= 3:
+			style.PrintAma(line)
+		default:
+			fmt.Print(line)
+		}
+	}
+	fmt.Println("--------------------------------------------------")
+	if board.MyRank > 0 {
+		style.PrintVerd(fmt.Sprintf(" Sua posição: %dº de %d\n", board.MyRank, board.Total))
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"pbl/client/models"
+	"pbl/client/utils"
+	"pbl/shared"
+	"pbl/style"
+
+	"github.com/nats-io/nats.go"
+)
+
+// chamado quando o NATS reconecta: pede ao servidor para continuar a sessão.
+// Se houver partida em andamento, o servidor reenvia o estado da sala
+func resumeSession(nc *nats.Conn, server models.ServerInfo, clientID string) {
+	token := utils.SessionToken()
+	if token == "" {
+		// ainda não fez login, não há o que retomar
+		return
+	}
+
+	req := shared.Request{
+		ClientID: clientID,
+		Action:   "RESUME_SESSION",
+		Token:    token,
+	}
+	reqData, _ := json.Marshal(req)
+
+	topic := fmt.Sprintf("server.%d.requests", server.ID)
+	msg, err := nc.Request(topic, reqData, 5*time.Second)
+	if err != nil {
+		style.PrintVerm(fmt.Sprintf("\nNão foi possível retomar a sessão: %v\n", err))
+		return
+	}
+
+	var response shared.Response
+	if err := json.Unmarshal(msg.Data, &response); err != nil {
+		fmt.Printf("\nErro ao decodificar resposta do servidor: %v", err)
+		return
+	}
+	if response.Status != "success" {
+		utils.SetSessionToken("")
+		style.PrintVerm(fmt.Sprintf("\nSessão não retomada: %s\n", response.Error))
+		return
+	}
+
+	var state shared.SessionState
+	json.Unmarshal(response.Data, &state)
+	if state.Room != nil {
+		style.PrintVerd("\nSessão retomada. Voltando para a partida...\n")
+	} else {
+		style.PrintVerd("\nSessão retomada.\n")
+	}
+}
@@ -0,0 +1,160 @@
+package trade
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"pbl/client/models"
+	"pbl/client/utils"
+	"pbl/shared"
+	"pbl/style"
+
+	"github.com/nats-io/nats.go"
+)
+
+func MenuTrade(nc *nats.Conn, server models.ServerInfo, clientID string, user *shared.User) {
+	for {
+		switch utils.ShowMenuTrocas() {
+		case "1":
+			style.Clear()
+			proposeTrade(nc, server, clientID, user)
+		case "2":
+			style.Clear()
+			listTrades(nc, server, clientID, user)
+		case "3":
+			style.Clear()
+			fmt.Print("Nome do jogador: ")
+			seePlayerCards(nc, server, clientID, utils.ReadLineSafe())
+		case "4":
+			return
+		default:
+			fmt.Println("Opção inválida.")
+		}
+	}
+}
+
+func seePlayerCards(nc *nats.Conn, server models.ServerInfo, clientID, userName string) ([]shared.Card, bool) {
+	cards, ok := utils.FetchCards(nc, server, clientID, "SEE_PLAYER_CARDS", map[string]string{"username": userName})
+	if ok {
+		utils.MostrarCartasDe(userName, cards)
+	}
+	return cards, ok
+}
+
+func proposeTrade(nc *nats.Conn, server models.ServerInfo, clientID string, user *shared.User) {
+	myCards, ok := utils.FetchCards(nc, server, clientID, "SEE_CARDS", nil)
+	if !ok || len(myCards) == 0 {
+		return
+	}
+	utils.MostrarInventario(myCards)
+	offered, ok := utils.ChooseIndex("Digite o número da carta que você vai oferecer: ", len(myCards))
+	if !ok {
+		return
+	}
+
+	fmt.Print("Nome do jogador com quem quer trocar: ")
+	to := utils.ReadLineSafe()
+	if to == user.UserName {
+		style.PrintMag("Não é possível trocar cartas consigo mesmo.\n")
+		return
+	}
+	theirCards, ok := seePlayerCards(nc, server, clientID, to)
+	if !ok || len(theirCards) == 0 {
+		return
+	}
+	requested, ok := utils.ChooseIndex("Digite o número da carta que você quer receber: ", len(theirCards))
+	if !ok {
+		return
+	}
+
+	proposal := shared.TradeProposal{
+		To:              to,
+		OfferedCardID:   myCards[offered].Id,
+		RequestedCardID: theirCards[requested].Id,
+	}
+	if _, ok := utils.SendRequest(nc, server, clientID, "PROPOSE_TRADE", proposal); ok {
+		style.PrintVerd(fmt.Sprintf("\nProposta enviada para %s! Aguarde a resposta.\n", to))
+	}
+}
+
+func listTrades(nc *nats.Conn, server models.ServerInfo, clientID string, user *shared.User) {
+	response, ok := utils.SendRequest(nc, server, clientID, "LIST_TRADES", nil)
+	if !ok {
+		return
+	}
+	var trades shared.Trades
+	if err := json.Unmarshal(response.Data, &trades); err != nil {
+		log.Printf("Erro ao decodificar as propostas: %v", err)
+		return
+	}
+
+	fmt.Println("\n----------------------------------")
+	fmt.Println("        Propostas de troca        ")
+	fmt.Println("----------------------------------")
+	if len(trades.Trades) == 0 {
+		fmt.Println("Nenhuma proposta pendente.")
+		return
+	}
+
+	var received []shared.Trade
+	for _, t := range trades.Trades {
+		if t.To == user.UserName {
+			fmt.Printf("[%d] - %s oferece ", len(received), t.From)
+			received = append(received, t)
+		} else {
+			fmt.Printf("      Você ofereceu a %s ", t.To)
+		}
+		utils.PrintCartaCor(t.OfferedCard)
+		fmt.Print(" por ")
+		utils.PrintCartaCor(t.RequestedCard)
+		if !t.ExpiresAt.IsZero() {
+			fmt.Printf(" | expira em %s", time.Until(t.ExpiresAt).Round(time.Second))
+		}
+		fmt.Print("\n")
+	}
+	if len(received) == 0 {
+		return
+	}
+
+	choice, ok := utils.ChooseIndex("\nDigite o número da proposta para responder (-1 para voltar): ", len(received))
+	if !ok {
+		return
+	}
+	fmt.Print("Aceitar a troca? (s/n): ")
+	answer := shared.TradeAnswer{TradeID: received[choice].ID, Accept: utils.ReadLineSafe() == "s"}
+
+	if _, ok := utils.SendRequest(nc, server, clientID, "ANSWER_TRADE", answer); ok {
+		if answer.Accept {
+			// a carta entregue pode estar no deck, que foi atualizado pelo servidor
+			if deck, ok := utils.FetchCards(nc, server, clientID, "SEE_DECK", nil); ok {
+				user.Deck = deck
+			}
+			style.PrintVerd("\nTroca realizada!\n")
+		} else {
+			style.PrintMag("\nProposta recusada.\n")
+		}
+	}
+}
+
+// mostra as notificações de troca que chegam na inbox do cliente
+func PrintNotification(resp shared.Response) {
+	var t shared.Trade
+	if err := json.Unmarshal(resp.Data, &t); err != nil {
+		return
+	}
+
+	switch resp.Action {
+	case "TRADE_PROPOSED":
+		style.PrintAma(fmt.Sprintf("\n[TROCA] %s quer trocar ", t.From))
+		utils.PrintCartaCor(t.OfferedCard)
+		style.PrintAma(" pela sua ")
+		utils.PrintCartaCor(t.RequestedCard)
+		style.PrintAma(". Responda em \"Trocar cartas\".\n")
+	case "TRADE_ACCEPTED":
+		style.PrintVerd(fmt.Sprintf("\n[TROCA] %s aceitou sua proposta!\n", t.To))
+	case "TRADE_REJECTED":
+		style.PrintMag(fmt.Sprintf("\n[TROCA] %s recusou sua proposta.\n", t.To))
+	}
+}
@@ -25,7 +25,8 @@ func MenuInicial() string {
 	fmt.Println("           MENU INICIAL           ")
 	fmt.Println("----------------------------------")
 	fmt.Println("1 - Login")
-	fmt.Println("2 - Sair")
+	fmt.Println("2 - Cadastrar")
+	fmt.Println("3 - Sair")
 	fmt.Print("Insira a opção desejada: ")
 	return ReadLineSafe()
 
@@ -39,9 +40,11 @@ func ShowMenuPrincipal() string {
 	fmt.Println("2 - Ver/alterar deck")
 	fmt.Println("3 - Abrir pacote")
 	fmt.Println("4 - Trocar cartas")
-	fmt.Println("5 - Visualizar regras")
-	fmt.Println("6 - Visualizar ping") 
-	fmt.Println("7 - Deslogar")
+	fmt.Println("5 - Casa de leilões")
+	fmt.Println("6 - Perfil e ranking")
+	fmt.Println("7 - Visualizar regras")
+	fmt.Println("8 - Visualizar ping") 
+	fmt.Println("9 - Deslogar")
 	fmt.Print("Insira a opção desejada: ")
 	return ReadLineSafe()
 }
@@ -87,6 +90,42 @@ func ShowMenuCards()string{
 }
 
 
+func ShowMenuTrocas() string {
+	fmt.Println("\n----------------------------------")
+	fmt.Println("           Menu Trocas            ")
+	fmt.Println("----------------------------------")
+	fmt.Println("1 - Propor troca")
+	fmt.Println("2 - Ver propostas")
+	fmt.Println("3 - Ver cartas de outro jogador")
+	fmt.Println("4 - Voltar ao menu principal")
+	fmt.Print("Insira a opção desejada: ")
+	return ReadLineSafe()
+}
+
+func ShowMenuLeiloes() string {
+	fmt.Println("\n----------------------------------")
+	fmt.Println("          Casa de leilões          ")
+	fmt.Println("----------------------------------")
+	fmt.Println("1 - Ver leilões / dar lance")
+	fmt.Println("2 - Leiloar uma carta")
+	fmt.Println("3 - Voltar ao menu principal")
+	fmt.Print("Insira a opção desejada: ")
+	return ReadLineSafe()
+}
+
+func ShowMenuPerfil() string {
+	fmt.Println("\n----------------------------------")
+	fmt.Println("         Perfil e ranking          ")
+	fmt.Println("----------------------------------")
+	fmt.Println("1 - Ver meu perfil")
+	fmt.Println("2 - Ver perfil de outro jogador")
+	fmt.Println("3 - Ranking por nota")
+	fmt.Println("4 - Ranking por vitórias")
+	fmt.Println("5 - Voltar ao menu principal")
+	fmt.Print("Insira a opção desejada: ")
+	return ReadLineSafe()
+}
+
 func PrintCartaCor(carta shared.Card){
 	cardString := fmt.Sprintf("%s %s", carta.Element, carta.Type)
 	switch carta.Element {
@@ -115,6 +154,17 @@ func MostrarInventario(cartas []shared.Card){
 	}
 }
 
+func MostrarCartasDe(nome string, cartas []shared.Card){
+	fmt.Println("\n----------------------------------")
+	fmt.Printf("  Cartas de %s\n", nome)
+	fmt.Println("----------------------------------")
+	for i,carta := range cartas{
+		fmt.Printf("[%d] - ", i)
+		PrintCartaCor(carta)
+		fmt.Print("\n")
+	}
+}
+
 //Printar as cartas do deck do usuário
 func ListCardsDeck(user *shared.User) {
 	fmt.Println("\n----------------------------------")
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"pbl/client/models"
+	"pbl/shared"
+	"pbl/style"
+
+	"github.com/nats-io/nats.go"
+)
+
+// envia a requisição e espera a resposta do servidor.
+// Em caso de falha a mensagem de erro já é mostrada ao jogador
+func SendRequest(nc *nats.Conn, server models.ServerInfo, clientID, action string, payload interface{}) (shared.Response, bool) {
+	var response shared.Response
+	req := shared.Request{
+		ClientID: clientID,
+		Action:   action,
+		Token:    SessionToken(),
+	}
+	if payload != nil {
+		req.Payload, _ = json.Marshal(payload)
+	}
+	reqData, _ := json.Marshal(req)
+
+	topic := fmt.Sprintf("server.%d.requests", server.ID)
+	msg, err := nc.Request(topic, reqData, 10*time.Second)
+	if err != nil {
+		log.Printf("Erro na requisição %s: %v", action, err)
+		return response, false
+	}
+	if err := json.Unmarshal(msg.Data, &response); err != nil {
+		log.Printf("Erro ao decodificar resposta de %s: %v", action, err)
+		return response, false
+	}
+	if response.Status != "success" {
+		style.PrintVerm(fmt.Sprintf("\n[FALHA] %s\n", response.Error))
+		return response, false
+	}
+	return response, true
+}
+
+// pede uma lista de cartas (SEE_CARDS, SEE_DECK, SEE_PLAYER_CARDS)
+func FetchCards(nc *nats.Conn, server models.ServerInfo, clientID, action string, payload interface{}) ([]shared.Card, bool) {
+	response, ok := SendRequest(nc, server, clientID, action, payload)
+	if !ok {
+		return nil, false
+	}
+	var cards shared.Cards
+	if err := json.Unmarshal(response.Data, &cards); err != nil {
+		log.Printf("Erro ao decodificar as cartas: %v", err)
+		return nil, false
+	}
+	return cards.Cards, true
+}
@@ -0,0 +1,21 @@
+package utils
+
+import "sync"
+
+// token da sessão atual, recebido no login e enviado em todos os pedidos
+var session struct {
+	sync.Mutex
+	token string
+}
+
+func SetSessionToken(token string) {
+	session.Lock()
+	session.token = token
+	session.Unlock()
+}
+
+func SessionToken() string {
+	session.Lock()
+	defer session.Unlock()
+	return session.token
+}
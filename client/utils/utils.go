@@ -10,9 +10,12 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
 	//"time"
 	//"pbl/shared"
+
+	"pbl/style"
 )
 
 func ReadLineSafe() string {
@@ -25,6 +28,21 @@ func ReadLineSafe() string {
     return strings.TrimSpace(input)
 }
 
+// lê o número de uma das opções listadas; -1 volta ao menu
+func ChooseIndex(prompt string, total int) (int, bool) {
+	for {
+		fmt.Print(prompt)
+		choice, err := strconv.Atoi(ReadLineSafe())
+		if err == nil && choice == -1 {
+			return 0, false
+		}
+		if err == nil && choice >= 0 && choice < total {
+			return choice, true
+		}
+		style.PrintMag("Valor inválido, digite um dos números listados (ou -1 para voltar)!\n")
+	}
+}
+
 func Contains(slice []int, value int) bool {
     for _, v := range slice {
         if v == value {
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pbl/shared"
+)
+
+func TestPasswordHash(t *testing.T) {
+	salt := NewSalt()
+	hash := HashPassword("segredo123", salt)
+
+	if hash == "segredo123" || hash == HashPassword("segredo123", NewSalt()) {
+		t.Fatalf("o hash deveria depender do sal e não guardar a senha")
+	}
+	if !CheckPassword("segredo123", salt, hash) {
+		t.Fatalf("a senha correta foi recusada")
+	}
+	if CheckPassword("segredo124", salt, hash) {
+		t.Fatalf("uma senha errada foi aceita")
+	}
+}
+
+func TestToken(t *testing.T) {
+	now := time.Now()
+	claims := Claims{UserName: "ana", ClientID: "c1", ExpiresAt: now.Add(time.Minute)}
+	token := IssueToken(claims)
+
+	got, err := VerifyToken(token, now)
+	if err != nil || got.UserName != "ana" || got.ClientID != "c1" {
+		t.Fatalf("token válido recusado: %+v, %v", got, err)
+	}
+
+	if _, err := VerifyToken(token, now.Add(2*time.Minute)); err != ErrExpiredToken {
+		t.Fatalf("token vencido: esperado %v, veio %v", ErrExpiredToken, err)
+	}
+
+	// trocar o usuário nos dados invalida a assinatura
+	forged := IssueToken(Claims{UserName: "bia", ClientID: "c1", ExpiresAt: claims.ExpiresAt})
+	_, signature, _ := strings.Cut(token, ".")
+	payload, _, _ := strings.Cut(forged, ".")
+	if _, err := VerifyToken(payload+"."+signature, now); err != ErrInvalidToken {
+		t.Fatalf("token adulterado: esperado %v, veio %v", ErrInvalidToken, err)
+	}
+	if _, err := VerifyToken("lixo", now); err != ErrInvalidToken {
+		t.Fatalf("token malformado: esperado %v, veio %v", ErrInvalidToken, err)
+	}
+}
+
+func TestValidateAccount(t *testing.T) {
+	cases := []struct {
+		userName, password, code string
+	}{
+		{"ana_1", "senha123", ""},
+		{"joão", "senha123", ""},
+		{"an", "senha123", shared.AccountInvalidName},
+		{"um_nome_grande_demais", "senha123", shared.AccountInvalidName},
+		{"ana maria", "senha123", shared.AccountInvalidName},
+		{"ana-1", "senha123", shared.AccountInvalidName},
+		{"ana_1", "s3nh", shared.AccountWeakPassword},
+		{"ana_1", "senhasenha", shared.AccountWeakPassword},
+		{"ana_1", "12345678", shared.AccountWeakPassword},
+		{"ana123", "ANA123", shared.AccountWeakPassword},
+	}
+	for _, c := range cases {
+		accountErr := ValidateAccount(c.userName, c.password)
+		switch {
+		case c.code == "" && accountErr != nil:
+			t.Errorf("%q/%q deveria ser aceito: %s", c.userName, c.password, accountErr.Message)
+		case c.code != "" && (accountErr == nil || accountErr.Code != c.code):
+			t.Errorf("%q/%q: esperava %s, veio %+v", c.userName, c.password, c.code, accountErr)
+		}
+	}
+}
+
+func TestPeerSignature(t *testing.T) {
+	body := []byte(`{"type":"GRANT_CARD"}`)
+	req := httptest.NewRequest(http.MethodPost, "/leader/apply", nil)
+	SignPeerRequest(req, body)
+
+	now := time.Now()
+	if err := VerifyPeer(req, body, now); err != nil {
+		t.Fatalf("requisição assinada recusada: %v", err)
+	}
+	if err := VerifyPeer(req, []byte(`{"type":"BID"}`), now); err != ErrPeerUnauthorized {
+		t.Errorf("corpo trocado deveria invalidar a assinatura: %v", err)
+	}
+	if err := VerifyPeer(req, body, now.Add(2*PeerClockSkew)); err != ErrPeerUnauthorized {
+		t.Errorf("assinatura antiga deveria ser recusada: %v", err)
+	}
+
+	other := httptest.NewRequest(http.MethodPost, "/admin/add-voter", nil)
+	other.Header = req.Header.Clone()
+	if err := VerifyPeer(other, body, now); err != ErrPeerUnauthorized {
+		t.Errorf("assinatura de outra rota deveria ser recusada: %v", err)
+	}
+	if err := VerifyPeer(httptest.NewRequest(http.MethodPost, "/leader/apply", nil), body, now); err != ErrPeerUnauthorized {
+		t.Errorf("requisição sem assinatura deveria ser recusada: %v", err)
+	}
+}
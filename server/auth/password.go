@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// iterações do PBKDF2; deixam cada tentativa de senha cara sem atrasar o login
+const hashIterations = 100_000
+
+// sal aleatório, gerado pelo servidor que propõe o cadastro
+func NewSalt() string {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return hex.EncodeToString(salt)
+}
+
+// hash da senha com o sal; é só isso que vai para o estado replicado
+func HashPassword(password, salt string) string {
+	key, err := pbkdf2.Key(sha256.New, password, []byte(salt), hashIterations, 32)
+	if err != nil {
+		// só acontece com parâmetros inválidos, que aqui são constantes
+		panic(err)
+	}
+	return hex.EncodeToString(key)
+}
+
+// confere a senha contra o hash guardado
+func CheckPassword(password, salt, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashPassword(password, salt)), []byte(hash)) == 1
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// cabeçalhos das requisições assinadas entre servidores (e pelo administrador)
+const (
+	PeerTimestampHeader = "X-Peer-Timestamp"
+	PeerSignatureHeader = "X-Peer-Signature"
+)
+
+// diferença máxima aceita entre o relógio de quem assina e o de quem confere;
+// limita por quanto tempo uma requisição capturada pode ser repetida
+const PeerClockSkew = time.Minute
+
+// limite do corpo lido antes de conferir a assinatura
+const maxPeerBody = 1 << 20
+
+var ErrPeerUnauthorized = errors.New("requisição sem assinatura válida")
+
+// HMAC-SHA256, com a chave de AUTH_SECRET, de "método\ncaminho\ntimestamp\ncorpo", em hex.
+// O mesmo valor pode ser calculado com openssl (ver Makefile)
+func PeerSignature(method, path, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, key())
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", method, path, timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// assina a requisição para outro servidor do cluster
+func SignPeerRequest(r *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set(PeerTimestampHeader, timestamp)
+	r.Header.Set(PeerSignatureHeader, PeerSignature(r.Method, r.URL.Path, timestamp, body))
+}
+
+// confere a assinatura e se o timestamp está dentro de PeerClockSkew
+func VerifyPeer(r *http.Request, body []byte, now time.Time) error {
+	timestamp := r.Header.Get(PeerTimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrPeerUnauthorized
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > PeerClockSkew || skew < -PeerClockSkew {
+		return ErrPeerUnauthorized
+	}
+
+	got, err := hex.DecodeString(r.Header.Get(PeerSignatureHeader))
+	want, _ := hex.DecodeString(PeerSignature(r.Method, r.URL.Path, timestamp, body))
+	if err != nil || !hmac.Equal(got, want) {
+		return ErrPeerUnauthorized
+	}
+	return nil
+}
+
+// só deixa passar requisições assinadas por um servidor do cluster
+func RequirePeer(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPeerBody))
+		if err != nil {
+			http.Error(w, "Payload da requisição inválido", http.StatusBadRequest)
+			return
+		}
+		if err := VerifyPeer(r, body, time.Now()); err != nil {
+			http.Error(w, "Requisição não autenticada", http.StatusUnauthorized)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"pbl/shared"
+)
+
+// regras do cadastro
+const (
+	MinUserNameLen = 3
+	MaxUserNameLen = 20
+	MinPasswordLen = 6
+	MaxPasswordLen = 72
+)
+
+// confere nome e senha de um novo cadastro. O nome entra no ID das cartas
+// iniciais, por isso só letras, números e '_'
+func ValidateAccount(userName, password string) *shared.AccountError {
+	nameLen := len([]rune(userName))
+	if nameLen < MinUserNameLen || nameLen > MaxUserNameLen {
+		return &shared.AccountError{
+			Code:    shared.AccountInvalidName,
+			Message: fmt.Sprintf("o nome de usuário deve ter entre %d e %d caracteres", MinUserNameLen, MaxUserNameLen),
+		}
+	}
+	for _, r := range userName {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return &shared.AccountError{Code: shared.AccountInvalidName, Message: "o nome de usuário só pode ter letras, números e '_'"}
+		}
+	}
+
+	return ValidatePassword(userName, password)
+}
+
+// confere só a senha, para contas que já existem (ex: senha definida pela administração)
+func ValidatePassword(userName, password string) *shared.AccountError {
+	passwordLen := len([]rune(password))
+	if passwordLen < MinPasswordLen || passwordLen > MaxPasswordLen {
+		return &shared.AccountError{
+			Code:    shared.AccountWeakPassword,
+			Message: fmt.Sprintf("a senha deve ter entre %d e %d caracteres", MinPasswordLen, MaxPasswordLen),
+		}
+	}
+	if !strings.ContainsFunc(password, unicode.IsLetter) || !strings.ContainsFunc(password, unicode.IsDigit) {
+		return &shared.AccountError{Code: shared.AccountWeakPassword, Message: "a senha deve ter letras e números"}
+	}
+	if strings.EqualFold(password, userName) {
+		return &shared.AccountError{Code: shared.AccountWeakPassword, Message: "a senha não pode ser igual ao nome de usuário"}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// validade do token emitido no login
+const TokenTTL = 24 * time.Hour
+
+var (
+	ErrInvalidToken = errors.New("token inválido")
+	ErrExpiredToken = errors.New("token expirado")
+)
+
+// dados assinados no token
+type Claims struct {
+	UserName  string    `json:"username"`
+	ClientID  string    `json:"clientID"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+var (
+	secret     []byte
+	secretOnce sync.Once
+)
+
+// lê a chave de assinatura de AUTH_SECRET. Sem ela, cada processo sorteia a sua
+// e os tokens deixam de valer quando o servidor reinicia
+func SetSecret() {
+	secretOnce.Do(loadSecret)
+}
+
+func key() []byte {
+	SetSecret()
+	return secret
+}
+
+func loadSecret() {
+	if value := os.Getenv("AUTH_SECRET"); value != "" {
+		secret = []byte(value)
+		return
+	}
+	log.Println("AUTH_SECRET não definido: usando uma chave aleatória para os tokens de sessão")
+	secret = make([]byte, 32)
+	rand.Read(secret)
+}
+
+// token no formato dados.assinatura, os dois em base64
+func IssueToken(claims Claims) string {
+	data, _ := json.Marshal(claims)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sign(payload))
+}
+
+// confere a assinatura e a validade do token
+func VerifyToken(token string, now time.Time) (Claims, error) {
+	var claims Claims
+
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return claims, ErrInvalidToken
+	}
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, sign(payload)) {
+		return claims, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, &claims) != nil {
+		return claims, ErrInvalidToken
+	}
+	if !now.Before(claims.ExpiresAt) {
+		return claims, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func sign(payload string) []byte {
+	mac := hmac.New(sha256.New, key())
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -1,10 +1,11 @@
 package cards
 
 import (
+	"fmt"
 	"math/rand"
-	"pbl/shared"
+	"sort"
 
-	"github.com/google/uuid"
+	"pbl/shared"
 )
 
 //var elements = []string{"AGUA", "TERRA", "FOGO", "AR", "MATO"}
@@ -17,28 +18,97 @@ var typesElemnts = map[string][]string{
 	"MATO": {"PRAGA", "SECO", "VENENOSO", "FLORIDO", "BAIXO", "ALTO", "FRACO", "TADINHO"},
 }
 
-func GerarEstoque() []shared.Card {
+// GerarEstoque gera o lote de cartas número batch a partir da seed.
+// A mesma seed e o mesmo lote geram exatamente as mesmas cartas (e IDs) em
+// qualquer réplica, por isso os dois vão no comando de reposição do log.
+func GerarEstoque(seed int64, batch uint64) []shared.Card {
+	rng := rand.New(rand.NewSource(seed))
+
+	// a ordem de iteração de um map muda a cada execução
+	elementos := make([]string, 0, len(typesElemnts))
+	for elemento := range typesElemnts {
+		elementos = append(elementos, elemento)
+	}
+	sort.Strings(elementos)
+
 	var estoque []shared.Card
-	for elemento, tipos := range typesElemnts {
+	for _, elemento := range elementos {
+		tipos := typesElemnts[elemento]
 
 		for range 8{
 			novaCartaNormal := shared.Card{
 				Element: elemento,
 				Type: "NORMAL",
-				Id: uuid.New().String(),
 			}
 			estoque = append(estoque, novaCartaNormal)
 			novaCartaRara := shared.Card{
 				Element: elemento,
-				Type: tipos[rand.Intn(len(tipos))],
-				Id: uuid.New().String(),
+				Type: tipos[rng.Intn(len(tipos))],
 			}
 			estoque = append(estoque, novaCartaRara)
 		}
 	}
-	rand.Shuffle(len(estoque), func(i, j int) {
+	rng.Shuffle(len(estoque), func(i, j int) {
 		estoque[i], estoque[j] = estoque[j], estoque[i]
 	})
 
+	for i := range estoque {
+		estoque[i].Id = fmt.Sprintf("lote%d-%03d", batch, i)
+	}
+
 	return estoque
 }
+
+// moedas que todo jogador recebe ao criar a conta, para usar na casa de leilões
+const StarterCoins = 100
+
+// cartas que todo jogador recebe ao criar a conta
+// os IDs dependem do nome do jogador para serem iguais em todas as réplicas
+func StarterCards(userName string) []shared.Card {
+	elements := []string{"AGUA", "TERRA", "FOGO", "AR", "MATO"}
+	starter := make([]shared.Card, 0, len(elements))
+	for i, element := range elements {
+		starter = append(starter, shared.Card{
+			Id:      fmt.Sprintf("inicial-%s-%d", userName, i+1),
+			Element: element,
+			Type:    "NORMAL",
+		})
+	}
+	return starter
+}
+
+// confere o deck pelo ID das cartas: tamanho, repetidas e se o jogador tem cada carta.
+// Retorna o deck com as cartas do inventário, para que o cliente não altere elemento ou tipo
+func ValidateDeck(owned []shared.Card, deck []shared.Card) ([]shared.Card, *shared.DeckError) {
+	if len(deck) != shared.DeckSize {
+		return nil, &shared.DeckError{
+			Code:    shared.DeckWrongSize,
+			Message: fmt.Sprintf("o deck deve ter %d cartas, recebido %d", shared.DeckSize, len(deck)),
+		}
+	}
+
+	inventory := make(map[string]shared.Card, len(owned))
+	for _, card := range owned {
+		inventory[card.Id] = card
+	}
+	seen := make(map[string]bool, len(deck))
+	validated := make([]shared.Card, 0, len(deck))
+	for _, card := range deck {
+		if seen[card.Id] {
+			return nil, &shared.DeckError{Code: shared.DeckDuplicateCard, CardID: card.Id, Message: fmt.Sprintf("a carta %s aparece mais de uma vez no deck", card.Id)}
+		}
+		seen[card.Id] = true
+
+		ownedCard, exists := inventory[card.Id]
+		if !exists {
+			return nil, &shared.DeckError{Code: shared.DeckCardNotOwned, CardID: card.Id, Message: fmt.Sprintf("a carta %s não está no seu inventário", card.Id)}
+		}
+		validated = append(validated, ownedCard)
+	}
+	return validated, nil
+}
+
+// deck inicial: as quatro primeiras cartas iniciais (sem o MATO)
+func StarterDeck(userName string) []shared.Card {
+	return StarterCards(userName)[:4]
+}
@@ -0,0 +1,16 @@
+package fsm
+
+import "math"
+
+const (
+	initialRating = 1000
+	eloK          = 32
+)
+
+// novas notas dos dois jogadores. scoreA é 1 se A venceu, 0 se perdeu e 0.5 no empate
+func eloUpdate(ratingA, ratingB int, scoreA float64) (int, int) {
+	expectedA := 1 / (1 + math.Pow(10, float64(ratingB-ratingA)/400))
+	delta := int(math.Round(eloK * (scoreA - expectedA)))
+	// o que um ganha o outro perde, então a soma das notas não muda
+	return ratingA + delta, ratingB - delta
+}
@@ -3,14 +3,18 @@ package fsm
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math/big"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"pbl/server/cards"
+	"pbl/server/game"
 
 	sharedRaft "pbl/server/shared"
 	"pbl/shared"
@@ -23,7 +27,13 @@ type FSM struct {
 	mu           sync.Mutex
 	users        map[string]shared.User // mapa de usuarios
 	cardStock    []shared.Card
-	pendingCards map[string]shared.Card
+	stockBatch   uint64 // último lote de cartas adicionado ao estoque
+	pendingCards map[string]sharedRaft.Reservation // reservas por RequestID
+	trades       map[string]shared.Trade // propostas de troca ainda sem resposta
+	auctions     map[string]shared.Auction // leilões abertos; a carta e o maior lance ficam retidos aqui
+	profiles     map[string]shared.PlayerProfile // nota Elo e estatísticas por jogador
+	matches      map[string]shared.MatchRecord   // resultados já registrados, por MatchID
+	credentials  map[string]sharedRaft.Credential // hash da senha por usuário, fora de shared.User para não ir aos clientes
 
 	//Para a parte global
 	GlobalQueue []shared.QueueEntry
@@ -33,16 +43,24 @@ type FSM struct {
 	GlobalRoomsMu sync.RWMutex
 
 	CreatedRooms chan *shared.GameRoom
+	ReadyRounds  chan *shared.GameRoom // salas com as duas cartas jogadas, para o host calcular o resultado
 	Raft *raft.Raft
+	leader atomic.Bool // atualizado pelo monitor de liderança
 }
 
 func NewFSM() *FSM {
 	return &FSM{
 		users:        make(map[string]shared.User),
-		cardStock:    cards.GerarEstoque(),
-		pendingCards: make(map[string]shared.Card),
+		// o estoque começa vazio e é preenchido pelo comando REPOR_ESTOQUE
+		pendingCards: make(map[string]sharedRaft.Reservation),
+		trades:       make(map[string]shared.Trade),
+		auctions:     make(map[string]shared.Auction),
+		profiles:     make(map[string]shared.PlayerProfile),
+		matches:      make(map[string]shared.MatchRecord),
+		credentials:  make(map[string]sharedRaft.Credential),
 		GlobalRooms:  make(map[string]*shared.GameRoom),
 		CreatedRooms: make(chan *shared.GameRoom, 10),
+		ReadyRounds:  make(chan *shared.GameRoom, 100),
 	}
 }
 
@@ -63,23 +81,25 @@ func (fsm *FSM) Apply(logEntry *raft.Log) interface{} {
 			return fmt.Errorf("failed to unmarshal DrawCardPayload: %w", err)
 		}
 
-		if card, exists := fsm.pendingCards[payload.RequestID]; exists {
-			log.Printf("[FSM] Comando DRAW_CARD repetido para RequestID %s. Retornando carta já pendente: %s", payload.RequestID, card.Type)
-			return card
+		if reservation, exists := fsm.pendingCards[payload.RequestID]; exists {
+			log.Printf("[FSM] Comando DRAW_CARD repetido para RequestID %s. Retornando carta já pendente: %s", payload.RequestID, reservation.Card.Type)
+			return reservation.Card
 		}
 
 		if len(fsm.cardStock) == 0 {
 			log.Println("[FSM] Tentativa de pegar carta do estoque, mas está vazio.")
-			fsm.cardStock = cards.GerarEstoque()
-			log.Println("\tNOVAS CARTAS ADICIONADAS NO ESTOQUE")
-			//return "STOCK_EMPTY"
+			return sharedRaft.ErrStockEmpty
 		}
 
 		drawnCard := fsm.cardStock[0]
 		fsm.cardStock = fsm.cardStock[1:]
-		fsm.pendingCards[payload.RequestID] = drawnCard
+		fsm.pendingCards[payload.RequestID] = sharedRaft.Reservation{
+			Card:      drawnCard,
+			PlayerID:  payload.PlayerID,
+			ExpiresAt: payload.ExpiresAt,
+		}
 
-		log.Printf("[FSM] Carta '%s' reservada para RequestID %s. Estoque restante: %d", drawnCard.Element, payload.RequestID, len(fsm.cardStock))
+		log.Printf("[FSM] Carta '%s' reservada para RequestID %s até %s. Estoque restante: %d", drawnCard.Element, payload.RequestID, payload.ExpiresAt.Format(time.RFC3339), len(fsm.cardStock))
 		return drawnCard
 
 	case sharedRaft.CommandClaimCard:
@@ -108,6 +128,7 @@ func (fsm *FSM) Apply(logEntry *raft.Log) interface{} {
 			}
 		}
 		if exists {
+			fsm.GlobalQueueMu.Unlock()
 			return nil
 		}
 		
@@ -117,7 +138,7 @@ func (fsm *FSM) Apply(logEntry *raft.Log) interface{} {
 		log.Printf("[FSM] Usuário %s adicionado à fila global", entry.Player.UserName)
 
 		// líder cria partidas
-		if fsm.Raft != nil && fsm.Raft.State() == raft.Leader {
+		if fsm.IsLeader() {
 			log.Println("[FSM] Sou o LÍDER! Tentando criar partidas...")
 			go fsm.TryMatchPlayers()
 		}
@@ -148,6 +169,225 @@ func (fsm *FSM) Apply(logEntry *raft.Log) interface{} {
 
 		return nil
 
+	case sharedRaft.CommandPlayCard:
+		var payload sharedRaft.PlayCardPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal PlayCardPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		room, exists := fsm.GlobalRooms[payload.RoomID]
+		if !exists {
+			return fmt.Errorf("sala %s não encontrada", payload.RoomID)
+		}
+		// a carta guardada é a do deck replicado, não a enviada pelo cliente
+		var deck []shared.Card
+		if player := game.RoomPlayer(room, payload.PlayerID); player != nil {
+			deck = fsm.users[player.UserName].Deck
+		}
+		card, rejection := game.ValidatePlay(room, payload.PlayerID, deck, payload.Card.Id)
+		if rejection != nil {
+			return errors.New(rejection.Message)
+		}
+		// o log antigo não tem horário; o tempo da vez continua contando de onde estava
+		game.AdvanceTurn(room, payload.PlayerID, room.TurnStartedAt)
+		fsm.storeCard(room, payload.PlayerID, card)
+		return nil
+
+	case sharedRaft.CommandCommitPlay:
+		var payload sharedRaft.CommitPlayPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal CommitPlayPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		room, exists := fsm.GlobalRooms[payload.RoomID]
+		if !exists {
+			return fmt.Errorf("sala %s não encontrada", payload.RoomID)
+		}
+		if rejection := game.ValidateCommit(room, payload.PlayerID); rejection != nil {
+			return errors.New(rejection.Message)
+		}
+		if room.Commitments == nil {
+			room.Commitments = make(map[string]string)
+		}
+		room.Commitments[payload.PlayerID] = payload.Commitment
+		game.AdvanceTurn(room, payload.PlayerID, payload.At)
+		log.Printf("[FSM] Jogada de %s registrada na sala %s (%d/2)", payload.PlayerID, payload.RoomID, len(room.Commitments))
+		return nil
+
+	case sharedRaft.CommandRevealPlay:
+		var payload sharedRaft.RevealPlayPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal RevealPlayPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		room, exists := fsm.GlobalRooms[payload.RoomID]
+		if !exists {
+			return fmt.Errorf("sala %s não encontrada", payload.RoomID)
+		}
+		var deck []shared.Card
+		if player := game.RoomPlayer(room, payload.PlayerID); player != nil {
+			deck = fsm.users[player.UserName].Deck
+		}
+		reveal := shared.PlayReveal{CardID: payload.CardID, Nonce: payload.Nonce}
+		card, rejection := game.ValidateReveal(room, payload.PlayerID, deck, reveal)
+		if rejection != nil {
+			return errors.New(rejection.Message)
+		}
+		fsm.storeCard(room, payload.PlayerID, card)
+		return nil
+
+	case sharedRaft.CommandFinishRound:
+		var payload sharedRaft.FinishRoundPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal FinishRoundPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		room, exists := fsm.GlobalRooms[payload.RoomID]
+		if !exists || room.Status == shared.Finished || room.Round+1 != payload.Round || len(room.PlayersCards) != 2 {
+			// rodada já contada (por exemplo, por um host anterior)
+			return nil
+		}
+		room.TurnStartedAt = payload.At
+		if game.ApplyRound(room, payload.ResultP1) {
+			room.Status = shared.Finished
+			switch game.MatchResult(room) {
+			case "GANHOU":
+				room.Winner = room.Player1
+			case "PERDEU":
+				room.Winner = room.Player2
+			}
+			room.FinishedAt = payload.At
+		}
+		log.Printf("[FSM] Sala %s: rodada %d terminada, placar %d x %d", room.ID, payload.Round, room.Score1, room.Score2)
+		return *game.CopyRoom(room)
+
+	case sharedRaft.CommandForfeitMatch:
+		var payload sharedRaft.ForfeitMatchPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal ForfeitMatchPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		room, exists := fsm.GlobalRooms[payload.RoomID]
+		if !exists || room.Status == shared.Finished {
+			return nil
+		}
+		switch payload.Reason {
+		case shared.EndTurnTimeout:
+			// a réplica de quem pediu podia estar atrasada: a vez é conferida de novo aqui
+			loser, expired := game.TimedOut(room, payload.At, shared.TurnTimeout)
+			if !expired || loser != payload.PlayerID {
+				return nil
+			}
+		case shared.EndSurrender:
+			if rejection := game.ValidateSurrender(room, payload.PlayerID); rejection != nil {
+				return errors.New(rejection.Message)
+			}
+		case shared.EndDisconnect:
+			if loser, expired := game.ReconnectExpired(room, payload.At); !expired || loser != payload.PlayerID {
+				return nil
+			}
+		}
+		game.Forfeit(room, payload.PlayerID, payload.Reason, payload.At)
+		log.Printf("[FSM] Sala %s encerrada (%s de %s)", room.ID, payload.Reason, payload.PlayerID)
+		return *game.CopyRoom(room)
+
+	case sharedRaft.CommandPauseRoom:
+		var payload sharedRaft.PauseRoomPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal PauseRoomPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		room, exists := fsm.GlobalRooms[payload.RoomID]
+		if !exists || !game.Pause(room, payload.PlayerID, payload.ReconnectBy) {
+			return nil
+		}
+		log.Printf("[FSM] Sala %s pausada: %s caiu", room.ID, payload.PlayerID)
+		return *game.CopyRoom(room)
+
+	case sharedRaft.CommandResumeRoom:
+		var payload sharedRaft.ResumeRoomPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal ResumeRoomPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		room, exists := fsm.GlobalRooms[payload.RoomID]
+		if !exists || !game.Resume(room, payload.PlayerID, payload.At) {
+			return nil
+		}
+		log.Printf("[FSM] Sala %s retomada: %s voltou", room.ID, payload.PlayerID)
+		return *game.CopyRoom(room)
+
+	case sharedRaft.CommandReassignHost:
+		var payload sharedRaft.ReassignHostPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal ReassignHostPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		room, exists := fsm.GlobalRooms[payload.RoomID]
+		if !exists || room.Status == shared.Finished || room.ServerID != payload.From {
+			return nil
+		}
+		room.ServerID = payload.To
+		log.Printf("[FSM] Sala %s: host trocado de server%d para server%d", room.ID, payload.From, payload.To)
+
+		// a rodada pode ter ficado completa enquanto o host antigo estava fora
+		if len(room.PlayersCards) == 2 {
+			fsm.roundReady(room)
+		}
+		return nil
+
+	case sharedRaft.CommandFinishRoom:
+		var payload sharedRaft.FinishRoomPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal FinishRoomPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		room, exists := fsm.GlobalRooms[payload.RoomID]
+		if !exists || room.Status == shared.Finished {
+			return nil
+		}
+		room.Status = shared.Finished
+		room.Winner = payload.Winner
+		room.FinishedAt = payload.At
+		log.Printf("[FSM] Sala %s finalizada", payload.RoomID)
+		return nil
+
+	case sharedRaft.CommandRemoveRoom:
+		var payload sharedRaft.RemoveRoomPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal RemoveRoomPayload: %w", err)
+		}
+		fsm.GlobalRoomsMu.Lock()
+		defer fsm.GlobalRoomsMu.Unlock()
+
+		removed := 0
+		for _, id := range payload.RoomIDs {
+			if _, exists := fsm.GlobalRooms[id]; exists {
+				delete(fsm.GlobalRooms, id)
+				removed++
+			}
+		}
+		log.Printf("[FSM] %d sala(s) global(is) removida(s)", removed)
+		return removed
+
 
 	case sharedRaft.CommandQueueLeave:
 		var entry shared.QueueEntry
@@ -165,14 +405,739 @@ func (fsm *FSM) Apply(logEntry *raft.Log) interface{} {
 		}
 		fsm.GlobalQueueMu.Unlock()
 		return nil
+
+	case sharedRaft.CommandRestock:
+		var payload sharedRaft.RestockPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal RestockPayload: %w", err)
+		}
+
+		// dois servidores podem pedir o mesmo lote ao mesmo tempo, só o primeiro vale
+		if payload.Batch != fsm.stockBatch+1 {
+			log.Printf("[FSM] Reposição do lote %d ignorada (último lote: %d)", payload.Batch, fsm.stockBatch)
+			return nil
+		}
+
+		fsm.cardStock = append(fsm.cardStock, cards.GerarEstoque(payload.Seed, payload.Batch)...)
+		fsm.stockBatch = payload.Batch
+		log.Printf("\tNOVAS CARTAS ADICIONADAS NO ESTOQUE (lote %d). Estoque: %d", payload.Batch, len(fsm.cardStock))
+		return nil
+
+	case sharedRaft.CommandCreateUser:
+		var payload sharedRaft.CreateUserPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal CreateUserPayload: %w", err)
+		}
+
+		// o comando pode ser repetido (nova tentativa de quem propôs) sem mudar nada,
+		// mas qualquer outra senha para o mesmo nome é recusada, inclusive numa conta
+		// criada antes das senhas: essa só recebe senha pela administração (CommandSetPassword)
+		if user, exists := fsm.users[payload.UserName]; exists {
+			if fsm.credentials[payload.UserName] != payload.Credential {
+				return sharedRaft.ErrUserExists
+			}
+			return copyUser(user)
+		}
+
+		user := shared.User{
+			UserName: payload.UserName,
+			Cards:    cards.StarterCards(payload.UserName),
+			Deck:     cards.StarterDeck(payload.UserName),
+			Coins:    cards.StarterCoins,
+		}
+		fsm.users[payload.UserName] = user
+		fsm.storeCredential(payload.UserName, payload.Credential)
+		log.Printf("[FSM] Conta criada para o usuário %s", payload.UserName)
+		return copyUser(user)
+
+	case sharedRaft.CommandSetPassword:
+		var payload sharedRaft.SetPasswordPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal SetPasswordPayload: %w", err)
+		}
+		if _, exists := fsm.users[payload.UserName]; !exists {
+			return fmt.Errorf("usuário %s não encontrado", payload.UserName)
+		}
+		if payload.Credential.Hash == "" {
+			return fmt.Errorf("senha vazia para o usuário %s", payload.UserName)
+		}
+		fsm.credentials[payload.UserName] = payload.Credential
+		log.Printf("[FSM] Senha do usuário %s definida pela administração", payload.UserName)
+		return nil
+
+	case sharedRaft.CommandGrantCard:
+		var payload sharedRaft.GrantCardPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal GrantCardPayload: %w", err)
+		}
+
+		user, exists := fsm.users[payload.UserName]
+		if !exists {
+			return fmt.Errorf("usuário %s não encontrado", payload.UserName)
+		}
+
+		reservation, exists := fsm.pendingCards[payload.RequestID]
+		if !exists {
+			// comando repetido: a carta já foi entregue antes
+			for _, owned := range user.Cards {
+				if owned.Id == payload.CardID {
+					return owned
+				}
+			}
+			log.Printf("[FSM] Nenhuma carta pendente para RequestID %s (reserva expirada)", payload.RequestID)
+			return sharedRaft.ErrReservationExpired
+		}
+		// a carta só vai para quem abriu o pacote; reservas de snapshots antigos não têm dono
+		if reservation.PlayerID != "" && reservation.PlayerID != payload.UserName {
+			log.Printf("[FSM] RequestID %s é de %s, recusando entrega para %s", payload.RequestID, reservation.PlayerID, payload.UserName)
+			return fmt.Errorf("a reserva %s não pertence a %s", payload.RequestID, payload.UserName)
+		}
+
+		card := reservation.Card
+		user.Cards = append(user.Cards, card)
+		fsm.users[payload.UserName] = user
+		delete(fsm.pendingCards, payload.RequestID)
+		log.Printf("[FSM] Carta '%s' entregue ao usuário %s (RequestID %s)", card.Element, payload.UserName, payload.RequestID)
+		return card
+
+	case sharedRaft.CommandReapReservations:
+		var payload sharedRaft.ReapReservationsPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal ReapReservationsPayload: %w", err)
+		}
+
+		// percorre em ordem para que o estoque fique igual em todas as réplicas
+		expired := fsm.expiredReservations(payload.Now)
+		for _, requestID := range expired {
+			reservation := fsm.pendingCards[requestID]
+			fsm.cardStock = append(fsm.cardStock, reservation.Card)
+			delete(fsm.pendingCards, requestID)
+			log.Printf("[FSM] Reserva %s de %s expirou, carta '%s' devolvida ao estoque", requestID, reservation.PlayerID, reservation.Card.Element)
+		}
+		return len(expired)
+
+	case sharedRaft.CommandReapTrades:
+		var payload sharedRaft.ReapTradesPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal ReapTradesPayload: %w", err)
+		}
+
+		expired := fsm.expiredTrades(payload.Now)
+		for _, tradeID := range expired {
+			trade := fsm.trades[tradeID]
+			delete(fsm.trades, tradeID)
+			log.Printf("[FSM] Troca %s de %s para %s expirou sem resposta", tradeID, trade.From, trade.To)
+		}
+		return len(expired)
+
+	case sharedRaft.CommandProposeTrade:
+		var payload sharedRaft.ProposeTradePayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal ProposeTradePayload: %w", err)
+		}
+		return fsm.proposeTrade(payload.Trade)
+
+	case sharedRaft.CommandAnswerTrade:
+		var payload sharedRaft.AnswerTradePayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal AnswerTradePayload: %w", err)
+		}
+		return fsm.answerTrade(payload)
+
+	case sharedRaft.CommandCreateAuction:
+		var payload sharedRaft.CreateAuctionPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal CreateAuctionPayload: %w", err)
+		}
+		return fsm.createAuction(payload.Auction)
+
+	case sharedRaft.CommandBid:
+		var payload sharedRaft.BidPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal BidPayload: %w", err)
+		}
+		return fsm.bid(payload)
+
+	case sharedRaft.CommandSettleAuctions:
+		var payload sharedRaft.SettleAuctionsPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal SettleAuctionsPayload: %w", err)
+		}
+		return fsm.settleAuctions(payload.Now)
+
+	case sharedRaft.CommandRecordMatch:
+		var payload sharedRaft.RecordMatchPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal RecordMatchPayload: %w", err)
+		}
+		return fsm.recordMatch(payload.Match)
+
+	case sharedRaft.CommandChangeDeck:
+		var payload sharedRaft.ChangeDeckPayload
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal ChangeDeckPayload: %w", err)
+		}
+
+		user, exists := fsm.users[payload.UserName]
+		if !exists {
+			return fmt.Errorf("usuário %s não encontrado", payload.UserName)
+		}
+		// validado de novo aqui, já que o inventário pode ter mudado desde a checagem do servidor
+		deck, deckErr := cards.ValidateDeck(user.Cards, payload.Deck)
+		if deckErr != nil {
+			return errors.New(deckErr.Message)
+		}
+		user.Deck = deck
+		fsm.users[payload.UserName] = user
+		log.Printf("[FSM] Deck do usuário %s atualizado", payload.UserName)
+		return nil
+
 	default:
 		return fmt.Errorf("unrecognized command type: %s", cmd.Type)
 	}
 }
 
+// registra a proposta se os dois jogadores têm as cartas envolvidas
+func (fsm *FSM) proposeTrade(trade shared.Trade) interface{} {
+	if existing, exists := fsm.trades[trade.ID]; exists {
+		return existing
+	}
+	if trade.From == trade.To {
+		return fmt.Errorf("não é possível trocar cartas consigo mesmo")
+	}
+
+	from, exists := fsm.users[trade.From]
+	if !exists {
+		return fmt.Errorf("usuário %s não encontrado", trade.From)
+	}
+	to, exists := fsm.users[trade.To]
+	if !exists {
+		return fmt.Errorf("usuário %s não encontrado", trade.To)
+	}
+
+	offered := findCard(from.Cards, trade.OfferedCardID)
+	if offered < 0 {
+		return fmt.Errorf("você não possui a carta %s", trade.OfferedCardID)
+	}
+	requested := findCard(to.Cards, trade.RequestedCardID)
+	if requested < 0 {
+		return fmt.Errorf("%s não possui a carta %s", trade.To, trade.RequestedCardID)
+	}
+
+	trade.OfferedCard = from.Cards[offered]
+	trade.RequestedCard = to.Cards[requested]
+	trade.Status = shared.TradePending
+	fsm.trades[trade.ID] = trade
+	log.Printf("[FSM] Troca %s proposta: %s oferece %s a %s por %s", trade.ID, trade.From, trade.OfferedCardID, trade.To, trade.RequestedCardID)
+	return trade
+}
+
+// responde a proposta. Na aceitação as duas cartas trocam de dono no mesmo Apply,
+// então nenhuma réplica vê um estado com a carta duplicada ou perdida
+func (fsm *FSM) answerTrade(answer sharedRaft.AnswerTradePayload) interface{} {
+	trade, exists := fsm.trades[answer.TradeID]
+	if !exists {
+		return fmt.Errorf("proposta de troca %s não encontrada", answer.TradeID)
+	}
+	if trade.To != answer.UserName {
+		return fmt.Errorf("a proposta %s não foi feita para %s", answer.TradeID, answer.UserName)
+	}
+	delete(fsm.trades, answer.TradeID)
+	// respostas de logs antigos não têm horário e não são conferidas
+	if !answer.At.IsZero() && !trade.ExpiresAt.After(answer.At) {
+		log.Printf("[FSM] Troca %s respondida por %s depois de expirar", trade.ID, trade.To)
+		return fmt.Errorf("a proposta %s expirou", answer.TradeID)
+	}
+
+	if !answer.Accept {
+		trade.Status = shared.TradeRejected
+		log.Printf("[FSM] Troca %s recusada por %s", trade.ID, trade.To)
+		return trade
+	}
+
+	// as cartas podem ter mudado de dono desde a proposta
+	from, to := fsm.users[trade.From], fsm.users[trade.To]
+	offered := findCard(from.Cards, trade.OfferedCardID)
+	requested := findCard(to.Cards, trade.RequestedCardID)
+	if offered < 0 || requested < 0 {
+		return fmt.Errorf("a troca %s não é mais válida, uma das cartas mudou de dono", trade.ID)
+	}
+
+	offeredCard, requestedCard := from.Cards[offered], to.Cards[requested]
+	from.Cards[offered] = requestedCard
+	to.Cards[requested] = offeredCard
+	// a carta recebida ocupa o lugar da entregue no deck, que continua com o mesmo tamanho
+	if i := findCard(from.Deck, offeredCard.Id); i >= 0 {
+		from.Deck[i] = requestedCard
+	}
+	if i := findCard(to.Deck, requestedCard.Id); i >= 0 {
+		to.Deck[i] = offeredCard
+	}
+	fsm.users[trade.From] = from
+	fsm.users[trade.To] = to
+
+	trade.Status = shared.TradeAccepted
+	log.Printf("[FSM] Troca %s concluída: %s <-> %s", trade.ID, trade.From, trade.To)
+	return trade
+}
+
+func findCard(cards []shared.Card, cardID string) int {
+	for i, card := range cards {
+		if card.Id == cardID {
+			return i
+		}
+	}
+	return -1
+}
+
+// propostas pendentes feitas ou recebidas pelo jogador, das mais antigas para as mais novas
+func (fsm *FSM) PendingTrades(userName string) []shared.Trade {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+
+	var list []shared.Trade
+	for _, trade := range fsm.trades {
+		if trade.From == userName || trade.To == userName {
+			list = append(list, trade)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// tira a carta do inventário do vendedor e abre o leilão
+func (fsm *FSM) createAuction(auction shared.Auction) interface{} {
+	if existing, exists := fsm.auctions[auction.ID]; exists {
+		return existing
+	}
+	if auction.ReservePrice < 1 {
+		return fmt.Errorf("o preço mínimo deve ser de pelo menos 1 moeda")
+	}
+
+	seller, exists := fsm.users[auction.Seller]
+	if !exists {
+		return fmt.Errorf("usuário %s não encontrado", auction.Seller)
+	}
+	i := findCard(seller.Cards, auction.Card.Id)
+	if i < 0 {
+		return fmt.Errorf("você não possui a carta %s", auction.Card.Id)
+	}
+	if findCard(seller.Deck, auction.Card.Id) >= 0 {
+		return fmt.Errorf("a carta %s está no seu deck, troque o deck antes de leiloá-la", auction.Card.Id)
+	}
+
+	auction.Card = seller.Cards[i]
+	auction.HighestBid = 0
+	auction.HighestBidder = ""
+	auction.Status = shared.AuctionOpen
+	seller.Cards = append(seller.Cards[:i:i], seller.Cards[i+1:]...)
+	fsm.users[auction.Seller] = seller
+	fsm.auctions[auction.ID] = auction
+
+	log.Printf("[FSM] Leilão %s criado por %s: carta '%s', mínimo %d, até %s", auction.ID, auction.Seller, auction.Card.Element, auction.ReservePrice, auction.EndsAt.Format(time.RFC3339))
+	return auction
+}
+
+// retém as moedas do novo lance e devolve as do lance anterior
+func (fsm *FSM) bid(payload sharedRaft.BidPayload) interface{} {
+	auction, exists := fsm.auctions[payload.AuctionID]
+	if !exists {
+		return fmt.Errorf("leilão %s não encontrado ou já encerrado", payload.AuctionID)
+	}
+	if !payload.At.Before(auction.EndsAt) {
+		return fmt.Errorf("o leilão %s já terminou", payload.AuctionID)
+	}
+	if payload.UserName == auction.Seller {
+		return fmt.Errorf("não é possível dar lance no próprio leilão")
+	}
+	if payload.Amount < auction.ReservePrice {
+		return fmt.Errorf("o lance mínimo é de %d moedas", auction.ReservePrice)
+	}
+	if payload.Amount <= auction.HighestBid {
+		return fmt.Errorf("o lance deve ser maior que %d moedas", auction.HighestBid)
+	}
+
+	bidder, exists := fsm.users[payload.UserName]
+	if !exists {
+		return fmt.Errorf("usuário %s não encontrado", payload.UserName)
+	}
+	// quem cobre o próprio lance só precisa da diferença
+	available := bidder.Coins
+	if auction.HighestBidder == payload.UserName {
+		available += auction.HighestBid
+	}
+	if available < payload.Amount {
+		return fmt.Errorf("moedas insuficientes: você tem %d", available)
+	}
+
+	result := sharedRaft.BidResult{}
+	if auction.HighestBidder != "" {
+		previous := fsm.users[auction.HighestBidder]
+		previous.Coins += auction.HighestBid
+		fsm.users[auction.HighestBidder] = previous
+		if auction.HighestBidder != payload.UserName {
+			result.Outbid = auction.HighestBidder
+		}
+	}
+	bidder = fsm.users[payload.UserName]
+	bidder.Coins -= payload.Amount
+	fsm.users[payload.UserName] = bidder
+
+	auction.HighestBid = payload.Amount
+	auction.HighestBidder = payload.UserName
+	fsm.auctions[auction.ID] = auction
+	result.Auction = auction
+
+	log.Printf("[FSM] Lance de %d moedas de %s no leilão %s", payload.Amount, payload.UserName, auction.ID)
+	return result
+}
+
+// entrega a carta e as moedas dos leilões que terminaram. Sem lances, a carta volta ao vendedor
+func (fsm *FSM) settleAuctions(now time.Time) interface{} {
+	settled := []shared.Auction{}
+	for _, id := range fsm.expiredAuctions(now) {
+		auction := fsm.auctions[id]
+		delete(fsm.auctions, id)
+
+		seller := fsm.users[auction.Seller]
+		if auction.HighestBidder == "" {
+			seller.Cards = append(seller.Cards, auction.Card)
+			auction.Status = shared.AuctionUnsold
+		} else {
+			buyer := fsm.users[auction.HighestBidder]
+			buyer.Cards = append(buyer.Cards, auction.Card)
+			fsm.users[auction.HighestBidder] = buyer
+			seller.Coins += auction.HighestBid
+			auction.Status = shared.AuctionSold
+		}
+		fsm.users[auction.Seller] = seller
+
+		log.Printf("[FSM] Leilão %s encerrado (%s)", auction.ID, auction.Status)
+		settled = append(settled, auction)
+	}
+	return settled
+}
+
+// IDs dos leilões terminados em now, em ordem
+func (fsm *FSM) expiredAuctions(now time.Time) []string {
+	var expired []string
+	for id, auction := range fsm.auctions {
+		if !auction.EndsAt.After(now) {
+			expired = append(expired, id)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// indica se há leilões para o líder encerrar
+func (fsm *FSM) HasExpiredAuctions(now time.Time) bool {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	return len(fsm.expiredAuctions(now)) > 0
+}
+
+// leilões abertos, dos que terminam primeiro para os últimos
+func (fsm *FSM) Auctions() []shared.Auction {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+
+	list := make([]shared.Auction, 0, len(fsm.auctions))
+	for _, auction := range fsm.auctions {
+		list = append(list, auction)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].EndsAt.Equal(list[j].EndsAt) {
+			return list[i].EndsAt.Before(list[j].EndsAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// registra o resultado e atualiza a nota e as estatísticas dos dois jogadores
+func (fsm *FSM) recordMatch(match shared.MatchRecord) interface{} {
+	if _, exists := fsm.matches[match.MatchID]; exists {
+		log.Printf("[FSM] Partida %s já registrada", match.MatchID)
+		return nil
+	}
+
+	var scoreP1 float64
+	switch match.Result {
+	case "GANHOU":
+		scoreP1 = 1
+	case "PERDEU":
+		scoreP1 = 0
+	case "EMPATE":
+		scoreP1 = 0.5
+	default:
+		return fmt.Errorf("resultado inválido para a partida %s: %q", match.MatchID, match.Result)
+	}
+
+	p1, p2 := fsm.profile(match.Player1), fsm.profile(match.Player2)
+	p1.Rating, p2.Rating = eloUpdate(p1.Rating, p2.Rating, scoreP1)
+	switch scoreP1 {
+	case 1:
+		p1.Wins++
+		p2.Losses++
+	case 0:
+		p1.Losses++
+		p2.Wins++
+	default:
+		p1.Draws++
+		p2.Draws++
+	}
+	fsm.profiles[match.Player1] = p1
+	fsm.profiles[match.Player2] = p2
+	fsm.matches[match.MatchID] = match
+
+	log.Printf("[FSM] Partida %s registrada: %s %s %s (notas %d / %d)", match.MatchID, match.Player1, match.Result, match.Player2, p1.Rating, p2.Rating)
+	return nil
+}
+
+// perfil do jogador; quem ainda não jogou começa com a nota inicial
+func (fsm *FSM) profile(userName string) shared.PlayerProfile {
+	if profile, exists := fsm.profiles[userName]; exists {
+		return profile
+	}
+	return shared.PlayerProfile{UserName: userName, Rating: initialRating}
+}
+
+// perfil de um jogador com conta criada
+func (fsm *FSM) GetProfile(userName string) (shared.PlayerProfile, bool) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+
+	if _, exists := fsm.users[userName]; !exists {
+		return shared.PlayerProfile{}, false
+	}
+	return fsm.profile(userName), true
+}
+
+// todos os jogadores com conta, do melhor para o pior. Empates são desfeitos
+// pelo nome, então todos os servidores com o mesmo log montam a mesma ordem
+func (fsm *FSM) Ranking(sortBy string) []shared.PlayerProfile {
+	fsm.mu.Lock()
+	ranking := make([]shared.PlayerProfile, 0, len(fsm.users))
+	for userName := range fsm.users {
+		ranking = append(ranking, fsm.profile(userName))
+	}
+	fsm.mu.Unlock()
+
+	sort.Slice(ranking, func(i, j int) bool {
+		a, b := ranking[i], ranking[j]
+		if sortBy == shared.LeaderboardByWins && a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return a.UserName < b.UserName
+	})
+	return ranking
+}
+
+// chamado pelo monitor de liderança quando este servidor ganha ou perde a liderança
+func (fsm *FSM) SetLeader(isLeader bool) {
+	fsm.leader.Store(isLeader)
+}
+
+func (fsm *FSM) IsLeader() bool {
+	return fsm.leader.Load()
+}
+
+// último lote de cartas adicionado ao estoque
+func (fsm *FSM) StockBatch() uint64 {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	return fsm.stockBatch
+}
+
+// RequestIDs das reservas expiradas em now, em ordem
+func (fsm *FSM) expiredReservations(now time.Time) []string {
+	var expired []string
+	for requestID, reservation := range fsm.pendingCards {
+		if !reservation.ExpiresAt.After(now) {
+			expired = append(expired, requestID)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// IDs das propostas de troca vencidas em now, em ordem. Propostas de antes do
+// prazo (sem ExpiresAt) vencem na primeira coleta
+func (fsm *FSM) expiredTrades(now time.Time) []string {
+	var expired []string
+	for tradeID, trade := range fsm.trades {
+		if !trade.ExpiresAt.After(now) {
+			expired = append(expired, tradeID)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// indica se existe alguma proposta de troca vencida, para o líder só propor a coleta quando necessário
+func (fsm *FSM) HasExpiredTrades(now time.Time) bool {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	return len(fsm.expiredTrades(now)) > 0
+}
+
+// indica se existe alguma reserva vencida, para o líder só propor a coleta quando necessário
+func (fsm *FSM) HasExpiredReservations(now time.Time) bool {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	return len(fsm.expiredReservations(now)) > 0
+}
+
+// lista as reservas pendentes, das que vencem primeiro para as últimas
+func (fsm *FSM) Reservations() []sharedRaft.ReservationInfo {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+
+	list := make([]sharedRaft.ReservationInfo, 0, len(fsm.pendingCards))
+	for requestID, reservation := range fsm.pendingCards {
+		list = append(list, sharedRaft.ReservationInfo{RequestID: requestID, Reservation: reservation})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].ExpiresAt.Equal(list[j].ExpiresAt) {
+			return list[i].ExpiresAt.Before(list[j].ExpiresAt)
+		}
+		return list[i].RequestID < list[j].RequestID
+	})
+	return list
+}
+
+// avisa o host que a rodada pode ser calculada. Envia uma cópia, já que a sala
+// continua sendo alterada pela FSM. Chamada com GlobalRoomsMu travado
+func (fsm *FSM) roundReady(room *shared.GameRoom) {
+	select {
+	case fsm.ReadyRounds <- game.CopyRoom(room):
+	default:
+		log.Printf("[FSM] Aviso: fila de rodadas cheia, rodada da sala %s descartada", room.ID)
+	}
+}
+
+// sala global em andamento, copiada para ser lida sem a trava
+func (fsm *FSM) GetRoom(roomID string) (shared.GameRoom, bool) {
+	fsm.GlobalRoomsMu.RLock()
+	defer fsm.GlobalRoomsMu.RUnlock()
+
+	room, exists := fsm.GlobalRooms[roomID]
+	if !exists {
+		return shared.GameRoom{}, false
+	}
+	return *game.CopyRoom(room), true
+}
+
+// salas globais terminadas ou abandonadas que o líder pode remover, em ordem
+func (fsm *FSM) ExpiredRooms(now time.Time, finishedRetention, abandonedTTL time.Duration) []string {
+	fsm.GlobalRoomsMu.RLock()
+	defer fsm.GlobalRoomsMu.RUnlock()
+
+	var ids []string
+	for id, room := range fsm.GlobalRooms {
+		if game.RoomExpired(room, now, finishedRetention, abandonedTTL) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// indica se o usuário está esperando partida na fila global
+func (fsm *FSM) InGlobalQueue(userName string) bool {
+	fsm.GlobalQueueMu.Lock()
+	defer fsm.GlobalQueueMu.Unlock()
+
+	for _, entry := range fsm.GlobalQueue {
+		if entry.Player.UserName == userName {
+			return true
+		}
+	}
+	return false
+}
+
+// cópia das salas globais que ainda não terminaram
+func (fsm *FSM) ActiveRooms() []shared.GameRoom {
+	fsm.GlobalRoomsMu.RLock()
+	defer fsm.GlobalRoomsMu.RUnlock()
+
+	rooms := make([]shared.GameRoom, 0, len(fsm.GlobalRooms))
+	for _, room := range fsm.GlobalRooms {
+		if room.Status != shared.Finished {
+			rooms = append(rooms, *game.CopyRoom(room))
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+	return rooms
+}
+
+// retorna uma cópia da conta replicada do jogador
+func (fsm *FSM) GetUser(userName string) (shared.User, bool) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+
+	user, exists := fsm.users[userName]
+	if !exists {
+		return shared.User{}, false
+	}
+	return copyUser(user), true
+}
+
+// comandos CREATE_USER de logs antigos não têm senha; a conta fica sem
+// credencial até a administração definir uma (CommandSetPassword)
+func (fsm *FSM) storeCredential(userName string, credential sharedRaft.Credential) {
+	if credential.Hash != "" {
+		fsm.credentials[userName] = credential
+	}
+}
+
+// retorna o sal e o hash da senha do jogador
+func (fsm *FSM) GetCredential(userName string) (sharedRaft.Credential, bool) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+
+	credential, exists := fsm.credentials[userName]
+	return credential, exists
+}
+
+// copia as listas de cartas para que quem lê não altere o estado da FSM
+func copyUser(user shared.User) shared.User {
+	user.Cards = append([]shared.Card(nil), user.Cards...)
+	user.Deck = append([]shared.Card(nil), user.Deck...)
+	return user
+}
+
+// versão atual do formato do snapshot.
+// Snapshots antigos não têm o campo Version (lido como 0) e só guardam CardStock e PendingCards.
+// Até a versão 2 as reservas eram só a carta, em PendingCards.
+const snapshotVersion = 7
+
 type FSMState struct {
+	Version      int
 	CardStock    []shared.Card
-	PendingCards map[string]shared.Card
+	StockBatch   uint64
+	PendingCards map[string]shared.Card `json:",omitempty"` // formato antigo, só lido no Restore
+	Reservations map[string]sharedRaft.Reservation
+	Trades       map[string]shared.Trade
+	Auctions     map[string]shared.Auction
+	Profiles     map[string]shared.PlayerProfile
+	Matches      map[string]shared.MatchRecord
+	Users        map[string]shared.User
+	Credentials  map[string]sharedRaft.Credential
+	GlobalQueue  []shared.QueueEntry
+	GlobalRooms  map[string]*shared.GameRoom
 }
 
 // cria saves do estado do servidor
@@ -181,14 +1146,51 @@ func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
 	defer f.mu.Unlock()
 
 	state := &FSMState{
+		Version:      snapshotVersion,
 		CardStock:    make([]shared.Card, len(f.cardStock)),
-		PendingCards: make(map[string]shared.Card),
+		StockBatch:   f.stockBatch,
+		Reservations: make(map[string]sharedRaft.Reservation),
+		Trades:       make(map[string]shared.Trade),
+		Auctions:     make(map[string]shared.Auction),
+		Profiles:     make(map[string]shared.PlayerProfile),
+		Matches:      make(map[string]shared.MatchRecord),
+		Users:        make(map[string]shared.User),
+		Credentials:  make(map[string]sharedRaft.Credential),
+		GlobalRooms:  make(map[string]*shared.GameRoom),
 	}
 	copy(state.CardStock, f.cardStock)
 	for k, v := range f.pendingCards {
-		state.PendingCards[k] = v
+		state.Reservations[k] = v
+	}
+	for k, v := range f.users {
+		state.Users[k] = copyUser(v)
+	}
+	for k, v := range f.credentials {
+		state.Credentials[k] = v
+	}
+	for k, v := range f.trades {
+		state.Trades[k] = v
+	}
+	for k, v := range f.auctions {
+		state.Auctions[k] = v
+	}
+	for k, v := range f.profiles {
+		state.Profiles[k] = v
+	}
+	for k, v := range f.matches {
+		state.Matches[k] = v
 	}
 
+	f.GlobalQueueMu.Lock()
+	state.GlobalQueue = append([]shared.QueueEntry(nil), f.GlobalQueue...)
+	f.GlobalQueueMu.Unlock()
+
+	f.GlobalRoomsMu.RLock()
+	for k, v := range f.GlobalRooms {
+		state.GlobalRooms[k] = game.CopyRoom(v)
+	}
+	f.GlobalRoomsMu.RUnlock()
+
 	return &fsmSnapshot{state: state}, nil
 }
 
@@ -201,11 +1203,77 @@ func (f *FSM) Restore(rc io.ReadCloser) error {
 	if err := json.NewDecoder(rc).Decode(&state); err != nil {
 		return err
 	}
+	if state.Version > snapshotVersion {
+		return fmt.Errorf("snapshot version %d is newer than supported version %d", state.Version, snapshotVersion)
+	}
+
+	// campos que não existem nas versões antigas voltam vazios
+	if state.Reservations == nil {
+		state.Reservations = make(map[string]sharedRaft.Reservation)
+	}
+	// reservas antigas não têm validade, então são devolvidas na próxima coleta
+	for requestID, card := range state.PendingCards {
+		state.Reservations[requestID] = sharedRaft.Reservation{Card: card}
+	}
+	if state.Users == nil {
+		state.Users = make(map[string]shared.User)
+	}
+	// contas de snapshots antigos ficam sem senha até o próximo login
+	if state.Credentials == nil {
+		state.Credentials = make(map[string]sharedRaft.Credential)
+	}
+	if state.Trades == nil {
+		state.Trades = make(map[string]shared.Trade)
+	}
+	if state.Auctions == nil {
+		state.Auctions = make(map[string]shared.Auction)
+	}
+	if state.Profiles == nil {
+		state.Profiles = make(map[string]shared.PlayerProfile)
+	}
+	if state.Matches == nil {
+		state.Matches = make(map[string]shared.MatchRecord)
+	}
+	if state.GlobalRooms == nil {
+		state.GlobalRooms = make(map[string]*shared.GameRoom)
+	}
+
 	f.cardStock = state.CardStock
-	f.pendingCards = state.PendingCards
+	f.stockBatch = state.StockBatch
+	f.pendingCards = state.Reservations
+	f.users = state.Users
+	f.credentials = state.Credentials
+	f.trades = state.Trades
+	f.auctions = state.Auctions
+	f.profiles = state.Profiles
+	f.matches = state.Matches
+
+	f.GlobalQueueMu.Lock()
+	f.GlobalQueue = state.GlobalQueue
+	f.GlobalQueueMu.Unlock()
+
+	f.GlobalRoomsMu.Lock()
+	f.GlobalRooms = state.GlobalRooms
+	f.GlobalRoomsMu.Unlock()
+
+	log.Printf("[FSM] Estado restaurado do snapshot (versão %d)", state.Version)
 	return nil
 }
 
+// guarda a carta da rodada e avisa o host quando as duas estiverem na mesa.
+// Deve ser chamada com GlobalRoomsMu travado
+func (fsm *FSM) storeCard(room *shared.GameRoom, playerID string, card shared.Card) {
+	if room.PlayersCards == nil {
+		room.PlayersCards = make(map[string]shared.Card)
+	}
+	room.PlayersCards[playerID] = card
+	log.Printf("[FSM] Carta de %s registrada na sala %s (%d/2)", playerID, room.ID, len(room.PlayersCards))
+
+	if len(room.PlayersCards) == 2 {
+		fsm.roundReady(room)
+	}
+}
+
 // snapshot do estado do servidor
 type fsmSnapshot struct {
 	state *FSMState
@@ -234,7 +1302,7 @@ func (fsm *FSM) TryMatchPlayers() {
 	fsm.mu.Lock()
 	defer fsm.mu.Unlock()
 
-	if fsm.Raft == nil || fsm.Raft.State() != raft.Leader {
+	if fsm.Raft == nil || !fsm.IsLeader() {
 		log.Println("[FSM] NÃO SOU O LÍDER, retornando")
 		return
 	}
@@ -246,15 +1314,21 @@ func (fsm *FSM) TryMatchPlayers() {
 		fsm.GlobalQueue = fsm.GlobalQueue[2:]
 
 		turn := chooseRandomPlayer(player1.UserId, player2.UserId)
+		createdAt := time.Now()
 
 		room := shared.GameRoom{
-			ID:        fmt.Sprintf("global-%s-vs-%s", player1.UserName, player2.UserName),
+			// o horário no ID evita que uma revanche sobrescreva a sala anterior
+			ID:        fmt.Sprintf("global-%s-vs-%s-%d", player1.UserName, player2.UserName, createdAt.UnixNano()),
 			Player1:   &player1,
 			Player2:   &player2,
 			Turn:      turn,
 			Status:    shared.WaitingPlayers,
 			Server1ID: player1.ServerID,
 			Server2ID: player2.ServerID,
+			CreatedAt: createdAt,
+			BestOf:    game.BestOf,
+			RoundStarter: turn,
+			TurnStartedAt: createdAt,
 		}
 
 		// Escolhe host
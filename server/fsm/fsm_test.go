@@ -0,0 +1,1012 @@
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"pbl/server/game"
+	sharedRaft "pbl/server/shared"
+	"pbl/shared"
+
+	"github.com/hashicorp/raft"
+)
+
+// sink em memória para os testes de snapshot
+type memorySink struct {
+	bytes.Buffer
+	cancelled bool
+}
+
+func (s *memorySink) ID() string    { return "test" }
+func (s *memorySink) Close() error  { return nil }
+func (s *memorySink) Cancel() error { s.cancelled = true; return nil }
+
+// FSM com estoque fixo para que todas as réplicas do teste comecem iguais
+func newTestFSM() *FSM {
+	f := NewFSM()
+	f.cardStock = []shared.Card{
+		{Id: "c1", Element: "AGUA", Type: "NORMAL"},
+		{Id: "c2", Element: "FOGO", Type: "DRAGÃO"},
+		{Id: "c3", Element: "AR", Type: "NORMAL"},
+	}
+	return f
+}
+
+func command(t *testing.T, cmdType string, payload interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("erro ao serializar payload: %v", err)
+	}
+	cmd, err := json.Marshal(sharedRaft.Command{Type: cmdType, Data: data})
+	if err != nil {
+		t.Fatalf("erro ao serializar comando: %v", err)
+	}
+	return cmd
+}
+
+func applyAll(t *testing.T, f *FSM, log [][]byte, firstIndex int) {
+	t.Helper()
+	for i, data := range log {
+		if resp := f.Apply(&raft.Log{Index: uint64(firstIndex + i), Data: data}); resp != nil {
+			if err, ok := resp.(error); ok {
+				t.Fatalf("comando %d falhou: %v", firstIndex+i, err)
+			}
+		}
+	}
+}
+
+func snapshotBytes(t *testing.T, f *FSM) []byte {
+	t.Helper()
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("erro ao criar snapshot: %v", err)
+	}
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("erro ao persistir snapshot: %v", err)
+	}
+	return sink.Bytes()
+}
+
+func testLog(t *testing.T) [][]byte {
+	alice := shared.User{UserName: "alice", UserId: "cliente1", ServerID: 1}
+	bob := shared.User{UserName: "bob", UserId: "cliente2", ServerID: 2}
+	room := shared.GameRoom{
+		ID:        "global-alice-vs-bob",
+		Player1:   &alice,
+		Player2:   &bob,
+		Turn:      alice.UserId,
+		Status:    shared.WaitingPlayers,
+		ServerID:  1,
+		Server1ID: 1,
+		Server2ID: 2,
+	}
+
+	return [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice", Credential: sharedRaft.Credential{Salt: "sal", Hash: "hash"}}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+		command(t, sharedRaft.CommandOpenPack, sharedRaft.DrawCardPayload{PlayerID: "alice", RequestID: "req1", ExpiresAt: time.Unix(200, 0)}),
+		command(t, sharedRaft.CommandOpenPack, sharedRaft.DrawCardPayload{PlayerID: "bob", RequestID: "req2", ExpiresAt: time.Unix(200, 0)}),
+		command(t, sharedRaft.CommandGrantCard, sharedRaft.GrantCardPayload{UserName: "alice", RequestID: "req1", CardID: "c1"}),
+		// corte do snapshot aqui
+		command(t, sharedRaft.CommandQueueJoinGlobal, shared.QueueEntry{Player: alice, ServerID: "1", JoinTime: time.Unix(100, 0).UTC()}),
+		command(t, sharedRaft.CommandQueueJoinGlobal, shared.QueueEntry{Player: bob, ServerID: "2", JoinTime: time.Unix(101, 0).UTC()}),
+		command(t, sharedRaft.CommandCreateRoom, room),
+		command(t, sharedRaft.CommandChangeDeck, sharedRaft.ChangeDeckPayload{UserName: "bob", Deck: []shared.Card{{Id: "inicial-bob-5"}, {Id: "inicial-bob-2"}, {Id: "inicial-bob-3"}, {Id: "inicial-bob-4"}}}),
+	}
+}
+
+func TestSnapshotRestoreMatchesLogReplay(t *testing.T) {
+	log := testLog(t)
+	const cut = 5
+
+	replayed := newTestFSM()
+	applyAll(t, replayed, log, 1)
+
+	leader := newTestFSM()
+	applyAll(t, leader, log[:cut], 1)
+
+	restored := newTestFSM()
+	if err := restored.Restore(io.NopCloser(bytes.NewReader(snapshotBytes(t, leader)))); err != nil {
+		t.Fatalf("erro ao restaurar snapshot: %v", err)
+	}
+	applyAll(t, restored, log[cut:], cut+1)
+
+	want := snapshotBytes(t, replayed)
+	got := snapshotBytes(t, restored)
+	if !bytes.Equal(want, got) {
+		t.Fatalf("estado restaurado difere do estado reaplicado\nreaplicado: %s\nrestaurado: %s", want, got)
+	}
+
+	user, ok := restored.GetUser("alice")
+	if !ok || len(user.Cards) != 6 {
+		t.Fatalf("esperava alice com 6 cartas, obteve %+v", user)
+	}
+}
+
+func TestSnapshotCoversAllState(t *testing.T) {
+	f := newTestFSM()
+	applyAll(t, f, testLog(t), 1)
+
+	restored := NewFSM()
+	if err := restored.Restore(io.NopCloser(bytes.NewReader(snapshotBytes(t, f)))); err != nil {
+		t.Fatalf("erro ao restaurar snapshot: %v", err)
+	}
+
+	if len(restored.users) != 2 {
+		t.Errorf("esperava 2 usuários, obteve %d", len(restored.users))
+	}
+	if _, ok := restored.credentials["alice"]; !ok {
+		t.Errorf("senha de alice não foi restaurada")
+	}
+	if len(restored.GlobalQueue) != 2 {
+		t.Errorf("esperava 2 jogadores na fila global, obteve %d", len(restored.GlobalQueue))
+	}
+	if _, ok := restored.GlobalRooms["global-alice-vs-bob"]; !ok {
+		t.Errorf("sala global não foi restaurada")
+	}
+	if reservation, ok := restored.pendingCards["req2"]; !ok || reservation.PlayerID != "bob" || !reservation.ExpiresAt.Equal(time.Unix(200, 0)) {
+		t.Errorf("reserva pendente não foi restaurada: %+v", reservation)
+	}
+}
+
+func TestRestoreLegacySnapshot(t *testing.T) {
+	legacy := `{"CardStock":[{"element":"TERRA","type":"NORMAL","id":"c9"}],"PendingCards":{"req":{"element":"AR","type":"NORMAL","id":"c8"}}}`
+
+	f := NewFSM()
+	if err := f.Restore(io.NopCloser(strings.NewReader(legacy))); err != nil {
+		t.Fatalf("erro ao restaurar snapshot antigo: %v", err)
+	}
+
+	if len(f.cardStock) != 1 || f.cardStock[0].Id != "c9" {
+		t.Errorf("estoque não restaurado: %+v", f.cardStock)
+	}
+	if f.users == nil || f.GlobalRooms == nil {
+		t.Fatalf("mapas devem ser inicializados ao restaurar snapshot antigo")
+	}
+	if reservation, ok := f.pendingCards["req"]; !ok || reservation.Card.Id != "c8" || !reservation.ExpiresAt.IsZero() {
+		t.Errorf("reserva antiga não foi migrada: %+v", reservation)
+	}
+
+	// a FSM continua utilizável depois de restaurar o formato antigo
+	applyAll(t, f, [][]byte{command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "carol"})}, 1)
+	if _, ok := f.GetUser("carol"); !ok {
+		t.Errorf("usuário não criado após restaurar snapshot antigo")
+	}
+}
+
+// entrada repetida na fila global (ex: duas tentativas do mesmo JOIN) não pode
+// deixar a fila travada para o snapshot e o matchmaking
+func TestDuplicateGlobalJoinReleasesQueue(t *testing.T) {
+	f := newTestFSM()
+	alice := shared.User{UserName: "alice", UserId: "cliente1", ServerID: 1}
+	join := command(t, sharedRaft.CommandQueueJoinGlobal, shared.QueueEntry{Player: alice, ServerID: "1", JoinTime: time.Unix(100, 0).UTC()})
+	applyAll(t, f, [][]byte{join, join}, 1)
+
+	done := make(chan struct{})
+	go func() {
+		if snap, err := f.Snapshot(); err == nil {
+			snap.Persist(&memorySink{})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("snapshot travou depois da entrada repetida na fila global")
+	}
+	if len(f.GlobalQueue) != 1 {
+		t.Errorf("esperava 1 jogador na fila global, obteve %d", len(f.GlobalQueue))
+	}
+}
+
+func TestRestoreRejectsNewerVersion(t *testing.T) {
+	f := NewFSM()
+	err := f.Restore(io.NopCloser(strings.NewReader(`{"Version": 999}`)))
+	if err == nil {
+		t.Fatal("esperava erro ao restaurar snapshot de versão futura")
+	}
+}
+
+func TestRestockIsDeterministic(t *testing.T) {
+	restock := [][]byte{
+		command(t, sharedRaft.CommandRestock, sharedRaft.RestockPayload{Batch: 1, Seed: 42}),
+		// pedido repetido do mesmo lote (ex: dois servidores viram o estoque vazio)
+		command(t, sharedRaft.CommandRestock, sharedRaft.RestockPayload{Batch: 1, Seed: 7}),
+	}
+
+	a, b := NewFSM(), NewFSM()
+	applyAll(t, a, restock, 1)
+	applyAll(t, b, restock, 1)
+
+	if len(a.cardStock) == 0 {
+		t.Fatal("estoque continua vazio após a reposição")
+	}
+	if !bytes.Equal(snapshotBytes(t, a), snapshotBytes(t, b)) {
+		t.Fatal("réplicas terminaram com estoques diferentes")
+	}
+	if a.stockBatch != 1 || len(a.cardStock) != 80 {
+		t.Errorf("lote repetido não deveria ser aplicado: lote %d, %d cartas", a.stockBatch, len(a.cardStock))
+	}
+
+	ids := make(map[string]bool)
+	for _, card := range a.cardStock {
+		if ids[card.Id] {
+			t.Fatalf("ID de carta repetido: %s", card.Id)
+		}
+		ids[card.Id] = true
+	}
+}
+
+func TestOpenPackWithEmptyStock(t *testing.T) {
+	f := NewFSM()
+	resp := f.Apply(&raft.Log{Index: 1, Data: command(t, sharedRaft.CommandOpenPack, sharedRaft.DrawCardPayload{PlayerID: "alice", RequestID: "req1"})})
+
+	err, ok := resp.(error)
+	if !ok || !sharedRaft.IsStockEmpty(err) {
+		t.Fatalf("esperava ErrStockEmpty, obteve %v", resp)
+	}
+}
+
+func TestReapExpiredReservations(t *testing.T) {
+	f := newTestFSM()
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandOpenPack, sharedRaft.DrawCardPayload{PlayerID: "alice", RequestID: "req1", ExpiresAt: time.Unix(100, 0)}),
+		command(t, sharedRaft.CommandOpenPack, sharedRaft.DrawCardPayload{PlayerID: "alice", RequestID: "req2", ExpiresAt: time.Unix(300, 0)}),
+	}, 1)
+
+	if !f.HasExpiredReservations(time.Unix(150, 0)) {
+		t.Fatal("esperava reserva vencida em t=150")
+	}
+	resp := f.Apply(&raft.Log{Index: 4, Data: command(t, sharedRaft.CommandReapReservations, sharedRaft.ReapReservationsPayload{Now: time.Unix(150, 0)})})
+	if reaped, ok := resp.(int); !ok || reaped != 1 {
+		t.Fatalf("esperava 1 reserva recolhida, obteve %v", resp)
+	}
+
+	// a carta de req1 volta para o fim do estoque e a de req2 continua reservada
+	if len(f.cardStock) != 2 || f.cardStock[1].Id != "c1" {
+		t.Errorf("carta expirada não voltou ao estoque: %+v", f.cardStock)
+	}
+	if list := f.Reservations(); len(list) != 1 || list[0].RequestID != "req2" {
+		t.Errorf("reservas pendentes inesperadas: %+v", list)
+	}
+
+	// entregar uma reserva já recolhida falha
+	resp = f.Apply(&raft.Log{Index: 5, Data: command(t, sharedRaft.CommandGrantCard, sharedRaft.GrantCardPayload{UserName: "alice", RequestID: "req1", CardID: "c1"})})
+	if err, ok := resp.(error); !ok || !sharedRaft.IsReservationExpired(err) {
+		t.Fatalf("esperava ErrReservationExpired, obteve %v", resp)
+	}
+
+	// um GRANT_CARD repetido depois da entrega devolve a mesma carta
+	grant := command(t, sharedRaft.CommandGrantCard, sharedRaft.GrantCardPayload{UserName: "alice", RequestID: "req2", CardID: "c2"})
+	f.Apply(&raft.Log{Index: 6, Data: grant})
+	resp = f.Apply(&raft.Log{Index: 7, Data: grant})
+	if card, ok := resp.(shared.Card); !ok || card.Id != "c2" {
+		t.Fatalf("GRANT_CARD repetido deveria devolver a carta entregue, obteve %v", resp)
+	}
+}
+
+func TestGrantCardChecksReservationOwner(t *testing.T) {
+	f := newTestFSM()
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+		command(t, sharedRaft.CommandOpenPack, sharedRaft.DrawCardPayload{PlayerID: "alice", RequestID: "req1", ExpiresAt: time.Unix(300, 0)}),
+	}, 1)
+
+	// a reserva de alice não pode ser entregue ao bob
+	steal := command(t, sharedRaft.CommandGrantCard, sharedRaft.GrantCardPayload{UserName: "bob", RequestID: "req1", CardID: "c1"})
+	if _, ok := f.Apply(&raft.Log{Index: 4, Data: steal}).(error); !ok {
+		t.Fatal("entregar a reserva de alice ao bob deveria falhar")
+	}
+	if bob, _ := f.GetUser("bob"); findCard(bob.Cards, "c1") >= 0 {
+		t.Fatal("bob não deveria ter recebido a carta de alice")
+	}
+
+	// a reserva continua valendo para a dona
+	grant := command(t, sharedRaft.CommandGrantCard, sharedRaft.GrantCardPayload{UserName: "alice", RequestID: "req1", CardID: "c1"})
+	if card, ok := f.Apply(&raft.Log{Index: 5, Data: grant}).(shared.Card); !ok || card.Id != "c1" {
+		t.Fatalf("alice deveria receber a carta reservada, obteve %v", card)
+	}
+}
+
+func TestReapExpiredTrades(t *testing.T) {
+	f := newTestFSM()
+	propose := func(id, offered string, expiresAt time.Time) []byte {
+		trade := shared.Trade{ID: id, From: "alice", To: "bob", OfferedCardID: offered, RequestedCardID: "inicial-bob-1", CreatedAt: time.Unix(100, 0), ExpiresAt: expiresAt}
+		return command(t, sharedRaft.CommandProposeTrade, sharedRaft.ProposeTradePayload{Trade: trade})
+	}
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+		propose("t1", "inicial-alice-1", time.Unix(200, 0)),
+		propose("t2", "inicial-alice-2", time.Unix(400, 0)),
+		// proposta de antes do prazo: vence na primeira coleta
+		propose("t3", "inicial-alice-3", time.Time{}),
+	}, 1)
+
+	// responder depois do prazo falha mesmo antes da coleta
+	late := sharedRaft.AnswerTradePayload{TradeID: "t1", UserName: "bob", Accept: true, At: time.Unix(250, 0)}
+	if _, ok := f.Apply(&raft.Log{Index: 6, Data: command(t, sharedRaft.CommandAnswerTrade, late)}).(error); !ok {
+		t.Fatal("resposta a uma proposta vencida deveria ser recusada")
+	}
+	if alice, _ := f.GetUser("alice"); findCard(alice.Cards, "inicial-bob-1") >= 0 {
+		t.Fatal("a troca vencida não deveria ter sido feita")
+	}
+
+	if !f.HasExpiredTrades(time.Unix(300, 0)) {
+		t.Fatal("esperava proposta vencida em t=300")
+	}
+	resp := f.Apply(&raft.Log{Index: 7, Data: command(t, sharedRaft.CommandReapTrades, sharedRaft.ReapTradesPayload{Now: time.Unix(300, 0)})})
+	if reaped, ok := resp.(int); !ok || reaped != 1 {
+		t.Fatalf("esperava 1 proposta descartada, obteve %v", resp)
+	}
+	if list := f.PendingTrades("bob"); len(list) != 1 || list[0].ID != "t2" {
+		t.Errorf("propostas pendentes inesperadas: %+v", list)
+	}
+	if f.HasExpiredTrades(time.Unix(300, 0)) {
+		t.Error("não deveria sobrar proposta vencida em t=300")
+	}
+}
+
+func TestTradeSwapsCardsAtomically(t *testing.T) {
+	f := newTestFSM()
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+	}, 1)
+
+	propose := func(index uint64, id, offered, requested string) interface{} {
+		trade := shared.Trade{ID: id, From: "alice", To: "bob", OfferedCardID: offered, RequestedCardID: requested, CreatedAt: time.Unix(100, 0)}
+		return f.Apply(&raft.Log{Index: index, Data: command(t, sharedRaft.CommandProposeTrade, sharedRaft.ProposeTradePayload{Trade: trade})})
+	}
+	answer := func(index uint64, id, userName string, accept bool) interface{} {
+		payload := sharedRaft.AnswerTradePayload{TradeID: id, UserName: userName, Accept: accept}
+		return f.Apply(&raft.Log{Index: index, Data: command(t, sharedRaft.CommandAnswerTrade, payload)})
+	}
+
+	// alice não tem a carta do bob
+	if _, ok := propose(3, "t0", "inicial-bob-1", "inicial-bob-2").(error); !ok {
+		t.Fatal("esperava erro ao oferecer carta de outro jogador")
+	}
+
+	// duas propostas usando a mesma carta da alice
+	if resp, ok := propose(4, "t1", "inicial-alice-1", "inicial-bob-5").(shared.Trade); !ok || resp.Status != shared.TradePending {
+		t.Fatalf("proposta não registrada: %v", resp)
+	}
+	propose(5, "t2", "inicial-alice-1", "inicial-bob-2")
+
+	if _, ok := answer(6, "t1", "alice", true).(error); !ok {
+		t.Fatal("só o destinatário pode responder a proposta")
+	}
+	resp, ok := answer(7, "t1", "bob", true).(shared.Trade)
+	if !ok || resp.Status != shared.TradeAccepted {
+		t.Fatalf("troca não aceita: %v", resp)
+	}
+
+	alice, _ := f.GetUser("alice")
+	bob, _ := f.GetUser("bob")
+	if findCard(alice.Cards, "inicial-bob-5") < 0 || findCard(alice.Cards, "inicial-alice-1") >= 0 {
+		t.Errorf("cartas da alice não foram trocadas: %+v", alice.Cards)
+	}
+	if findCard(bob.Cards, "inicial-alice-1") < 0 || findCard(bob.Cards, "inicial-bob-5") >= 0 {
+		t.Errorf("cartas do bob não foram trocadas: %+v", bob.Cards)
+	}
+	// a carta entregue pela alice estava no deck e foi substituída pela recebida
+	if alice.Deck[0].Id != "inicial-bob-5" || len(alice.Deck) != 4 {
+		t.Errorf("deck da alice não foi atualizado: %+v", alice.Deck)
+	}
+	if len(alice.Cards)+len(bob.Cards) != 10 {
+		t.Errorf("a troca criou ou perdeu cartas: %d + %d", len(alice.Cards), len(bob.Cards))
+	}
+
+	// a segunda proposta ficou inválida porque a carta da alice já foi trocada
+	if _, ok := answer(8, "t2", "bob", true).(error); !ok {
+		t.Fatal("esperava erro ao aceitar troca com carta que mudou de dono")
+	}
+	if len(f.PendingTrades("alice")) != 0 {
+		t.Errorf("não deveriam sobrar propostas pendentes: %+v", f.PendingTrades("alice"))
+	}
+}
+
+func TestAuctionEscrowAndSettlement(t *testing.T) {
+	f := newTestFSM()
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "carol"}),
+	}, 1)
+	index := uint64(3)
+	apply := func(cmdType string, payload interface{}) interface{} {
+		index++
+		return f.Apply(&raft.Log{Index: index, Data: command(t, cmdType, payload)})
+	}
+	coins := func(userName string) int {
+		user, _ := f.GetUser(userName)
+		return user.Coins
+	}
+	bid := func(userName string, amount int, at int64) interface{} {
+		return apply(sharedRaft.CommandBid, sharedRaft.BidPayload{AuctionID: "a1", UserName: userName, Amount: amount, At: time.Unix(at, 0)})
+	}
+
+	auction := shared.Auction{ID: "a1", Seller: "alice", Card: shared.Card{Id: "inicial-alice-5"}, ReservePrice: 10, EndsAt: time.Unix(200, 0)}
+	if _, ok := apply(sharedRaft.CommandCreateAuction, sharedRaft.CreateAuctionPayload{Auction: auction}).(shared.Auction); !ok {
+		t.Fatal("leilão não foi criado")
+	}
+	// cartas do deck não podem ser leiloadas
+	inDeck := shared.Auction{ID: "a2", Seller: "alice", Card: shared.Card{Id: "inicial-alice-1"}, ReservePrice: 10, EndsAt: time.Unix(200, 0)}
+	if _, ok := apply(sharedRaft.CommandCreateAuction, sharedRaft.CreateAuctionPayload{Auction: inDeck}).(error); !ok {
+		t.Error("esperava erro ao leiloar carta do deck")
+	}
+	if alice, _ := f.GetUser("alice"); findCard(alice.Cards, "inicial-alice-5") >= 0 {
+		t.Fatal("a carta leiloada deveria ficar retida no leilão")
+	}
+
+	if _, ok := bid("bob", 5, 100).(error); !ok {
+		t.Error("lance abaixo do mínimo deveria ser recusado")
+	}
+	bid("bob", 20, 100)
+	if coins("bob") != 80 {
+		t.Errorf("moedas do lance não foram retidas: bob tem %d", coins("bob"))
+	}
+	result, ok := bid("carol", 30, 150).(sharedRaft.BidResult)
+	if !ok || result.Outbid != "bob" {
+		t.Fatalf("esperava bob superado, obteve %v", result)
+	}
+	if coins("bob") != 100 || coins("carol") != 70 {
+		t.Errorf("reembolso incorreto: bob %d, carol %d", coins("bob"), coins("carol"))
+	}
+	if _, ok := bid("bob", 40, 250).(error); !ok {
+		t.Error("lance depois do fim deveria ser recusado")
+	}
+
+	settled, _ := apply(sharedRaft.CommandSettleAuctions, sharedRaft.SettleAuctionsPayload{Now: time.Unix(300, 0)}).([]shared.Auction)
+	if len(settled) != 1 || settled[0].Status != shared.AuctionSold {
+		t.Fatalf("leilão não foi encerrado: %+v", settled)
+	}
+	carol, _ := f.GetUser("carol")
+	if findCard(carol.Cards, "inicial-alice-5") < 0 {
+		t.Error("a carta não foi entregue ao comprador")
+	}
+	if coins("alice") != 130 || coins("carol") != 70 || coins("bob") != 100 {
+		t.Errorf("moedas após o encerramento: alice %d, bob %d, carol %d", coins("alice"), coins("bob"), coins("carol"))
+	}
+	if len(f.Auctions()) != 0 {
+		t.Error("leilão encerrado continua aberto")
+	}
+}
+
+func TestRecordMatchUpdatesElo(t *testing.T) {
+	f := newTestFSM()
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+	}, 1)
+	record := func(index uint64, matchID, result string) {
+		match := shared.MatchRecord{MatchID: matchID, Player1: "alice", Player2: "bob", Result: result, At: time.Unix(100, 0)}
+		if err, ok := f.Apply(&raft.Log{Index: index, Data: command(t, sharedRaft.CommandRecordMatch, sharedRaft.RecordMatchPayload{Match: match})}).(error); ok {
+			t.Fatalf("erro ao registrar partida %s: %v", matchID, err)
+		}
+	}
+
+	record(3, "m1", "GANHOU")
+	// a mesma partida reenviada não pode contar duas vezes
+	record(4, "m1", "GANHOU")
+	alice, _ := f.GetProfile("alice")
+	bob, _ := f.GetProfile("bob")
+	if alice.Rating != 1016 || bob.Rating != 984 {
+		t.Errorf("notas esperadas 1016/984, obteve %d/%d", alice.Rating, bob.Rating)
+	}
+	if alice.Wins != 1 || bob.Losses != 1 {
+		t.Errorf("estatísticas incorretas: alice %+v, bob %+v", alice, bob)
+	}
+
+	record(5, "m2", "EMPATE")
+	alice, _ = f.GetProfile("alice")
+	bob, _ = f.GetProfile("bob")
+	if alice.Draws != 1 || bob.Draws != 1 {
+		t.Errorf("empate não contabilizado: alice %+v, bob %+v", alice, bob)
+	}
+	if alice.Rating+bob.Rating != 2*initialRating {
+		t.Errorf("a soma das notas deveria se manter: %d + %d", alice.Rating, bob.Rating)
+	}
+}
+
+func TestRankingIsDeterministic(t *testing.T) {
+	f := newTestFSM()
+	log := [][]byte{}
+	for _, name := range []string{"dave", "carol", "bob", "alice"} {
+		log = append(log, command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: name}))
+	}
+	matches := []shared.MatchRecord{
+		{MatchID: "m1", Player1: "alice", Player2: "bob", Result: "GANHOU"},
+		{MatchID: "m2", Player1: "carol", Player2: "bob", Result: "GANHOU"},
+		{MatchID: "m3", Player1: "carol", Player2: "alice", Result: "GANHOU"},
+	}
+	for _, m := range matches {
+		log = append(log, command(t, sharedRaft.CommandRecordMatch, sharedRaft.RecordMatchPayload{Match: m}))
+	}
+	applyAll(t, f, log, 1)
+
+	names := func(ranking []shared.PlayerProfile) []string {
+		var out []string
+		for _, p := range ranking {
+			out = append(out, p.UserName)
+		}
+		return out
+	}
+	// dave nunca jogou e fica com a nota inicial, à frente de bob
+	byRating := names(f.Ranking(shared.LeaderboardByRating))
+	if want := []string{"carol", "alice", "dave", "bob"}; !reflect.DeepEqual(byRating, want) {
+		t.Errorf("ranking por nota: esperava %v, obteve %v", want, byRating)
+	}
+	byWins := names(f.Ranking(shared.LeaderboardByWins))
+	if want := []string{"carol", "alice", "dave", "bob"}; !reflect.DeepEqual(byWins, want) {
+		t.Errorf("ranking por vitórias: esperava %v, obteve %v", want, byWins)
+	}
+
+	// outro servidor que aplicou o mesmo log monta a mesma ordem
+	replica := newTestFSM()
+	applyAll(t, replica, log, 1)
+	if !reflect.DeepEqual(f.Ranking(shared.LeaderboardByRating), replica.Ranking(shared.LeaderboardByRating)) {
+		t.Error("réplicas com o mesmo log montaram rankings diferentes")
+	}
+}
+
+func TestRoomLifecycle(t *testing.T) {
+	f := newTestFSM()
+	alice := &shared.User{UserName: "alice", UserId: "a"}
+	bob := &shared.User{UserName: "bob", UserId: "b"}
+	finished := shared.GameRoom{ID: "global-1", Player1: alice, Player2: bob, Status: shared.WaitingPlayers, CreatedAt: time.Unix(100, 0)}
+	abandoned := shared.GameRoom{ID: "global-2", Player1: alice, Player2: bob, Status: shared.WaitingPlayers, CreatedAt: time.Unix(100, 0)}
+	recent := shared.GameRoom{ID: "global-3", Player1: alice, Player2: bob, Status: shared.WaitingPlayers, CreatedAt: time.Unix(900, 0)}
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateRoom, finished),
+		command(t, sharedRaft.CommandCreateRoom, abandoned),
+		command(t, sharedRaft.CommandCreateRoom, recent),
+		command(t, sharedRaft.CommandFinishRoom, sharedRaft.FinishRoomPayload{RoomID: "global-1", Winner: alice, At: time.Unix(950, 0)}),
+	}, 1)
+
+	if active := f.ActiveRooms(); len(active) != 2 {
+		t.Fatalf("esperava 2 salas ativas, obteve %d", len(active))
+	}
+	// global-1 terminou há pouco e global-3 ainda está dentro do TTL
+	expired := f.ExpiredRooms(time.Unix(1000, 0), time.Minute, 10*time.Minute)
+	if want := []string{"global-2"}; !reflect.DeepEqual(expired, want) {
+		t.Errorf("esperava %v, obteve %v", want, expired)
+	}
+	expired = f.ExpiredRooms(time.Unix(1100, 0), time.Minute, 10*time.Minute)
+	if want := []string{"global-1", "global-2"}; !reflect.DeepEqual(expired, want) {
+		t.Errorf("esperava %v, obteve %v", want, expired)
+	}
+
+	removed := f.Apply(&raft.Log{Index: 5, Data: command(t, sharedRaft.CommandRemoveRoom, sharedRaft.RemoveRoomPayload{RoomIDs: expired})})
+	if removed != 2 {
+		t.Errorf("esperava 2 salas removidas, obteve %v", removed)
+	}
+	if _, exists := f.GlobalRooms["global-3"]; !exists || len(f.GlobalRooms) != 1 {
+		t.Errorf("apenas global-3 deveria restar, salas: %v", f.GlobalRooms)
+	}
+}
+
+func TestReassignHostResumesRound(t *testing.T) {
+	f := newTestFSM()
+	alice := &shared.User{UserName: "alice", UserId: "a"}
+	bob := &shared.User{UserName: "bob", UserId: "b"}
+	room := shared.GameRoom{ID: "global-1", Player1: alice, Player2: bob, ServerID: 2, Server1ID: 1, Server2ID: 2}
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+		command(t, sharedRaft.CommandCreateRoom, room),
+		command(t, sharedRaft.CommandPlayCard, sharedRaft.PlayCardPayload{RoomID: "global-1", PlayerID: "a", Card: shared.Card{Id: "inicial-alice-1"}}),
+	}, 1)
+	if _, ok := f.Apply(&raft.Log{Index: 5, Data: command(t, sharedRaft.CommandPlayCard, sharedRaft.PlayCardPayload{RoomID: "global-1", PlayerID: "a", Card: shared.Card{Id: "inicial-alice-2"}})}).(error); !ok {
+		t.Error("a segunda jogada do mesmo jogador deveria ser recusada")
+	}
+	f.Apply(&raft.Log{Index: 6, Data: command(t, sharedRaft.CommandPlayCard, sharedRaft.PlayCardPayload{RoomID: "global-1", PlayerID: "b", Card: shared.Card{Id: "inicial-bob-3"}})})
+
+	select {
+	case ready := <-f.ReadyRounds:
+		if ready.ServerID != 2 || len(ready.PlayersCards) != 2 {
+			t.Errorf("rodada incompleta enviada ao host: %+v", ready)
+		}
+	default:
+		t.Fatal("a rodada completa deveria ser enviada ao host")
+	}
+
+	// o host 2 caiu antes de calcular a rodada; um pedido com host desatualizado é ignorado
+	f.Apply(&raft.Log{Index: 7, Data: command(t, sharedRaft.CommandReassignHost, sharedRaft.ReassignHostPayload{RoomID: "global-1", From: 3, To: 1})})
+	f.Apply(&raft.Log{Index: 8, Data: command(t, sharedRaft.CommandReassignHost, sharedRaft.ReassignHostPayload{RoomID: "global-1", From: 2, To: 1})})
+
+	select {
+	case ready := <-f.ReadyRounds:
+		if ready.ServerID != 1 || ready.PlayersCards["a"].Id != "inicial-alice-1" || ready.PlayersCards["b"].Id != "inicial-bob-3" {
+			t.Errorf("o novo host deveria receber as cartas já jogadas: %+v", ready)
+		}
+	default:
+		t.Fatal("o novo host deveria ser avisado da rodada pendente")
+	}
+	if current, _ := f.GetRoom("global-1"); current.ServerID != 1 {
+		t.Errorf("host esperado server1, obteve server%d", current.ServerID)
+	}
+}
+
+func TestBestOfThreeGlobalMatch(t *testing.T) {
+	f := newTestFSM()
+	alice := &shared.User{UserName: "alice", UserId: "a"}
+	bob := &shared.User{UserName: "bob", UserId: "b"}
+	room := shared.GameRoom{ID: "global-1", Player1: alice, Player2: bob, Turn: "a", RoundStarter: "a", BestOf: 3, ServerID: 1}
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+		command(t, sharedRaft.CommandCreateRoom, room),
+	}, 1)
+	index := uint64(3)
+	apply := func(cmdType string, payload interface{}) interface{} {
+		index++
+		return f.Apply(&raft.Log{Index: index, Data: command(t, cmdType, payload)})
+	}
+	cards := map[string]string{"a": "inicial-alice-1", "b": "inicial-bob-2"}
+	playRound := func(round int, resultP1 string) interface{} {
+		// quem começa alterna a cada rodada
+		current, _ := f.GetRoom("global-1")
+		first := current.Turn
+		second := game.Opponent(&current, first).UserId
+		for _, player := range []string{first, second} {
+			if err, ok := apply(sharedRaft.CommandPlayCard, sharedRaft.PlayCardPayload{RoomID: "global-1", PlayerID: player, Card: shared.Card{Id: cards[player]}}).(error); ok {
+				t.Fatalf("rodada %d: jogada de %s recusada: %v", round, player, err)
+			}
+		}
+		return apply(sharedRaft.CommandFinishRound, sharedRaft.FinishRoundPayload{RoomID: "global-1", Round: round, ResultP1: resultP1, At: time.Unix(500, 0)})
+	}
+
+	first, ok := playRound(1, "GANHOU").(shared.GameRoom)
+	if !ok || first.Score1 != 1 || first.Status == shared.Finished {
+		t.Fatalf("rodada 1 não contada corretamente: %+v", first)
+	}
+	if first.Turn != "b" || len(first.PlayersCards) != 0 {
+		t.Errorf("a próxima rodada deveria começar com bob e sem cartas: turno %s, cartas %v", first.Turn, first.PlayersCards)
+	}
+	// a mesma rodada enviada de novo (host anterior) não conta duas vezes
+	if again := apply(sharedRaft.CommandFinishRound, sharedRaft.FinishRoundPayload{RoomID: "global-1", Round: 1, ResultP1: "GANHOU"}); again != nil {
+		t.Errorf("rodada repetida deveria ser ignorada, obteve %v", again)
+	}
+
+	playRound(2, "EMPATE")
+	final, ok := playRound(3, "GANHOU").(shared.GameRoom)
+	if !ok || final.Status != shared.Finished || final.Score1 != 2 || final.Score2 != 0 {
+		t.Fatalf("a partida deveria terminar 2 x 0: %+v", final)
+	}
+	if final.Winner == nil || final.Winner.UserName != "alice" || !final.FinishedAt.Equal(time.Unix(500, 0)) {
+		t.Errorf("vencedor ou fim da partida incorretos: %+v", final)
+	}
+	if _, ok := apply(sharedRaft.CommandPlayCard, sharedRaft.PlayCardPayload{RoomID: "global-1", PlayerID: "a", Card: shared.Card{Id: "inicial-alice-1"}}).(error); !ok {
+		t.Error("jogadas depois do fim da partida deveriam ser recusadas")
+	}
+}
+
+func TestChangeDeckValidation(t *testing.T) {
+	f := newTestFSM()
+	applyAll(t, f, [][]byte{command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"})}, 1)
+	index := uint64(1)
+	changeDeck := func(ids ...string) interface{} {
+		var deck []shared.Card
+		for _, id := range ids {
+			// elemento e tipo enviados pelo cliente são ignorados
+			deck = append(deck, shared.Card{Id: id, Element: "FOGO", Type: "DRAGÃO"})
+		}
+		index++
+		return f.Apply(&raft.Log{Index: index, Data: command(t, sharedRaft.CommandChangeDeck, sharedRaft.ChangeDeckPayload{UserName: "alice", Deck: deck})})
+	}
+
+	cases := []struct {
+		name string
+		ids  []string
+	}{
+		{"tamanho errado", []string{"inicial-alice-1", "inicial-alice-2"}},
+		{"carta repetida", []string{"inicial-alice-1", "inicial-alice-1", "inicial-alice-2", "inicial-alice-3"}},
+		{"carta de outro jogador", []string{"inicial-alice-1", "inicial-alice-2", "inicial-alice-3", "inicial-bob-4"}},
+	}
+	for _, c := range cases {
+		if _, ok := changeDeck(c.ids...).(error); !ok {
+			t.Errorf("%s: deck deveria ser recusado", c.name)
+		}
+	}
+	if alice, _ := f.GetUser("alice"); alice.Deck[0].Id != "inicial-alice-1" {
+		t.Errorf("deck recusado não deveria alterar o deck atual: %v", alice.Deck)
+	}
+
+	if err, ok := changeDeck("inicial-alice-5", "inicial-alice-4", "inicial-alice-3", "inicial-alice-2").(error); ok {
+		t.Fatalf("deck válido recusado: %v", err)
+	}
+	alice, _ := f.GetUser("alice")
+	if alice.Deck[0].Id != "inicial-alice-5" || alice.Deck[0].Element != "MATO" || alice.Deck[0].Type != "NORMAL" {
+		t.Errorf("o deck deveria usar as cartas do inventário: %+v", alice.Deck[0])
+	}
+}
+
+func TestPlayCardIsServerAuthoritative(t *testing.T) {
+	f := newTestFSM()
+	alice := &shared.User{UserName: "alice", UserId: "a"}
+	bob := &shared.User{UserName: "bob", UserId: "b"}
+	room := shared.GameRoom{ID: "global-1", Player1: alice, Player2: bob, BestOf: 3, ServerID: 1}
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "carol"}),
+		command(t, sharedRaft.CommandCreateRoom, room),
+	}, 1)
+	index := uint64(4)
+	play := func(playerID string, card shared.Card) interface{} {
+		index++
+		return f.Apply(&raft.Log{Index: index, Data: command(t, sharedRaft.CommandPlayCard, sharedRaft.PlayCardPayload{RoomID: "global-1", PlayerID: playerID, Card: card})})
+	}
+
+	// MATO (inicial-alice-5) está no inventário, mas não no deck inicial
+	if _, ok := play("a", shared.Card{Id: "inicial-alice-5"}).(error); !ok {
+		t.Error("carta fora do deck deveria ser recusada")
+	}
+	if _, ok := play("a", shared.Card{Id: "inicial-bob-1"}).(error); !ok {
+		t.Error("carta de outro jogador deveria ser recusada")
+	}
+	if _, ok := play("c", shared.Card{Id: "inicial-carol-1"}).(error); !ok {
+		t.Error("jogada de quem não está na sala deveria ser recusada")
+	}
+
+	// o cliente tenta mudar o elemento; vale o que está no deck
+	if err, ok := play("a", shared.Card{Id: "inicial-alice-1", Element: "FOGO", Type: "DRAGÃO"}).(error); ok {
+		t.Fatalf("jogada válida recusada: %v", err)
+	}
+	current, _ := f.GetRoom("global-1")
+	if card := current.PlayersCards["a"]; card.Element != "AGUA" || card.Type != "NORMAL" {
+		t.Errorf("a carta registrada deveria ser a do deck, obteve %+v", card)
+	}
+}
+
+func TestCommitRevealHidesCardsUntilBothPlayed(t *testing.T) {
+	f := newTestFSM()
+	alice := &shared.User{UserName: "alice", UserId: "a"}
+	bob := &shared.User{UserName: "bob", UserId: "b"}
+	room := shared.GameRoom{ID: "global-1", Player1: alice, Player2: bob, BestOf: 3, ServerID: 1}
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+		command(t, sharedRaft.CommandCreateRoom, room),
+	}, 1)
+	index := uint64(3)
+	apply := func(cmdType string, payload interface{}) interface{} {
+		index++
+		return f.Apply(&raft.Log{Index: index, Data: command(t, cmdType, payload)})
+	}
+	commit := func(playerID, cardID, nonce string) interface{} {
+		return apply(sharedRaft.CommandCommitPlay, sharedRaft.CommitPlayPayload{RoomID: "global-1", PlayerID: playerID, Commitment: shared.CommitCard(cardID, nonce)})
+	}
+	reveal := func(playerID, cardID, nonce string) interface{} {
+		return apply(sharedRaft.CommandRevealPlay, sharedRaft.RevealPlayPayload{RoomID: "global-1", PlayerID: playerID, CardID: cardID, Nonce: nonce})
+	}
+
+	if err, ok := commit("a", "inicial-alice-1", "n1").(error); ok {
+		t.Fatalf("compromisso recusado: %v", err)
+	}
+	if _, ok := commit("a", "inicial-alice-2", "n2").(error); !ok {
+		t.Error("o segundo compromisso na mesma rodada deveria ser recusado")
+	}
+	if _, ok := reveal("a", "inicial-alice-1", "n1").(error); !ok {
+		t.Error("a revelação antes do adversário jogar deveria ser recusada")
+	}
+	current, _ := f.GetRoom("global-1")
+	if len(current.PlayersCards) != 0 {
+		t.Errorf("nenhuma carta deveria estar visível antes dos dois jogarem: %v", current.PlayersCards)
+	}
+
+	commit("b", "inicial-bob-3", "n3")
+	if _, ok := reveal("a", "inicial-alice-2", "n1").(error); !ok {
+		t.Error("carta diferente da comprometida deveria ser recusada")
+	}
+	if _, ok := reveal("a", "inicial-alice-1", "outro").(error); !ok {
+		t.Error("nonce diferente do comprometido deveria ser recusado")
+	}
+	if err, ok := reveal("a", "inicial-alice-1", "n1").(error); ok {
+		t.Fatalf("revelação válida recusada: %v", err)
+	}
+	reveal("b", "inicial-bob-3", "n3")
+
+	select {
+	case ready := <-f.ReadyRounds:
+		if ready.PlayersCards["a"].Element != "AGUA" || ready.PlayersCards["b"].Id != "inicial-bob-3" {
+			t.Errorf("cartas reveladas incorretas: %v", ready.PlayersCards)
+		}
+	default:
+		t.Fatal("a rodada revelada deveria ser enviada ao host")
+	}
+
+	finished, ok := apply(sharedRaft.CommandFinishRound, sharedRaft.FinishRoundPayload{RoomID: "global-1", Round: 1, ResultP1: "GANHOU"}).(shared.GameRoom)
+	if !ok || len(finished.Commitments) != 0 || len(finished.PlayersCards) != 0 {
+		t.Fatalf("a próxima rodada deveria começar sem jogadas: %+v", finished)
+	}
+	if finished.LastRound["a"].Id != "inicial-alice-1" || finished.LastRound["b"].Id != "inicial-bob-3" {
+		t.Errorf("o resultado deveria mostrar as cartas da rodada: %v", finished.LastRound)
+	}
+}
+
+func TestTurnOrderAndTimeout(t *testing.T) {
+	f := newTestFSM()
+	alice := &shared.User{UserName: "alice", UserId: "a"}
+	bob := &shared.User{UserName: "bob", UserId: "b"}
+	start := time.Unix(1000, 0)
+	room := shared.GameRoom{ID: "global-1", Player1: alice, Player2: bob, Turn: "a", RoundStarter: "a", BestOf: 3, ServerID: 1, CreatedAt: start, TurnStartedAt: start}
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice"}),
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+		command(t, sharedRaft.CommandCreateRoom, room),
+	}, 1)
+	index := uint64(3)
+	apply := func(cmdType string, payload interface{}) interface{} {
+		index++
+		return f.Apply(&raft.Log{Index: index, Data: command(t, cmdType, payload)})
+	}
+	commit := func(playerID string, at time.Time) interface{} {
+		return apply(sharedRaft.CommandCommitPlay, sharedRaft.CommitPlayPayload{RoomID: "global-1", PlayerID: playerID, Commitment: "hash-" + playerID, At: at})
+	}
+	forfeit := func(playerID string, at time.Time) interface{} {
+		return apply(sharedRaft.CommandForfeitMatch, sharedRaft.ForfeitMatchPayload{RoomID: "global-1", PlayerID: playerID, Reason: shared.EndTurnTimeout, At: at})
+	}
+
+	if _, ok := commit("b", start).(error); !ok {
+		t.Error("jogada fora da vez deveria ser recusada")
+	}
+	if err, ok := commit("a", start.Add(10*time.Second)).(error); ok {
+		t.Fatalf("jogada na vez recusada: %v", err)
+	}
+	if _, ok := commit("a", start.Add(11*time.Second)).(error); !ok {
+		t.Error("a segunda jogada seguida deveria ser recusada")
+	}
+
+	// a vez de bob começou em 10s: o pedido de encerramento chega cedo demais
+	// ou aponta o jogador errado, e é ignorado
+	early := start.Add(10*time.Second + shared.TurnTimeout)
+	if resp := forfeit("b", early); resp != nil {
+		t.Errorf("a vez ainda não expirou, obteve %v", resp)
+	}
+	late := early.Add(time.Second)
+	if resp := forfeit("a", late); resp != nil {
+		t.Errorf("alice já jogou e não pode perder por tempo, obteve %v", resp)
+	}
+
+	finished, ok := forfeit("b", late).(shared.GameRoom)
+	if !ok || finished.Status != shared.Finished || finished.Winner == nil || finished.Winner.UserId != "a" {
+		t.Fatalf("bob deveria perder por tempo: %+v", finished)
+	}
+	if finished.EndReason != shared.EndTurnTimeout || !finished.FinishedAt.Equal(late) || game.WinnerResult(&finished) != "GANHOU" {
+		t.Errorf("fim da partida incorreto: %+v", finished)
+	}
+	if resp := forfeit("b", late.Add(time.Second)); resp != nil {
+		t.Errorf("a partida já terminou, o segundo pedido deveria ser ignorado: %v", resp)
+	}
+}
+
+func TestSurrenderAwardsOpponent(t *testing.T) {
+	f := newTestFSM()
+	alice := &shared.User{UserName: "alice", UserId: "a"}
+	bob := &shared.User{UserName: "bob", UserId: "b"}
+	room := shared.GameRoom{ID: "global-1", Player1: alice, Player2: bob, Turn: "a", BestOf: 3, ServerID: 1, Score1: 1}
+	applyAll(t, f, [][]byte{command(t, sharedRaft.CommandCreateRoom, room)}, 1)
+	surrender := func(index uint64, playerID string) interface{} {
+		return f.Apply(&raft.Log{Index: index, Data: command(t, sharedRaft.CommandForfeitMatch, sharedRaft.ForfeitMatchPayload{RoomID: "global-1", PlayerID: playerID, Reason: shared.EndSurrender, At: time.Unix(42, 0)})})
+	}
+
+	if _, ok := surrender(2, "c").(error); !ok {
+		t.Error("quem não está na sala não pode desistir dela")
+	}
+	// alice estava ganhando, mas desistiu
+	finished, ok := surrender(3, "a").(shared.GameRoom)
+	if !ok || finished.Winner == nil || finished.Winner.UserId != "b" || game.WinnerResult(&finished) != "PERDEU" {
+		t.Fatalf("bob deveria vencer pela desistência: %+v", finished)
+	}
+	if finished.EndReason != shared.EndSurrender || finished.Status != shared.Finished {
+		t.Errorf("fim da partida incorreto: %+v", finished)
+	}
+	if resp := surrender(4, "b"); resp != nil {
+		t.Errorf("desistir de partida terminada deveria ser ignorado: %v", resp)
+	}
+}
+
+func TestDisconnectPausesTurnTimer(t *testing.T) {
+	f := newTestFSM()
+	alice := &shared.User{UserName: "alice", UserId: "a"}
+	bob := &shared.User{UserName: "bob", UserId: "b"}
+	start := time.Unix(1000, 0)
+	room := shared.GameRoom{ID: "global-1", Player1: alice, Player2: bob, Turn: "a", BestOf: 3, ServerID: 1, CreatedAt: start, TurnStartedAt: start}
+	applyAll(t, f, [][]byte{command(t, sharedRaft.CommandCreateRoom, room)}, 1)
+	index := uint64(1)
+	apply := func(cmdType string, payload interface{}) interface{} {
+		index++
+		return f.Apply(&raft.Log{Index: index, Data: command(t, cmdType, payload)})
+	}
+	deadline := start.Add(20 * time.Second)
+
+	paused, ok := apply(sharedRaft.CommandPauseRoom, sharedRaft.PauseRoomPayload{RoomID: "global-1", PlayerID: "a", ReconnectBy: deadline}).(shared.GameRoom)
+	if !ok || paused.PausedFor != "a" {
+		t.Fatalf("a sala deveria ficar pausada para alice: %+v", paused)
+	}
+	if resp := apply(sharedRaft.CommandPauseRoom, sharedRaft.PauseRoomPayload{RoomID: "global-1", PlayerID: "b", ReconnectBy: deadline}); resp != nil {
+		t.Errorf("a sala já está pausada, obteve %v", resp)
+	}
+	// pausada, a vez não expira
+	if _, expired := game.TimedOut(&paused, start.Add(time.Hour), shared.TurnTimeout); expired {
+		t.Error("o tempo da vez não deveria correr com a sala pausada")
+	}
+
+	// alice volta a tempo: a vez recomeça a contar
+	back := start.Add(10 * time.Second)
+	resumed, ok := apply(sharedRaft.CommandResumeRoom, sharedRaft.ResumeRoomPayload{RoomID: "global-1", PlayerID: "a", At: back}).(shared.GameRoom)
+	if !ok || resumed.PausedFor != "" || !resumed.TurnStartedAt.Equal(back) {
+		t.Fatalf("a partida deveria continuar: %+v", resumed)
+	}
+
+	// alice cai de novo e não volta
+	apply(sharedRaft.CommandPauseRoom, sharedRaft.PauseRoomPayload{RoomID: "global-1", PlayerID: "a", ReconnectBy: deadline.Add(time.Minute)})
+	forfeit := func(at time.Time) interface{} {
+		return apply(sharedRaft.CommandForfeitMatch, sharedRaft.ForfeitMatchPayload{RoomID: "global-1", PlayerID: "a", Reason: shared.EndDisconnect, At: at})
+	}
+	if resp := forfeit(deadline); resp != nil {
+		t.Errorf("o prazo de reconexão ainda não acabou, obteve %v", resp)
+	}
+	finished, ok := forfeit(deadline.Add(2 * time.Minute)).(shared.GameRoom)
+	if !ok || finished.Winner == nil || finished.Winner.UserId != "b" || finished.EndReason != shared.EndDisconnect {
+		t.Fatalf("bob deveria vencer porque alice não voltou: %+v", finished)
+	}
+}
+
+func TestCreateUserCredentials(t *testing.T) {
+	f := newTestFSM()
+	first := sharedRaft.Credential{Salt: "sal1", Hash: "hash1"}
+	applyAll(t, f, [][]byte{
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice", Credential: first}),
+		// o mesmo cadastro repetido (outro servidor, nova tentativa) não muda nada
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "alice", Credential: first}),
+		// conta de log antigo, sem senha
+		command(t, sharedRaft.CommandCreateUser, sharedRaft.CreateUserPayload{UserName: "bob"}),
+	}, 1)
+
+	other := sharedRaft.CreateUserPayload{UserName: "alice", Credential: sharedRaft.Credential{Salt: "sal2", Hash: "hash2"}}
+	if err, _ := f.Apply(&raft.Log{Index: 4, Data: command(t, sharedRaft.CommandCreateUser, other)}).(error); !sharedRaft.IsUserExists(err) {
+		t.Errorf("outra senha para um nome já cadastrado deveria ser recusada: %v", err)
+	}
+	if credential, _ := f.GetCredential("alice"); credential != first {
+		t.Errorf("a senha de alice não deveria mudar: %+v", credential)
+	}
+	if alice, _ := f.GetUser("alice"); alice.Password != "" {
+		t.Errorf("a conta não deveria guardar a senha: %+v", alice)
+	}
+
+	if _, exists := f.GetCredential("bob"); exists {
+		t.Fatal("conta sem senha não deveria ter credencial")
+	}
+	// nem o cadastro nem o login tomam uma conta existente, mesmo sem senha
+	claim := sharedRaft.CreateUserPayload{UserName: "bob", Credential: sharedRaft.Credential{Salt: "sal4", Hash: "hash4"}}
+	if err, _ := f.Apply(&raft.Log{Index: 5, Data: command(t, sharedRaft.CommandCreateUser, claim)}).(error); !sharedRaft.IsUserExists(err) {
+		t.Errorf("senha nova para uma conta existente deveria ser recusada: %v", err)
+	}
+	if _, exists := f.GetCredential("bob"); exists {
+		t.Fatal("o CREATE_USER não deveria definir a senha de uma conta antiga")
+	}
+
+	// a senha de contas antigas vem da administração
+	second := sharedRaft.Credential{Salt: "sal3", Hash: "hash3"}
+	applyAll(t, f, [][]byte{command(t, sharedRaft.CommandSetPassword, sharedRaft.SetPasswordPayload{UserName: "bob", Credential: second})}, 6)
+	if credential, _ := f.GetCredential("bob"); credential != second {
+		t.Errorf("a administração deveria definir a senha de bob: %+v", credential)
+	}
+	missing := sharedRaft.SetPasswordPayload{UserName: "carol", Credential: second}
+	if _, ok := f.Apply(&raft.Log{Index: 7, Data: command(t, sharedRaft.CommandSetPassword, missing)}).(error); !ok {
+		t.Error("senha para uma conta inexistente deveria ser recusada")
+	}
+}
@@ -2,7 +2,9 @@ package game
 
 import (
 	"fmt"
+	"log"
 	"sync"
+	"time"
 	"math/big"
 	"crypto/rand"
 	"encoding/json"
@@ -28,6 +30,7 @@ func CreateRoom(player1, player2 *shared.User, nc *nats.Conn, serverID int) *sha
         turn = player2.UserId
     }
 
+    now := time.Now()
     room := &shared.GameRoom{
         ID:      roomID,
         Player1: player1,
@@ -35,6 +38,10 @@ func CreateRoom(player1, player2 *shared.User, nc *nats.Conn, serverID int) *sha
         Turn:    turn,
         Status:  shared.InProgress,
         ServerID: serverID,
+        CreatedAt: now,
+        BestOf: BestOf,
+        RoundStarter: turn,
+        TurnStartedAt: now,
     }
 
     GameRoomsMu.Lock()
@@ -46,6 +53,40 @@ func CreateRoom(player1, player2 *shared.User, nc *nats.Conn, serverID int) *sha
     return room
 }
 
+// a sala pode ser apagada quando terminou há mais de finishedRetention,
+// ou quando foi abandonada sem terminar por mais de abandonedTTL
+func RoomExpired(room *shared.GameRoom, now time.Time, finishedRetention, abandonedTTL time.Duration) bool {
+    if room.Status == shared.Finished {
+        return now.Sub(room.FinishedAt) > finishedRetention
+    }
+    return now.Sub(room.CreatedAt) > abandonedTTL
+}
+
+// marca a sala local como terminada. Deve ser chamada com GameRoomsMu travado
+func FinishRoom(room *shared.GameRoom, winner *shared.User) {
+    room.Status = shared.Finished
+    room.Winner = winner
+    room.FinishedAt = time.Now()
+}
+
+// apaga as salas locais terminadas ou abandonadas e retorna quantas foram removidas
+func CollectRooms(now time.Time, finishedRetention, abandonedTTL time.Duration) int {
+    GameRoomsMu.Lock()
+    defer GameRoomsMu.Unlock()
+
+    removed := 0
+    for id, room := range GameRooms {
+        if RoomExpired(room, now, finishedRetention, abandonedTTL) {
+            delete(GameRooms, id)
+            removed++
+        }
+    }
+    if removed > 0 {
+        log.Printf("[Salas] %d sala(s) local(is) removida(s)", removed)
+    }
+    return removed
+}
+
 //Notificar a vez 
 func SendTurnNotification(nc *nats.Conn, room *shared.GameRoom) {
     for _, player := range []*shared.User{room.Player1, room.Player2} {
@@ -59,3 +100,73 @@ func SendTurnNotification(nc *nats.Conn, room *shared.GameRoom) {
         nc.Publish(topic, data)
     }
 }
+
+// cópia das salas locais que ainda não terminaram
+func ActiveRooms() []shared.GameRoom {
+    GameRoomsMu.RLock()
+    defer GameRoomsMu.RUnlock()
+
+    rooms := make([]shared.GameRoom, 0, len(GameRooms))
+    for _, room := range GameRooms {
+        if room.Status != shared.Finished {
+            rooms = append(rooms, *CopyRoom(room))
+        }
+    }
+    return rooms
+}
+
+// cópia da sala que não compartilha mapas nem jogadores com o original.
+// Deve ser feita com a sala travada; a cópia pode ser lida sem trava
+func CopyRoom(room *shared.GameRoom) *shared.GameRoom {
+    roomCopy := *room
+    roomCopy.Player1 = copyPlayer(room.Player1)
+    roomCopy.Player2 = copyPlayer(room.Player2)
+    roomCopy.Winner = copyPlayer(room.Winner)
+    if room.PlayersCards != nil {
+        roomCopy.PlayersCards = make(map[string]shared.Card, len(room.PlayersCards))
+        for k, v := range room.PlayersCards {
+            roomCopy.PlayersCards[k] = v
+        }
+    }
+    if room.Commitments != nil {
+        roomCopy.Commitments = make(map[string]string, len(room.Commitments))
+        for k, v := range room.Commitments {
+            roomCopy.Commitments[k] = v
+        }
+    }
+    if room.LastRound != nil {
+        roomCopy.LastRound = make(map[string]shared.Card, len(room.LastRound))
+        for k, v := range room.LastRound {
+            roomCopy.LastRound[k] = v
+        }
+    }
+    return &roomCopy
+}
+
+// cópia da sala como viewerID pode vê-la: das jogadas da rodada em andamento
+// (PlayersCards e Commitments) só ficam as dele, para a carta do adversário não
+// vazar antes do resultado da rodada
+func RoomView(room *shared.GameRoom, viewerID string) *shared.GameRoom {
+    view := CopyRoom(room)
+    for playerID := range view.PlayersCards {
+        if playerID != viewerID {
+            delete(view.PlayersCards, playerID)
+        }
+    }
+    for playerID := range view.Commitments {
+        if playerID != viewerID {
+            delete(view.Commitments, playerID)
+        }
+    }
+    return view
+}
+
+func copyPlayer(player *shared.User) *shared.User {
+    if player == nil {
+        return nil
+    }
+    playerCopy := *player
+    playerCopy.Cards = append([]shared.Card(nil), player.Cards...)
+    playerCopy.Deck = append([]shared.Card(nil), player.Deck...)
+    return &playerCopy
+}
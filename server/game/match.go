@@ -0,0 +1,237 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"pbl/shared"
+)
+
+// número de rodadas das partidas criadas por este servidor (melhor de 3 ou de 5)
+var BestOf = 3
+
+// lê o formato da partida (variável MATCH_BEST_OF); vazio mantém o padrão
+func SetBestOf(value string) error {
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || (n != 3 && n != 5) {
+		return fmt.Errorf("MATCH_BEST_OF deve ser 3 ou 5, recebido %q", value)
+	}
+	BestOf = n
+	return nil
+}
+
+// vitórias necessárias para ganhar a partida. Salas antigas (sem BestOf) têm uma rodada só
+func WinsNeeded(bestOf int) int {
+	if bestOf < 1 {
+		bestOf = 1
+	}
+	return bestOf/2 + 1
+}
+
+// conta o resultado da rodada (do ponto de vista do player1) e prepara a próxima,
+// alternando quem começa. Retorna true quando a partida terminou
+func ApplyRound(room *shared.GameRoom, resultP1 string) bool {
+	room.Round++
+	switch resultP1 {
+	case "GANHOU":
+		room.Score1++
+	case "PERDEU":
+		room.Score2++
+	}
+	room.LastRound = room.PlayersCards
+	room.PlayersCards = make(map[string]shared.Card)
+	room.Commitments = nil
+
+	needed := WinsNeeded(room.BestOf)
+	if room.Score1 >= needed || room.Score2 >= needed || room.Round >= needed*2-1 {
+		return true
+	}
+
+	if room.RoundStarter == "" {
+		room.RoundStarter = room.Turn
+	}
+	if room.RoundStarter == room.Player1.UserId {
+		room.RoundStarter = room.Player2.UserId
+	} else {
+		room.RoundStarter = room.Player1.UserId
+	}
+	room.Turn = room.RoundStarter
+	return false
+}
+
+// jogador da sala com o ID informado, ou nil se ele não está na sala
+func RoomPlayer(room *shared.GameRoom, playerID string) *shared.User {
+	for _, player := range []*shared.User{room.Player1, room.Player2} {
+		if player != nil && player.UserId == playerID {
+			return player
+		}
+	}
+	return nil
+}
+
+// adversário do jogador na sala, ou nil se ele não está na sala
+func Opponent(room *shared.GameRoom, playerID string) *shared.User {
+	switch {
+	case room.Player1 != nil && room.Player1.UserId == playerID:
+		return room.Player2
+	case room.Player2 != nil && room.Player2.UserId == playerID:
+		return room.Player1
+	}
+	return nil
+}
+
+// passa a vez para o adversário de quem acabou de jogar e reinicia o tempo da vez
+func AdvanceTurn(room *shared.GameRoom, playerID string, at time.Time) {
+	if opponent := Opponent(room, playerID); opponent != nil {
+		room.Turn = opponent.UserId
+	}
+	room.TurnStartedAt = at
+}
+
+// jogador que deixou a vez expirar. Com as duas jogadas registradas numa sala
+// global, é quem não revelou a carta; vazio se nenhum dos dois revelou
+func TimedOut(room *shared.GameRoom, now time.Time, timeout time.Duration) (string, bool) {
+	// com a partida pausada o tempo da vez não corre
+	if room.Status == shared.Finished || room.PausedFor != "" {
+		return "", false
+	}
+	started := room.TurnStartedAt
+	if started.IsZero() {
+		started = room.CreatedAt
+	}
+	if now.Sub(started) <= timeout {
+		return "", false
+	}
+
+	if len(room.Commitments) < 2 {
+		return room.Turn, true
+	}
+	var missing []string
+	for _, player := range []*shared.User{room.Player1, room.Player2} {
+		if _, revealed := room.PlayersCards[player.UserId]; !revealed {
+			missing = append(missing, player.UserId)
+		}
+	}
+	if len(missing) == 1 {
+		return missing[0], true
+	}
+	return "", true
+}
+
+// encerra a partida com a derrota de loserID (empate se vazio)
+func Forfeit(room *shared.GameRoom, loserID string, reason string, at time.Time) {
+	room.Status = shared.Finished
+	room.Winner = Opponent(room, loserID)
+	room.EndReason = reason
+	room.FinishedAt = at
+}
+
+// resultado do ponto de vista do player1 a partir do vencedor gravado na sala
+func WinnerResult(room *shared.GameRoom) string {
+	switch {
+	case room.Winner == nil:
+		return "EMPATE"
+	case room.Player1 != nil && room.Winner.UserId == room.Player1.UserId:
+		return "GANHOU"
+	}
+	return "PERDEU"
+}
+
+// confere a jogada: o jogador precisa estar na sala, a partida em andamento, a rodada
+// sem carta dele, ser a vez dele e a carta no deck registrado no servidor. Retorna a carta como está no deck
+func ValidatePlay(room *shared.GameRoom, playerID string, deck []shared.Card, cardID string) (shared.Card, *shared.PlayRejection) {
+	if rejection := validatePlayer(room, playerID); rejection != nil {
+		return shared.Card{}, rejection
+	}
+	if _, played := room.PlayersCards[playerID]; played {
+		return shared.Card{}, alreadyPlayed()
+	}
+	if rejection := checkTurn(room, playerID); rejection != nil {
+		return shared.Card{}, rejection
+	}
+	return deckCard(deck, cardID)
+}
+
+// confere o compromisso de uma jogada global: cada jogador se compromete uma vez por rodada
+func ValidateCommit(room *shared.GameRoom, playerID string) *shared.PlayRejection {
+	if rejection := validatePlayer(room, playerID); rejection != nil {
+		return rejection
+	}
+	if _, committed := room.Commitments[playerID]; committed {
+		return alreadyPlayed()
+	}
+	return checkTurn(room, playerID)
+}
+
+// confere a revelação: precisa haver compromisso, o hash tem que bater e a carta estar no deck
+func ValidateReveal(room *shared.GameRoom, playerID string, deck []shared.Card, reveal shared.PlayReveal) (shared.Card, *shared.PlayRejection) {
+	if rejection := validatePlayer(room, playerID); rejection != nil {
+		return shared.Card{}, rejection
+	}
+	commitment, committed := room.Commitments[playerID]
+	if !committed {
+		return shared.Card{}, &shared.PlayRejection{Code: shared.PlayNotCommitted, Message: "nenhuma jogada registrada nesta rodada"}
+	}
+	if _, played := room.PlayersCards[playerID]; played {
+		return shared.Card{}, alreadyPlayed()
+	}
+	// revelar antes do adversário se comprometer entregaria a carta a ele
+	if len(room.Commitments) < 2 {
+		return shared.Card{}, &shared.PlayRejection{Code: shared.PlayOpponentPending, Message: "o adversário ainda não jogou"}
+	}
+	if shared.CommitCard(reveal.CardID, reveal.Nonce) != commitment {
+		return shared.Card{}, &shared.PlayRejection{Code: shared.PlayBadReveal, CardID: reveal.CardID, Message: "a carta revelada não confere com a jogada registrada"}
+	}
+	return deckCard(deck, reveal.CardID)
+}
+
+// só quem está numa partida em andamento pode desistir dela
+func ValidateSurrender(room *shared.GameRoom, playerID string) *shared.PlayRejection {
+	return validatePlayer(room, playerID)
+}
+
+func validatePlayer(room *shared.GameRoom, playerID string) *shared.PlayRejection {
+	if RoomPlayer(room, playerID) == nil {
+		return &shared.PlayRejection{Code: shared.PlayNotInRoom, Message: "você não está nesta sala"}
+	}
+	if room.Status == shared.Finished {
+		return &shared.PlayRejection{Code: shared.PlayMatchFinished, Message: "a partida já terminou"}
+	}
+	return nil
+}
+
+// salas sem Turn (criadas antes da vez ser conferida) aceitam qualquer ordem
+func checkTurn(room *shared.GameRoom, playerID string) *shared.PlayRejection {
+	if room.Turn != "" && room.Turn != playerID {
+		return &shared.PlayRejection{Code: shared.PlayNotYourTurn, Message: "não é a sua vez"}
+	}
+	return nil
+}
+
+func alreadyPlayed() *shared.PlayRejection {
+	return &shared.PlayRejection{Code: shared.PlayAlreadyPlayed, Message: "você já jogou nesta rodada"}
+}
+
+func deckCard(deck []shared.Card, cardID string) (shared.Card, *shared.PlayRejection) {
+	for _, card := range deck {
+		if card.Id == cardID {
+			return card, nil
+		}
+	}
+	return shared.Card{}, &shared.PlayRejection{Code: shared.PlayCardNotInDeck, CardID: cardID, Message: "a carta não está no seu deck"}
+}
+
+// resultado final da partida do ponto de vista do player1
+func MatchResult(room *shared.GameRoom) string {
+	switch {
+	case room.Score1 > room.Score2:
+		return "GANHOU"
+	case room.Score1 < room.Score2:
+		return "PERDEU"
+	}
+	return "EMPATE"
+}
@@ -0,0 +1,55 @@
+package game
+
+import (
+	"fmt"
+	"time"
+
+	"pbl/shared"
+)
+
+// tempo que um jogador que caiu no meio da partida tem para voltar
+var ReconnectGrace = 30 * time.Second
+
+// lê a janela de reconexão (variável RECONNECT_GRACE, ex.: "45s"); vazio mantém o padrão
+func SetReconnectGrace(value string) error {
+	if value == "" {
+		return nil
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace <= 0 {
+		return fmt.Errorf("RECONNECT_GRACE deve ser uma duração positiva (ex.: 45s), recebido %q", value)
+	}
+	ReconnectGrace = grace
+	return nil
+}
+
+// pausa a partida enquanto o jogador tenta voltar. O prazo vem de quem detectou
+// a queda, para que todas as réplicas decidam igual. Retorna false se a sala
+// não pode ser pausada (partida terminada, jogador fora da sala ou já pausada)
+func Pause(room *shared.GameRoom, playerID string, reconnectBy time.Time) bool {
+	if validatePlayer(room, playerID) != nil || room.PausedFor != "" {
+		return false
+	}
+	room.PausedFor = playerID
+	room.ReconnectBy = reconnectBy
+	return true
+}
+
+// o jogador voltou: a partida continua e a vez recomeça a contar
+func Resume(room *shared.GameRoom, playerID string, at time.Time) bool {
+	if room.Status == shared.Finished || room.PausedFor != playerID {
+		return false
+	}
+	room.PausedFor = ""
+	room.ReconnectBy = time.Time{}
+	room.TurnStartedAt = at
+	return true
+}
+
+// jogador que não voltou dentro do prazo e perde a partida
+func ReconnectExpired(room *shared.GameRoom, now time.Time) (string, bool) {
+	if room.Status == shared.Finished || room.PausedFor == "" || !now.After(room.ReconnectBy) {
+		return "", false
+	}
+	return room.PausedFor, true
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"pbl/server/auth"
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+
+	"github.com/hashicorp/raft"
+)
+
+// servidor a ser adicionado ou removido do cluster
+type MembershipRequest struct {
+	ID      string `json:"id"`
+	Address string `json:"address,omitempty"` // endereço Raft/HTTP, ex: "10.0.0.4:8004"
+}
+
+// senha nova para uma conta existente
+type SetPasswordRequest struct {
+	UserName string `json:"username"`
+	Password string `json:"password"`
+}
+
+// estado do cluster retornado por /admin/cluster
+type ClusterInfo struct {
+	LeaderID      string        `json:"leader_id"`
+	LeaderAddress string        `json:"leader_address"`
+	Servers       []raft.Server `json:"servers"`
+}
+
+// redireciona para o líder as requisições de administração que chegam em um seguidor.
+// O 307 faz o cliente repetir o POST com o mesmo corpo e os mesmos cabeçalhos;
+// a assinatura já foi conferida aqui e é conferida de novo no líder
+func redirectToLeader(server *models.Server, w http.ResponseWriter, r *http.Request) bool {
+	if server.Raft.State() == raft.Leader {
+		return false
+	}
+	leaderAddr, _ := server.Raft.LeaderWithID()
+	if leaderAddr == "" {
+		http.Error(w, "Líder não disponível no momento, tente novamente", http.StatusServiceUnavailable)
+		return true
+	}
+	http.Redirect(w, r, fmt.Sprintf("http://%s%s", leaderAddr, r.URL.Path), http.StatusTemporaryRedirect)
+	return true
+}
+
+func decodeMembershipRequest(w http.ResponseWriter, r *http.Request, needAddress bool) (MembershipRequest, bool) {
+	var req MembershipRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return req, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return req, false
+	}
+	if req.ID == "" || (needAddress && req.Address == "") {
+		http.Error(w, "Campos 'id' e 'address' são obrigatórios", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// adiciona um servidor com direito a voto
+func AdminAddVoterHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeMembershipRequest(w, r, true)
+		if !ok || redirectToLeader(server, w, r) {
+			return
+		}
+
+		future := server.Raft.AddVoter(raft.ServerID(req.ID), raft.ServerAddress(req.Address), 0, 10*time.Second)
+		respondMembership(server, w, future, fmt.Sprintf("Servidor %s (%s) adicionado como votante", req.ID, req.Address))
+	}
+}
+
+// adiciona um servidor que recebe o log mas não vota (ex: réplica ainda sincronizando)
+func AdminAddNonvoterHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeMembershipRequest(w, r, true)
+		if !ok || redirectToLeader(server, w, r) {
+			return
+		}
+
+		future := server.Raft.AddNonvoter(raft.ServerID(req.ID), raft.ServerAddress(req.Address), 0, 10*time.Second)
+		respondMembership(server, w, future, fmt.Sprintf("Servidor %s (%s) adicionado como não votante", req.ID, req.Address))
+	}
+}
+
+// remove um servidor do cluster (ex: máquina morta que será substituída)
+func AdminRemoveServerHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeMembershipRequest(w, r, false)
+		if !ok || redirectToLeader(server, w, r) {
+			return
+		}
+
+		future := server.Raft.RemoveServer(raft.ServerID(req.ID), 0, 10*time.Second)
+		respondMembership(server, w, future, fmt.Sprintf("Servidor %s removido do cluster", req.ID))
+	}
+}
+
+// define a senha de uma conta que já existe. É o caminho das contas criadas antes
+// das senhas, que não entram pelo LOGIN. Só o hash vai para o log do Raft
+func AdminSetPasswordHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+			return
+		}
+		var req SetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserName == "" {
+			http.Error(w, "Campos 'username' e 'password' são obrigatórios", http.StatusBadRequest)
+			return
+		}
+		if accountErr := auth.ValidatePassword(req.UserName, req.Password); accountErr != nil {
+			http.Error(w, accountErr.Message, http.StatusBadRequest)
+			return
+		}
+		if redirectToLeader(server, w, r) {
+			return
+		}
+		if _, exists := server.FSM.GetUser(req.UserName); !exists {
+			http.Error(w, fmt.Sprintf("Usuário %s não encontrado", req.UserName), http.StatusNotFound)
+			return
+		}
+
+		salt := auth.NewSalt()
+		payload := sharedRaft.SetPasswordPayload{
+			UserName:   req.UserName,
+			Credential: sharedRaft.Credential{Salt: salt, Hash: auth.HashPassword(req.Password, salt)},
+		}
+		cmd := sharedRaft.Command{Type: sharedRaft.CommandSetPassword, Data: utils.MustMarshal(payload)}
+		if _, err := server.ApplyCommand(cmd); err != nil {
+			log.Printf("[%d] [Admin] Erro ao definir a senha de %s: %v", server.ID, req.UserName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		message := fmt.Sprintf("Senha do usuário %s definida", req.UserName)
+		log.Printf("[%d] [Admin] %s", server.ID, message)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(message))
+	}
+}
+
+// lista os membros atuais do cluster
+func AdminClusterHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		future := server.Raft.GetConfiguration()
+		if err := future.Error(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		leaderAddr, leaderID := server.Raft.LeaderWithID()
+		info := ClusterInfo{
+			LeaderID:      string(leaderID),
+			LeaderAddress: string(leaderAddr),
+			Servers:       future.Configuration().Servers,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+func respondMembership(server *models.Server, w http.ResponseWriter, future raft.IndexFuture, message string) {
+	if err := future.Error(); err != nil {
+		log.Printf("[%d] [Admin] Erro ao alterar membros do cluster: %v", server.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%d] [Admin] %s", server.ID, message)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(message))
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"pbl/server/leadership"
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+	"pbl/shared"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// intervalo em que o líder procura leilões terminados
+	AuctionSettleInterval = 2 * time.Second
+
+	minAuctionDuration = 30 * time.Second
+	maxAuctionDuration = 24 * time.Hour
+)
+
+// leilões abertos e o saldo de moedas do jogador
+func HandleListAuctions(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		respondWithError(nc, msg, "Usuário não está logado.")
+		return
+	}
+
+	account, _ := server.FSM.GetUser(user.UserName)
+	house := shared.AuctionHouse{Auctions: server.FSM.Auctions(), Coins: account.Coins}
+	respondData(server, nc, msg, "LIST_AUCTIONS", house)
+}
+
+func HandleCreateAuction(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		respondWithError(nc, msg, "Usuário não está logado.")
+		return
+	}
+
+	var req shared.CreateAuctionRequest
+	if err := json.Unmarshal(request.Payload, &req); err != nil {
+		respondWithError(nc, msg, "Payload inválido")
+		return
+	}
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	if duration < minAuctionDuration || duration > maxAuctionDuration {
+		respondWithError(nc, msg, "A duração do leilão deve ser entre 30 segundos e 24 horas.")
+		return
+	}
+
+	now := time.Now()
+	auction := shared.Auction{
+		ID:           uuid.New().String(),
+		Seller:       user.UserName,
+		Card:         shared.Card{Id: req.CardID},
+		ReservePrice: req.ReservePrice,
+		CreatedAt:    now,
+		EndsAt:       now.Add(duration),
+	}
+	cmd := sharedRaft.Command{
+		Type: sharedRaft.CommandCreateAuction,
+		Data: utils.MustMarshal(sharedRaft.CreateAuctionPayload{Auction: auction}),
+	}
+	response, err := server.ApplyCommand(cmd)
+	if err != nil {
+		respondWithError(nc, msg, err.Error())
+		return
+	}
+	auction, ok := response.(shared.Auction)
+	if !ok {
+		respondWithError(nc, msg, "Resposta inesperada ao criar o leilão.")
+		return
+	}
+	log.Printf("[%d] Leilão %s criado por %s", server.ID, auction.ID, user.UserName)
+	respondData(server, nc, msg, "CREATE_AUCTION", auction)
+}
+
+func HandleBid(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		respondWithError(nc, msg, "Usuário não está logado.")
+		return
+	}
+
+	var req shared.BidRequest
+	if err := json.Unmarshal(request.Payload, &req); err != nil {
+		respondWithError(nc, msg, "Payload inválido")
+		return
+	}
+
+	payload := sharedRaft.BidPayload{AuctionID: req.AuctionID, UserName: user.UserName, Amount: req.Amount, At: time.Now()}
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandBid, Data: utils.MustMarshal(payload)}
+	response, err := server.ApplyCommand(cmd)
+	if err != nil {
+		respondWithError(nc, msg, err.Error())
+		return
+	}
+	result, ok := response.(sharedRaft.BidResult)
+	if !ok {
+		respondWithError(nc, msg, "Resposta inesperada ao dar o lance.")
+		return
+	}
+
+	if result.Outbid != "" {
+		NotifyUser(server, result.Outbid, shared.Response{
+			Status: "success",
+			Action: "AUCTION_OUTBID",
+			Data:   utils.MustMarshal(result.Auction),
+			Server: server.ID,
+		})
+	}
+	respondData(server, nc, msg, "BID", result.Auction)
+}
+
+// Só no líder: encerra os leilões que terminaram e avisa vendedor e comprador
+func RunAuctionSettler(ctx context.Context, server *models.Server) {
+	leadership.Every(ctx, AuctionSettleInterval, func() {
+		settleAuctions(server)
+	})
+}
+
+func settleAuctions(server *models.Server) {
+	now := time.Now()
+	if !server.FSM.HasExpiredAuctions(now) {
+		return
+	}
+
+	cmd := sharedRaft.Command{
+		Type: sharedRaft.CommandSettleAuctions,
+		Data: utils.MustMarshal(sharedRaft.SettleAuctionsPayload{Now: now}),
+	}
+	response, _, err := server.ApplyLocal(cmd)
+	if err != nil {
+		log.Printf("[%d] Erro ao encerrar leilões: %v", server.ID, err)
+		return
+	}
+	settled, _ := response.([]shared.Auction)
+
+	for _, auction := range settled {
+		notification := shared.Response{
+			Status: "success",
+			Action: "AUCTION_" + auction.Status,
+			Data:   utils.MustMarshal(auction),
+			Server: server.ID,
+		}
+		go NotifyUser(server, auction.Seller, notification)
+		if auction.HighestBidder != "" {
+			notification.Action = "AUCTION_WON"
+			go NotifyUser(server, auction.HighestBidder, notification)
+		}
+	}
+}
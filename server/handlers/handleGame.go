@@ -10,6 +10,8 @@ import (
 
 	"pbl/server/game"
 	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
 	"pbl/shared"
 
 	"github.com/nats-io/nats.go"
@@ -17,15 +19,8 @@ import (
 
 
 func getPeerURLByID(server *models.Server, targetID int) (string, error) {
-	// A lista server.Peers contém os IPs/URLs
-	// que vieram do Makefile
-	for _, peer := range server.Peers {
-		if peer.ID == targetID {
-			// O URL já vem com "http://"
-			return peer.URL, nil
-		}
-	}
-	return "", fmt.Errorf("peer com ID %d não encontrado na lista de peers", targetID)
+	// A lista vem da configuração do Raft, que muda quando servidores entram ou saem
+	return server.PeerURL(targetID)
 }
 
 // HandleGlobalGameMessage processa jogadas de cartas para salas globais
@@ -35,40 +30,87 @@ func HandleGlobalGameMessage(server *models.Server, request shared.Request, nc *
 		log.Println("[Global] Erro ao decodificar GameMessage:", err)
 		return
 	}
+	clientTopic := fmt.Sprintf("server.%d.client.%s", server.ID, request.ClientID)
+
+	user, rejection := playSender(server, request, gameMsg)
+	if rejection != nil {
+		rejectPlay(nc, clientTopic, gameMsg.RoomID, rejection)
+		return
+	}
+
+	switch gameMsg.Type {
+	case "REVEAL_CARD":
+		processClientReveal(server, user, gameMsg, nc)
+	case shared.EndSurrender:
+		processClientSurrender(server, gameMsg, nc)
+	default:
+		processClientCommit(server, gameMsg, nc)
+	}
+}
+
+// confere a jogada na réplica local. A réplica pode estar atrasada em relação
+// ao líder (sala recém-criada, rodada anterior ainda aberta, compromisso ainda
+// não aplicado), então esses casos são tentados de novo antes de recusar
+func validateOnReplica(server *models.Server, roomID string, validate func(room *shared.GameRoom) *shared.PlayRejection) (shared.GameRoom, *shared.PlayRejection) {
+	var room shared.GameRoom
+	var rejection *shared.PlayRejection
 
-	var room *shared.GameRoom
-	var exists bool
-	
 	for i := 0; i < 10; i++ {
-		server.FSM.GlobalRoomsMu.RLock()
-		room, exists = server.FSM.GlobalRooms[gameMsg.RoomID]
-		server.FSM.GlobalRoomsMu.RUnlock()
-		
-		if exists {
-			break
+		var exists bool
+		room, exists = server.FSM.GetRoom(roomID)
+		if !exists {
+			rejection = &shared.PlayRejection{Code: shared.PlayRoomNotFound, Message: "sala não encontrada"}
+		} else {
+			rejection = validate(&room)
+		}
+
+		switch {
+		case rejection == nil:
+			return room, nil
+		case rejection.Code != shared.PlayRoomNotFound && rejection.Code != shared.PlayAlreadyPlayed &&
+			rejection.Code != shared.PlayNotYourTurn && rejection.Code != shared.PlayNotCommitted &&
+			rejection.Code != shared.PlayOpponentPending:
+			return room, rejection
 		}
-		
-		log.Printf("[Global] Sala %s não encontrada (tentativa %d/10). Aguardando replicação...", gameMsg.RoomID, i+1)
+
+		log.Printf("[Global] Sala %s: %s (tentativa %d/10). Aguardando replicação...", roomID, rejection.Code, i+1)
 		time.Sleep(500 * time.Millisecond)
 	}
+	return room, rejection
+}
 
-	if !exists {
-		log.Printf("[Global] Sala %s não encontrada no servidor %d após 10 tentativas", gameMsg.RoomID, server.ID)
+// primeira fase da jogada: o cliente envia só o hash da carta. Nenhum servidor
+// sabe qual carta foi escolhida até os dois jogadores se comprometerem
+func processClientCommit(server *models.Server, gameMsg shared.GameMessage, nc *nats.Conn) {
+	clientTopic := fmt.Sprintf("server.%d.client.%s", server.ID, gameMsg.From)
+
+	var commit shared.PlayCommit
+	if err := json.Unmarshal(gameMsg.Data, &commit); err != nil || commit.Commitment == "" {
+		rejectPlay(nc, clientTopic, gameMsg.RoomID, &shared.PlayRejection{Code: shared.PlayInvalid, Message: "jogada sem o hash da carta"})
 		return
 	}
 
-	// Processa a carta do cliente local
-	processClientCard(server, room, gameMsg, nc)
-}
+	room, rejection := validateOnReplica(server, gameMsg.RoomID, func(room *shared.GameRoom) *shared.PlayRejection {
+		return game.ValidateCommit(room, gameMsg.From)
+	})
+	if rejection != nil {
+		rejectPlay(nc, clientTopic, gameMsg.RoomID, rejection)
+		return
+	}
 
-func processClientCard(server *models.Server, room *shared.GameRoom, gameMsg shared.GameMessage, nc *nats.Conn) {
-	var card shared.Card
-	if err := json.Unmarshal(gameMsg.Data, &card); err != nil {
-		log.Println("[Global] Erro ao decodificar carta:", err)
+	payload := sharedRaft.CommitPlayPayload{RoomID: room.ID, PlayerID: gameMsg.From, Commitment: commit.Commitment, At: time.Now()}
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandCommitPlay, Data: utils.MustMarshal(payload)}
+	if _, err := server.ApplyCommand(cmd); err != nil {
+		log.Printf("[Global] Erro ao registrar jogada de %s na sala %s: %v", gameMsg.From, room.ID, err)
+		rejectPlay(nc, clientTopic, room.ID, &shared.PlayRejection{Code: shared.PlayFailed, Message: err.Error()})
 		return
 	}
 
-	log.Printf("[Global] Cliente %s jogou %s", gameMsg.From, card.Element)
+	log.Printf("[Global] Cliente %s registrou sua jogada na sala %s", gameMsg.From, room.ID)
+
+	// confirma ao cliente, que revela a carta quando o adversário também tiver jogado
+	ack, _ := json.Marshal(shared.GameMessage{Type: "PLAY_COMMITTED", From: "SERVER", RoomID: room.ID})
+	nc.Publish(clientTopic, ack)
 
 	// Determina oponente
 	var opponentID string
@@ -82,12 +124,11 @@ func processClientCard(server *models.Server, room *shared.GameRoom, gameMsg sha
 		opponentServerID = room.Server1ID
 	}
 
-	// Notifica o oponente
+	// Notifica o oponente: só que houve jogada, sem a carta
 	turnMsg := shared.GameMessage{
 		Type:   "PLAY_CARD",
 		From:   gameMsg.From,
 		RoomID: room.ID,
-		Data:   gameMsg.Data,
 		Turn:   opponentID,
 	}
 
@@ -95,55 +136,42 @@ func processClientCard(server *models.Server, room *shared.GameRoom, gameMsg sha
 		sendCardToOpponentServer(server, opponentServerID, opponentID, turnMsg)
 	} else {
 		dataTurn, _ := json.Marshal(turnMsg)
-		clientTopic := fmt.Sprintf("server.%d.client.%s", server.ID, opponentID)
-		nc.Publish(clientTopic, dataTurn)
+		opponentTopic := fmt.Sprintf("server.%d.client.%s", server.ID, opponentID)
+		nc.Publish(opponentTopic, dataTurn)
 		log.Printf("[Global] Oponente local notificado: %s", opponentID)
 	}
-
-	// envia ao HOST
-	if server.ID != room.ServerID {
-		// Não sou o host, encaminho via REST
-		log.Printf("[Global] Encaminhando ao HOST (server%d)...", room.ServerID)
-		forwardCardToHost(server, room.ServerID, gameMsg)
-	} else {
-		// Sou o host, processo localmente
-		log.Printf("[Global] Sou o HOST, processando carta...")
-		processHostCard(server, room, gameMsg, nc)
-	}
 }
 
-// HOST armazena carta e calcula resultado
-func processHostCard(server *models.Server, room *shared.GameRoom, gameMsg shared.GameMessage, nc *nats.Conn) {
-	// ... (código igual) ...
-	if room.PlayersCards == nil {
-		room.PlayersCards = make(map[string]shared.Card)
-	}
+// segunda fase: carta e nonce são conferidos contra o hash registrado.
+// O host calcula o resultado quando as duas cartas forem reveladas
+func processClientReveal(server *models.Server, user shared.User, gameMsg shared.GameMessage, nc *nats.Conn) {
+	clientTopic := fmt.Sprintf("server.%d.client.%s", server.ID, gameMsg.From)
 
-	var card shared.Card
-	if err := json.Unmarshal(gameMsg.Data, &card); err != nil {
-		log.Println("[HOST] Erro ao decodificar carta:", err)
+	var reveal shared.PlayReveal
+	if err := json.Unmarshal(gameMsg.Data, &reveal); err != nil {
+		log.Println("[Global] Erro ao decodificar revelação:", err)
 		return
 	}
 
-	room.PlayersCards[gameMsg.From] = card
-	log.Printf("[HOST] Carta armazenada: %s -> %s (%d/2)", gameMsg.From, card.Element, len(room.PlayersCards))
-	log.Printf("[HOST] Total: %d/2", len(room.PlayersCards))
-
-	if len(room.PlayersCards) == 2 {
-		cardP1 := room.PlayersCards[room.Player1.UserId]
-		cardP2 := room.PlayersCards[room.Player2.UserId]
-
-		log.Printf("[HOST] %s: %s vs %s: %s", room.Player1.UserName, cardP1.Element, room.Player2.UserName, cardP2.Element)
-
-		resultP1 := game.CheckWinner(cardP1, cardP2)
-
-		notifyPlayerResult(server, nc, room, resultP1, room.Player1.UserId, room.Server1ID)
-		notifyPlayerResult(server, nc, room, resultP1, room.Player2.UserId, room.Server2ID)
+	deck := registeredDeck(server, user.UserName)
+	room, rejection := validateOnReplica(server, gameMsg.RoomID, func(room *shared.GameRoom) *shared.PlayRejection {
+		_, rejection := game.ValidateReveal(room, gameMsg.From, deck, reveal)
+		return rejection
+	})
+	if rejection != nil {
+		rejectPlay(nc, clientTopic, gameMsg.RoomID, rejection)
+		return
+	}
 
-		room.PlayersCards = make(map[string]shared.Card)
-		resultP1 = ""
-		log.Printf("[HOST] Rodada finalizada")
+	payload := sharedRaft.RevealPlayPayload{RoomID: room.ID, PlayerID: gameMsg.From, CardID: reveal.CardID, Nonce: reveal.Nonce}
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandRevealPlay, Data: utils.MustMarshal(payload)}
+	if _, err := server.ApplyCommand(cmd); err != nil {
+		log.Printf("[Global] Erro ao revelar jogada de %s na sala %s: %v", gameMsg.From, room.ID, err)
+		rejectPlay(nc, clientTopic, room.ID, &shared.PlayRejection{Code: shared.PlayFailed, CardID: reveal.CardID, Message: err.Error()})
+		return
 	}
+
+	log.Printf("[Global] Cliente %s revelou sua carta na sala %s", gameMsg.From, room.ID)
 }
 
 func sendCardToOpponentServer(server *models.Server, serverID int, clientID string, gameMsg shared.GameMessage) {	
@@ -170,30 +198,6 @@ func sendCardToOpponentServer(server *models.Server, serverID int, clientID stri
 	//log.Printf("[REST] Carta enviada para %s -> cliente %s", peerURL, clientID)
 }
 
-func forwardCardToHost(server *models.Server, hostServerID int, gameMsg shared.GameMessage) {
-	
-	hostURL, err := getPeerURLByID(server, hostServerID)
-	if err != nil {
-		log.Printf("[REST] Erro ao encontrar host peer %d: %v", hostServerID, err)
-		return
-	}
-	url := fmt.Sprintf("%s/forward-to-host", hostURL)
-
-	payload := map[string]interface{}{
-		"game_msg": gameMsg,
-	}
-
-	jsonData, _ := json.Marshal(payload)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("[REST] Erro ao encaminhar ao host %s: %v", url, err)
-		return
-	}
-	defer resp.Body.Close()
-
-	log.Printf("[REST] Carta encaminhada ao HOST %s", hostURL)
-}
-
 // Recebe carta de outro servidor para notificar cliente local
 func HandleForwardCard(server *models.Server, nc *nats.Conn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -223,52 +227,17 @@ func HandleForwardCard(server *models.Server, nc *nats.Conn) http.HandlerFunc {
 	}
 }
 
-// HOST recebe carta de servidor remoto
-func HandleForwardToHost(server *models.Server, nc *nats.Conn) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var payload struct {
-			GameMsg shared.GameMessage `json:"game_msg"`
-		}
-
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, "Invalid payload", http.StatusBadRequest)
-			return
-		}
-
-		log.Printf("[REST-HOST] Carta recebida: sala %s, jogador %s",
-			payload.GameMsg.RoomID, payload.GameMsg.From)
-
-		server.FSM.GlobalRoomsMu.RLock()
-		room, exists := server.FSM.GlobalRooms[payload.GameMsg.RoomID]
-		server.FSM.GlobalRoomsMu.RUnlock()
-
-		if !exists {
-			log.Printf("[REST-HOST] Sala não encontrada")
-			http.Error(w, "Room not found", http.StatusNotFound)
-			return
-		}
-
-		processHostCard(server, room, payload.GameMsg, nc)
-
-		w.WriteHeader(http.StatusOK)
-	}
-}
-
-func notifyPlayerResult(server *models.Server, nc *nats.Conn, room *shared.GameRoom, result string, playerID string, playerServerID int) {
-	var winner *shared.User
-	switch result {
-	case "GANHOU":
-		winner = room.Player1
-	case "PERDEU":
-		winner = room.Player2
-	case "EMPATE":
-		winner = nil
-	}
-
+// envia ROUND_RESULT ou MATCH_RESULT ao jogador, com o placar da sala em Data
+// e, se a partida continua, quem começa a próxima rodada em Turn
+func notifyPlayerResult(server *models.Server, nc *nats.Conn, room *shared.GameRoom, msgType string, result string, playerID string, playerServerID int) {
 	resultMsg := shared.GameMessage{
-		Type:   "ROUND_RESULT",
+		Type:   msgType,
 		RoomID: room.ID,
-		Winner: winner,
+		Winner: roomWinner(room, result),
+		Data:   utils.MustMarshal(room),
+	}
+	if room.Status != shared.Finished {
+		resultMsg.Turn = room.Turn
 	}
 
 	if playerServerID != server.ID {		
@@ -1,7 +1,8 @@
 package handlers
 
 import (
-	"bytes"
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -9,6 +10,8 @@ import (
 	"sync"
 	"time"
 
+	"pbl/server/auth"
+	"pbl/server/cards"
 	"pbl/server/game"
 	"pbl/server/models"
 	sharedRaft "pbl/server/shared"
@@ -17,7 +20,6 @@ import (
 	"pbl/shared"
 
 	"github.com/google/uuid"
-	"github.com/hashicorp/raft"
 	"github.com/nats-io/nats.go"
 )
 
@@ -34,8 +36,9 @@ type ClientInfo struct {
 }
 
 const (
-	heartbeatInterval = 10 * time.Second
-	disconnectTimeout = 30 * time.Second
+	heartbeatInterval = 5 * time.Second
+	// silêncio até o cliente ser considerado caído; no meio de uma partida ele ainda tem game.ReconnectGrace para voltar
+	disconnectTimeout = 15 * time.Second
 )
 
 var (
@@ -83,56 +86,172 @@ func HandleLogin(server *models.Server, request shared.Request, nc *nats.Conn, m
         return
     }
 
-    server.Mu.Lock()
-    defer server.Mu.Unlock()
-
     //Verifica se já existe um usuário com o mesmo nome online
-    for _, existingUser := range server.Users {
-        if existingUser.UserName == user.UserName {
-            log.Printf("[%d] - Tentativa de login duplicado para '%s'", server.ID, user.UserName)
-            resp := shared.Response{
-                Status: "error",
-                Action: "LOGIN_FAIL",
-                Error:  "Usuário já está logado em outro cliente.",
-                Server: server.ID,
-            }
-            data, _ := json.Marshal(resp)
-            nc.Publish(msg.Reply, data)
-            return
+    if isUserOnline(server, user.UserName) {
+        log.Printf("[%d] - Tentativa de login duplicado para '%s'", server.ID, user.UserName)
+        resp := shared.Response{
+            Status: "error",
+            Action: "LOGIN_FAIL",
+            Error:  "Usuário já está logado em outro cliente.",
+            Server: server.ID,
         }
+        data, _ := json.Marshal(resp)
+        nc.Publish(msg.Reply, data)
+        return
     }
 
-    //Insere cartas padrão 
-    user.Cards = []shared.Card{
-        {Id: "1", Element: "AGUA", Type: "NORMAL"},
-        {Id: "2", Element: "TERRA", Type: "NORMAL"},
-        {Id: "3", Element: "FOGO", Type: "NORMAL"},
-        {Id: "4", Element: "AR", Type: "NORMAL"},
-        {Id: "5", Element: "MATO", Type: "NORMAL"},
+    if user.Password == "" {
+        resp := shared.Response{
+            Status: "error",
+            Action: "LOGIN_FAIL",
+            Error:  "Informe a senha.",
+            Server: server.ID,
+        }
+        data, _ := json.Marshal(resp)
+        nc.Publish(msg.Reply, data)
+        return
     }
 
-    user.Deck = []shared.Card{
-        {Id: "1", Element: "AGUA", Type: "NORMAL"},
-        {Id: "2", Element: "TERRA", Type: "NORMAL"},
-        {Id: "3", Element: "FOGO", Type: "NORMAL"},
-        {Id: "4", Element: "AR", Type: "NORMAL"},
+    account, err := loginAccount(server, user.UserName, user.Password)
+    if err != nil {
+        log.Printf("[%d] - Login recusado para '%s': %v", server.ID, user.UserName, err)
+        resp := shared.Response{
+            Status: "error",
+            Action: "LOGIN_FAIL",
+            Error:  "Usuário ou senha inválidos.",
+            Server: server.ID,
+        }
+        data, _ := json.Marshal(resp)
+        nc.Publish(msg.Reply, data)
+        return
     }
+    account.UserId = request.ClientID
+    account.ServerID = server.ID
 
-	user.ServerID = server.ID
     //Armazena o usuário logado
-    server.Users[request.ClientID] = user
+    server.Mu.Lock()
+    server.Users[request.ClientID] = account
+    server.Mu.Unlock()
     log.Printf("[%d] - Usuário '%s' conectado com ClientID '%s'", server.ID, user.UserName, request.ClientID)
 
+    // o token vai só na resposta; a conta guardada na sessão não o carrega
+    account.SessionToken = startSession(request.ClientID, account.UserName, time.Now())
+
     resp := shared.Response{
         Status: "success",
         Action: "LOGIN_SUCCESS",
-        Data:   utils.MustMarshal(user),
+        Data:   utils.MustMarshal(account),
         Server: server.ID,
     }
     data, _ := json.Marshal(resp)
     nc.Publish(msg.Reply, data)
 }
 
+// confere a senha contra o hash replicado. Contas de antes das senhas não entram
+// até a administração definir uma senha para elas (/admin/set-password)
+func loginAccount(server *models.Server, userName, password string) (shared.User, error) {
+    account, exists := server.FSM.GetUser(userName)
+    if !exists {
+        return shared.User{}, fmt.Errorf("conta não cadastrada")
+    }
+    credential, hasPassword := server.FSM.GetCredential(userName)
+    if !hasPassword {
+        return shared.User{}, fmt.Errorf("conta sem senha; peça à administração para definir uma")
+    }
+    if !auth.CheckPassword(password, credential.Salt, credential.Hash) {
+        return shared.User{}, fmt.Errorf("senha incorreta")
+    }
+    return account, nil
+}
+
+// propõe a conta com o hash da senha. A FSM recusa com ErrUserExists se o nome
+// já estiver em uso
+func createAccount(server *models.Server, userName, password string) (shared.User, error) {
+    salt := auth.NewSalt()
+    payload := sharedRaft.CreateUserPayload{
+        UserName:   userName,
+        Credential: sharedRaft.Credential{Salt: salt, Hash: auth.HashPassword(password, salt)},
+    }
+    cmd := sharedRaft.Command{Type: sharedRaft.CommandCreateUser, Data: utils.MustMarshal(payload)}
+    response, err := server.ApplyCommand(cmd)
+    if err != nil {
+        return shared.User{}, err
+    }
+    account, ok := response.(shared.User)
+    if !ok {
+        return shared.User{}, fmt.Errorf("resposta inesperada ao criar a conta")
+    }
+    return account, nil
+}
+
+// cria a conta com as cartas iniciais. O nome é único no cluster: a decisão
+// final é da FSM, então dois cadastros simultâneos não ficam com o mesmo nome
+func HandleRegister(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+    var user shared.User
+    if err := json.Unmarshal(request.Payload, &user); err != nil {
+        respondAccountError(server, nc, msg, &shared.AccountError{Code: shared.AccountInvalidName, Message: "payload inválido"})
+        return
+    }
+
+    if accountErr := auth.ValidateAccount(user.UserName, user.Password); accountErr != nil {
+        respondAccountError(server, nc, msg, accountErr)
+        return
+    }
+
+    taken := &shared.AccountError{Code: shared.AccountNameTaken, Message: fmt.Sprintf("o nome %s já está em uso", user.UserName)}
+    // atalho pela réplica local; a FSM confere de novo no líder
+    if _, exists := server.FSM.GetUser(user.UserName); exists {
+        respondAccountError(server, nc, msg, taken)
+        return
+    }
+
+    account, err := createAccount(server, user.UserName, user.Password)
+    if sharedRaft.IsUserExists(err) {
+        respondAccountError(server, nc, msg, taken)
+        return
+    }
+    if err != nil {
+        log.Printf("[%d] - Erro ao cadastrar '%s': %v", server.ID, user.UserName, err)
+        resp := shared.Response{
+            Status: "error",
+            Action: "REGISTER_FAIL",
+            Error:  "Não foi possível concluir o cadastro. Tente novamente.",
+            Server: server.ID,
+        }
+        data, _ := json.Marshal(resp)
+        nc.Publish(msg.Reply, data)
+        return
+    }
+
+    log.Printf("[%d] - Conta '%s' cadastrada", server.ID, account.UserName)
+    respondData(server, nc, msg, "REGISTER_SUCCESS", account)
+}
+
+func respondAccountError(server *models.Server, nc *nats.Conn, msg *nats.Msg, accountErr *shared.AccountError) {
+    resp := shared.Response{
+        Status: "error",
+        Action: "REGISTER_FAIL",
+        Error:  accountErr.Message,
+        Data:   utils.MustMarshal(accountErr),
+        Server: server.ID,
+    }
+    data, _ := json.Marshal(resp)
+    nc.Publish(msg.Reply, data)
+}
+
+// verifica se o nome de usuário já tem uma sessão neste servidor
+func isUserOnline(server *models.Server, userName string) bool {
+    server.Mu.Lock()
+    defer server.Mu.Unlock()
+
+    for _, existingUser := range server.Users {
+        if existingUser.UserName == userName {
+            return true
+        }
+    }
+    return false
+}
+
 func HandleLogout(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
 	server.Mu.Lock()
 	user, exists := server.Users[request.ClientID]
@@ -149,6 +268,7 @@ func HandleLogout(server *models.Server, request shared.Request, nc *nats.Conn,
 	mu.Unlock()
 
 	DisconnectClient(server, request.ClientID)
+	endSession(request.ClientID)
 
 	// Resposta para o cliente
 	resp := shared.Response{
@@ -161,162 +281,103 @@ func HandleLogout(server *models.Server, request shared.Request, nc *nats.Conn,
 }
 
 func HandleDrawCard(server *models.Server, request shared.Request, nc *nats.Conn, message *nats.Msg) {
-	if server.Raft.State() == raft.Leader {
-		// Se é o líder, processa, salva localmente e responde.
-		result, err := processDrawCardRequest(server, request.ClientID)
-		if err != nil {
-			respondWithError(nc, message, err.Error())
-			return
-		}
-		saveCardToLocalUser(server, request.ClientID, result)
-		respondWithSuccess(nc, message, result)
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		respondWithError(nc, message, "Usuário não está logado.")
 		return
 	}
 
-	// Se não é o líder, descobre quem é e encaminha via HTTP REST.
-	leaderAddr := string(server.Raft.Leader())
-	if leaderAddr == "" {
-		respondWithError(nc, message, "Líder não disponível no momento, tente novamente.")
-		return
-	}
-
-	log.Printf("[%d] Não sou o líder. Endereço do líder retornado pelo Raft: %s", server.ID, leaderAddr)
-	
-	leaderURL := fmt.Sprintf("http://%s/leader/draw-card", leaderAddr)
-
-	// Cria payload para o líder
-	payload := map[string]string{"clientID": request.ClientID}
-	jsonPayload, _ := json.Marshal(payload)
-
-	// Faz a requisição HTTP POST para o líder
-	resp, err := http.Post(leaderURL, "application/json", bytes.NewBuffer(jsonPayload))
+	result, err := processDrawCardRequest(server, user.UserName)
 	if err != nil {
-		respondWithError(nc, message, fmt.Sprintf("Falha ao se comunicar com o líder: %v", err))
+		respondWithError(nc, message, err.Error())
 		return
 	}
-	defer resp.Body.Close()
-
-	// Repassa a resposta do líder para o cliente via NATS
-	var leaderResponse shared.Response
-	if err := json.NewDecoder(resp.Body).Decode(&leaderResponse); err != nil {
-		respondWithError(nc, message, "Resposta inválida do líder.")
-		return
-	}
-
-	if leaderResponse.Status == "success" {
-		var drawnData shared.CardDrawnData
-		if err := json.Unmarshal(leaderResponse.Data, &drawnData); err != nil {
-			respondWithError(nc, message, "Dados da carta inválidos na resposta do líder.")
-			return
-		}
-		saveCardToLocalUser(server, request.ClientID, drawnData.Card)
-	}
-
-	finalResponseBytes, _ := json.Marshal(leaderResponse)
-	nc.Publish(message.Reply, finalResponseBytes)
+	respondWithSuccess(nc, message, result)
 }
 
+// reserva uma carta do estoque e entrega ao jogador, em qualquer servidor do cluster
+func processDrawCardRequest(server *models.Server, userName string) (shared.Card, error) {
+	requestID := uuid.New().String()
 
-func LeaderDrawCardHandler(server *models.Server) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if server.Raft.State() != raft.Leader {
-			http.Error(w, "Eu não sou o líder", http.StatusServiceUnavailable)
-			return
-		}
-
-		var payload map[string]string
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, "Payload da requisição inválido", http.StatusBadRequest)
-			return
-		}
-		clientID := payload["clientID"]
-
-		result, err := processDrawCardRequest(server, clientID)
-		w.Header().Set("Content-Type", "application/json")
-		if err != nil {
-			response := shared.Response{Status: "error", Error: err.Error(), Server: server.ID}
-			json.NewEncoder(w).Encode(response)
-			return
-		}
-
-		// O líder também salva a carta se o jogador estiver conectado a ele.
-		saveCardToLocalUser(server, clientID, result)
-
-		// Prepara a resposta para o servidor que encaminhou
-		responseData := shared.CardDrawnData{Card: result, RequestID: "n/a for forwarded req"}
-		responseBytes, _ := json.Marshal(responseData)
-		response := shared.Response{Status: "success", Action: "CARD_DRAWN", Data: responseBytes, Server: server.ID}
-		json.NewEncoder(w).Encode(response)
+	payload := sharedRaft.DrawCardPayload{
+		PlayerID:  userName,
+		RequestID: requestID,
+		ExpiresAt: time.Now().Add(sharedRaft.ReservationTTL),
 	}
-}
-
-// saveCardToLocalUser adiciona a carta ao inventário do usuário no servidor local.
-func saveCardToLocalUser(server *models.Server, clientID string, card shared.Card) {
-	server.Mu.Lock()
-	defer server.Mu.Unlock()
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandOpenPack, Data: utils.MustMarshal(payload)}
 
-	if user, ok := server.Users[clientID]; ok {
-		user.Cards = append(user.Cards, card)
-		server.Users[clientID] = user
-		log.Printf("[%d] Carta '%s' adicionada ao inventário local do cliente %s.", server.ID, card.Type, clientID)
+	responseValue, err := server.ApplyCommand(cmd)
+	if sharedRaft.IsStockEmpty(err) {
+		// repõe o estoque pelo log e tenta de novo com o mesmo RequestID
+		if err = restockCards(server); err == nil {
+			responseValue, err = server.ApplyCommand(cmd)
+		}
 	}
-}
-
-func processDrawCardRequest(server *models.Server, clientID string) (shared.Card, error) {
-	requestID := uuid.New().String()
-
-	payload := sharedRaft.DrawCardPayload{PlayerID: clientID, RequestID: requestID}
-	payloadBytes, _ := json.Marshal(payload)
-	cmd := sharedRaft.Command{Type: sharedRaft.CommandOpenPack, Data: payloadBytes}
-	cmdBytes, _ := json.Marshal(cmd)
-
-	future := server.Raft.Apply(cmdBytes, 500*time.Millisecond)
-	if err := future.Error(); err != nil {
+	if err != nil {
 		log.Printf("[%d] Erro ao aplicar comando Raft 'DrawCard': %v", server.ID, err)
+		if sharedRaft.IsStockEmpty(err) {
+			return shared.Card{}, fmt.Errorf("o estoque de cartas acabou")
+		}
 		return shared.Card{}, fmt.Errorf("erro interno ao processar a jogada")
 	}
 
-	responseValue := future.Response()
-	if strValue, ok := responseValue.(string); ok && strValue == "STOCK_EMPTY" {
-		return shared.Card{}, fmt.Errorf("o estoque de cartas acabou")
-	}
-
 	drawnCard, ok := responseValue.(shared.Card)
 	if !ok {
 		return shared.Card{}, fmt.Errorf("erro inesperado no tipo de resposta do Raft (esperava shared.Card)")
 	}
 
-	log.Printf("[%d] Carta '%s' reservada para o cliente %s (RequestID: %s).", server.ID, drawnCard.Type, clientID, requestID)
-	go claimCard(server, requestID)
+	log.Printf("[%d] Carta '%s' reservada para o usuário %s (RequestID: %s).", server.ID, drawnCard.Type, userName, requestID)
+	if err := grantCard(server, userName, requestID, drawnCard.Id); err != nil {
+		return shared.Card{}, err
+	}
 
 	return drawnCard, nil
 }
 
-// finaliza a transação, removendo a carta da área de pendentes
-func claimCard(server *models.Server, requestID string) {
-	log.Printf("[%d] Reivindicando carta para o RequestID: %s", server.ID, requestID)
+// propõe o próximo lote de cartas. A seed vai no log para todas as réplicas gerarem as mesmas cartas
+func restockCards(server *models.Server) error {
+	var seed int64
+	if err := binary.Read(rand.Reader, binary.LittleEndian, &seed); err != nil {
+		return err
+	}
+
+	payload := sharedRaft.RestockPayload{Batch: server.FSM.StockBatch() + 1, Seed: seed}
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandRestock, Data: utils.MustMarshal(payload)}
+	if _, err := server.ApplyCommand(cmd); err != nil {
+		log.Printf("[%d] Erro ao repor o estoque (lote %d): %v", server.ID, payload.Batch, err)
+		return err
+	}
+	log.Printf("[%d] Estoque reposto com o lote %d", server.ID, payload.Batch)
+	return nil
+}
 
-	payload := sharedRaft.ClaimCardPayload{RequestID: requestID}
-	payloadBytes, _ := json.Marshal(payload)
+// finaliza a transação, movendo a carta da área de pendentes para o inventário replicado do jogador
+func grantCard(server *models.Server, userName, requestID, cardID string) error {
+	log.Printf("[%d] Entregando carta do RequestID %s para %s", server.ID, requestID, userName)
 
+	payload := sharedRaft.GrantCardPayload{UserName: userName, RequestID: requestID, CardID: cardID}
 	cmd := sharedRaft.Command{
-		Type: sharedRaft.CommandClaimCard,
-		Data: payloadBytes,
+		Type: sharedRaft.CommandGrantCard,
+		Data: utils.MustMarshal(payload),
 	}
-	cmdBytes, _ := json.Marshal(cmd)
 
-	future := server.Raft.Apply(cmdBytes, 500*time.Millisecond)
-	if err := future.Error(); err != nil {
-		log.Printf("[%d] ERRO CRÍTICO: Falha ao reivindicar a carta para o RequestID %s: %v", server.ID, requestID, err)
+	if _, err := server.ApplyCommand(cmd); err != nil {
+		if sharedRaft.IsReservationExpired(err) {
+			log.Printf("[%d] Reserva do RequestID %s expirou antes da entrega", server.ID, requestID)
+			return fmt.Errorf("a reserva da carta expirou, tente abrir o pacote novamente")
+		}
+		log.Printf("[%d] ERRO CRÍTICO: Falha ao entregar a carta para o RequestID %s: %v", server.ID, requestID, err)
+		return fmt.Errorf("erro interno ao entregar a carta")
 	}
+	return nil
 }
 
 func HandleSeeCards(server *models.Server, request shared.Request, nc *nats.Conn, message *nats.Msg){
-	server.Mu.Lock()
+	user, _ := sessionUser(server, request.ClientID)
+	account, _ := server.FSM.GetUser(user.UserName)
 	cards := shared.Cards {
-		Cards : server.Users[request.ClientID].Cards,
+		Cards : account.Cards,
 	}
-	server.Mu.Unlock()
 	resp := shared.Response{
 		Status: "success",
 		Action: "SEE_CARDS",
@@ -328,11 +389,11 @@ func HandleSeeCards(server *models.Server, request shared.Request, nc *nats.Conn
 }
 
 func HandleSeeDeck(server *models.Server, request shared.Request, nc *nats.Conn, message *nats.Msg){
-	server.Mu.Lock()
+	user, _ := sessionUser(server, request.ClientID)
+	account, _ := server.FSM.GetUser(user.UserName)
 	deck := shared.Cards{
-		Cards: server.Users[request.ClientID].Deck,
+		Cards: account.Deck,
 	}
-	server.Mu.Unlock()
 	resp := shared.Response{
 		Status: "success",
 		Action: "SEE_DECK",
@@ -353,6 +414,7 @@ func DisconnectClient(server *models.Server, clientID string) {
 	delete(activeClients, clientID)
 	mu.Unlock()
 
+	dropSession(clientID, time.Now())
 	log.Printf("Cliente '%s' caiu ou ficou inativo. Removido do servidor.", clientID)
 }
 
@@ -364,6 +426,18 @@ func HandleGameMessage(server *models.Server, request shared.Request, nc *nats.C
         return
     }
 
+    clientTopic := fmt.Sprintf("client.%s.inbox", request.ClientID)
+    user, rejection := playSender(server, request, gameMsg)
+    if rejection != nil {
+        rejectPlay(nc, clientTopic, gameMsg.RoomID, rejection)
+        return
+    }
+
+    if gameMsg.Type == shared.EndSurrender {
+        handleLocalSurrender(server, nc, clientTopic, gameMsg)
+        return
+    }
+
     //Pega a sala do jogador
     roomID := gameMsg.RoomID
     game.GameRoomsMu.Lock()
@@ -371,36 +445,44 @@ func HandleGameMessage(server *models.Server, request shared.Request, nc *nats.C
     game.GameRoomsMu.Unlock()
     if !exists {
         log.Println("Sala não encontrada:", roomID)
+        rejectPlay(nc, clientTopic, roomID, &shared.PlayRejection{Code: shared.PlayRoomNotFound, Message: "sala não encontrada"})
         return
     }
 
-    //Inicializa mapa de cartas
-    if room.PlayersCards == nil {
-        room.PlayersCards = make(map[string]shared.Card)
-    }
-
     //Decodifica a carta jogada
-    var card shared.Card
-    if err := json.Unmarshal(gameMsg.Data, &card); err != nil {
+    var played shared.Card
+    if err := json.Unmarshal(gameMsg.Data, &played); err != nil {
         log.Println("Erro ao decodificar carta:", err)
         return
     }
-    room.PlayersCards[gameMsg.From] = card
 
-    //Determina quem será o próximo
+    //Confere e guarda a carta do deck registrado (não a enviada pelo cliente)
+    deck := registeredDeck(server, user.UserName)
+    game.GameRoomsMu.Lock()
+    card, rejection := game.ValidatePlay(room, gameMsg.From, deck, played.Id)
+    roundComplete := false
     var nextTurn string
-    if gameMsg.From == room.Player1.UserId {
-        nextTurn = room.Player2.UserId
-    } else {
-        nextTurn = room.Player1.UserId
+    if rejection == nil {
+        if room.PlayersCards == nil {
+            room.PlayersCards = make(map[string]shared.Card)
+        }
+        room.PlayersCards[gameMsg.From] = card
+        // decidido aqui dentro para que só uma das duas jogadas calcule a rodada
+        roundComplete = len(room.PlayersCards) == 2
+        //Passa a vez para o adversário
+        game.AdvanceTurn(room, gameMsg.From, time.Now())
+        nextTurn = room.Turn
+    }
+    game.GameRoomsMu.Unlock()
+    if rejection != nil {
+        rejectPlay(nc, clientTopic, roomID, rejection)
+        return
     }
-    room.Turn = nextTurn
 
-    //Envia mensagem para ambos os jogadores
+    //Avisa que o adversário jogou, sem revelar a carta antes do resultado
     turnMsg := shared.GameMessage{
         Type: "PLAY_CARD",
         From: gameMsg.From,  
-        Data: gameMsg.Data,  
         Turn: nextTurn,      
     }
     dataTurn, _ := json.Marshal(turnMsg)
@@ -413,15 +495,34 @@ func HandleGameMessage(server *models.Server, request shared.Request, nc *nats.C
     nc.Publish(fmt.Sprintf("client.%s.inbox", opponentID), dataTurn)
 
     //Se ambos jogaram, calcula resultado
-    if len(room.PlayersCards) == 2 {
+    if roundComplete {
+        game.GameRoomsMu.Lock()
+        if room.Status == shared.Finished {
+            // a partida acabou (tempo ou desistência) antes do resultado da rodada
+            game.GameRoomsMu.Unlock()
+            return
+        }
         cardP1 := room.PlayersCards[room.Player1.UserId]
         cardP2 := room.PlayersCards[room.Player2.UserId]
-  
         resultP1 := game.CheckWinner(cardP1, cardP2)
-        NotifyResult(nc, room, resultP1)
+        room.TurnStartedAt = time.Now()
+        matchOver := game.ApplyRound(room, resultP1)
+        // o ROUND_RESULT ainda mostra a partida em andamento
+        roundRoom := game.CopyRoom(room)
+        var matchResult string
+        var finished *shared.GameRoom
+        if matchOver {
+            matchResult = game.MatchResult(room)
+            game.FinishRoom(room, roomWinner(room, matchResult))
+            finished = game.CopyRoom(room)
+        }
+        game.GameRoomsMu.Unlock()
+        NotifyResult(nc, roundRoom, "ROUND_RESULT", resultP1)
 
-        // Limpa cartas para a próxima rodada
-        room.PlayersCards = make(map[string]shared.Card)
+        if matchOver {
+            NotifyResult(nc, finished, "MATCH_RESULT", matchResult)
+            go recordMatchResult(server, finished, matchResult, false)
+        }
         return
     }
 }
@@ -441,12 +542,46 @@ func HandleChangeDeck(server *models.Server, request shared.Request, nc *nats.Co
         return
 	}
 
-	server.Mu.Lock()
-	defer server.Mu.Unlock()
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		resp := shared.Response{
+            Status: "error",
+            Action: "CHANGE_DECK_FAIL",
+            Error:  "Usuário não está logado.",
+            Server: server.ID,
+        }
+		data, _ := json.Marshal(resp)
+        nc.Publish(msg.Reply, data)
+        return
+	}
 
-	user := server.Users[request.ClientID]
-	user.Deck = deck
-	server.Users[request.ClientID] = user
+	account, _ := server.FSM.GetUser(user.UserName)
+	if _, deckErr := cards.ValidateDeck(account.Cards, deck); deckErr != nil {
+		resp := shared.Response{
+			Status: "error",
+			Action: "CHANGE_DECK_FAIL",
+			Error:  deckErr.Message,
+			Data:   utils.MustMarshal(deckErr),
+			Server: server.ID,
+		}
+		data, _ := json.Marshal(resp)
+		nc.Publish(msg.Reply, data)
+		return
+	}
+
+	payload := sharedRaft.ChangeDeckPayload{UserName: user.UserName, Deck: deck}
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandChangeDeck, Data: utils.MustMarshal(payload)}
+	if _, err := server.ApplyCommand(cmd); err != nil {
+		resp := shared.Response{
+            Status: "error",
+            Action: "CHANGE_DECK_FAIL",
+            Error:  err.Error(),
+            Server: server.ID,
+        }
+		data, _ := json.Marshal(resp)
+        nc.Publish(msg.Reply, data)
+        return
+	}
 
 	resp := shared.Response{
             Status: "success",
@@ -467,6 +602,18 @@ func respondWithSuccess(nc *nats.Conn, msg *nats.Msg, card shared.Card) {
 	nc.Publish(msg.Reply, finalBytes)
 }
 
+// Função auxiliar para enviar respostas de sucesso com dados
+func respondData(server *models.Server, nc *nats.Conn, msg *nats.Msg, action string, data interface{}) {
+	resp := shared.Response{
+		Status: "success",
+		Action: action,
+		Data:   utils.MustMarshal(data),
+		Server: server.ID,
+	}
+	payload, _ := json.Marshal(resp)
+	nc.Publish(msg.Reply, payload)
+}
+
 // Função auxiliar para enviar respostas de erro
 func respondWithError(nc *nats.Conn, msg *nats.Msg, errorMsg string) {
 	response := shared.Response{Status: "error", Error: errorMsg}
@@ -513,37 +660,77 @@ func StartHeartbeatMonitor(server *models.Server, nc *nats.Conn) {
 			time.Sleep(heartbeatInterval)
 			now := time.Now()
 
+			// as decisões são tomadas fora do lock: pausar e encerrar sessões usam o Raft e o mesmo mutex
+			var dropped, expired []string
 			mu.Lock()
 			for id, c := range activeClients {
-				// Se passou muito tempo desde o último pong
-				if now.Sub(c.LastSeen) > disconnectTimeout {
-					log.Printf("Cliente '%s' inativo por %v. Desconectando...", id, now.Sub(c.LastSeen))
+				silent := now.Sub(c.LastSeen)
+				switch {
+				case c.State == WaitingReconnection && silent > disconnectTimeout+game.ReconnectGrace:
+					expired = append(expired, id)
+				case c.State == Active && silent > disconnectTimeout:
+					dropped = append(dropped, id)
+				}
+			}
+			mu.Unlock()
+			purgeSessions(now)
+
+			// quem não voltou a tempo já perdeu a partida pelo temporizador das salas
+			for _, id := range expired {
+				log.Printf("Cliente '%s' não voltou dentro do prazo. Desconectando...", id)
+				DisconnectClient(server, id)
+			}
+
+			for _, id := range dropped {
+				log.Printf("Cliente '%s' inativo por mais de %v", id, disconnectTimeout)
+				if pausePlayerRooms(server, nc, id) == 0 {
 					DisconnectClient(server, id)
-					delete(activeClients, id)
 					continue
 				}
 
-				// Se estiver em estado ativo, envia ping
-				if c.State == Active {
+				mu.Lock()
+				c, ok := activeClients[id]
+				returned := ok && c.LastSeen.After(now)
+				if ok && !returned {
 					c.State = WaitingReconnection
-					nc.Publish(fmt.Sprintf("client.%s.ping", id), []byte("ping"))
+				}
+				mu.Unlock()
+				if returned {
+					// o heartbeat chegou enquanto a sala era pausada
+					resumePlayerRooms(server, nc, id)
 				}
 			}
-			mu.Unlock()
 		}
 	}()
 }
 
+// registra um sinal de vida do cliente. Se ele tinha caído no meio de uma
+// partida, a partida continua de onde parou
+func clientSeen(server *models.Server, nc *nats.Conn, clientID string) {
+	if clientID == "" {
+		return
+	}
+	mu.Lock()
+	c, ok := activeClients[clientID]
+	if !ok {
+		c = &ClientInfo{ClientID: clientID}
+		activeClients[clientID] = c
+	}
+	returning := c.State == WaitingReconnection
+	c.LastSeen = time.Now()
+	c.State = Active
+	mu.Unlock()
+
+	if returning {
+		go resumePlayerRooms(server, nc, clientID)
+	}
+}
+
 
 func HandlePing(server *models.Server, req shared.Request, nc *nats.Conn, msg *nats.Msg) {
 	clientID := req.ClientID
 	// Atualiza último ping
-	mu.Lock()
-	if c, ok := activeClients[clientID]; ok {
-		c.LastSeen = time.Now()
-		c.State = Active
-	}
-	mu.Unlock()
+	clientSeen(server, nc, clientID)
 
 	// Responde com PONG
 	response := shared.Response{
@@ -555,57 +742,50 @@ func HandlePing(server *models.Server, req shared.Request, nc *nats.Conn, msg *n
 	nc.Publish(clientTopic, respData)
 }
 
-func HandleHeartbeat(serverID int, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
-	clientID := request.ClientID
-
-	mu.Lock()
-	if c, ok := activeClients[clientID]; ok {
-		c.LastSeen = time.Now()
-		c.State = Active
-	} else {
-		activeClients[clientID] = &ClientInfo{
-			ClientID: clientID,
-			LastSeen: time.Now(),
-			State:    Active,
-		}
-	}
-	mu.Unlock()
+func HandleHeartbeat(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	clientSeen(server, nc, request.ClientID)
 }
 
-func NotifyResult(nc *nats.Conn, room *shared.GameRoom, resultP1 string) {
+// envia ROUND_RESULT ou MATCH_RESULT aos jogadores da sala local, com o placar em Data.
+// Enquanto a partida continua, Turn diz quem começa a próxima rodada
+func NotifyResult(nc *nats.Conn, room *shared.GameRoom, msgType string, resultP1 string) {
 	var resultP2 string
 	switch resultP1 {
 	case "GANHOU":
 		resultP2 = "PERDEU"
-		room.Winner = room.Player1
 	case "PERDEU":
 		resultP2 = "GANHOU"
-		room.Winner = room.Player2
 	case "EMPATE":
 		resultP2 = "EMPATE"
-		room.Winner = nil
 	}
+	winner := roomWinner(room, resultP1)
+	var turn string
+	if room.Status != shared.Finished {
+		turn = room.Turn
+	}
+	roomData := utils.MustMarshal(room)
 
 	// Notifica Player1
 	msgP1 := shared.GameMessage{
-		Type:   "ROUND_RESULT",
+		Type:   msgType,
 		From:   "SERVER",
 		Result: resultP1,
-		Winner: room.Winner,
+		Winner: winner,
+		Turn:   turn,
+		Data:   roomData,
 	}
 	dataP1, _ := json.Marshal(msgP1)
 	nc.Publish(fmt.Sprintf("client.%s.inbox", room.Player1.UserId), dataP1)
 
 	// Notifica Player2
 	msgP2 := shared.GameMessage{
-		Type:   "ROUND_RESULT",
+		Type:   msgType,
 		From:   "SERVER",
 		Result: resultP2,
-		Winner: room.Winner,
+		Winner: winner,
+		Turn:   turn,
+		Data:   roomData,
 	}
 	dataP2, _ := json.Marshal(msgP2)
 	nc.Publish(fmt.Sprintf("client.%s.inbox", room.Player2.UserId), dataP2)
-
-	//Limpa cartas da rodada
-	room.PlayersCards = make(map[string]shared.Card)
 }
\ No newline at end of file
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"pbl/server/game"
+	"pbl/server/leadership"
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+	"pbl/shared"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// intervalo em que o líder verifica se os hosts das salas globais estão no ar
+	HostCheckInterval = 3 * time.Second
+
+	// falhas seguidas antes de trocar o host
+	hostFailureThreshold = 2
+)
+
+var healthClient = &http.Client{Timeout: 2 * time.Second}
+
+// usado pelo líder para saber se o servidor ainda responde
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func peerAlive(server *models.Server, id int) bool {
+	if id == server.ID {
+		return true
+	}
+	url, err := server.PeerURL(id)
+	if err != nil {
+		return false
+	}
+	resp, err := healthClient.Get(url + "/health")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Em todos os servidores: calcula as rodadas das salas que este servidor hospeda.
+// A FSM avisa quando as duas cartas foram registradas ou quando a sala ganhou um host novo
+func RunRoundResolver(ctx context.Context, server *models.Server, nc *nats.Conn) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case room := <-server.FSM.ReadyRounds:
+			if room.ServerID == server.ID {
+				resolveGlobalRound(server, nc, room)
+			}
+		}
+	}
+}
+
+func resolveGlobalRound(server *models.Server, nc *nats.Conn, room *shared.GameRoom) {
+	// o aviso pode ser antigo (replay do log); só calcula se a sala ainda está em andamento
+	current, exists := server.FSM.GetRoom(room.ID)
+	if !exists || current.Status == shared.Finished || current.ServerID != server.ID {
+		return
+	}
+
+	cardP1 := room.PlayersCards[room.Player1.UserId]
+	cardP2 := room.PlayersCards[room.Player2.UserId]
+	log.Printf("[HOST] %s: %s vs %s: %s", room.Player1.UserName, cardP1.Element, room.Player2.UserName, cardP2.Element)
+
+	resultP1 := game.CheckWinner(cardP1, cardP2)
+
+	// o placar fica no estado replicado, para um novo host continuar a partida
+	payload := sharedRaft.FinishRoundPayload{RoomID: room.ID, Round: room.Round + 1, ResultP1: resultP1, At: time.Now()}
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandFinishRound, Data: utils.MustMarshal(payload)}
+	response, err := server.ApplyCommand(cmd)
+	if err != nil {
+		log.Printf("[HOST] Erro ao registrar a rodada da sala %s: %v", room.ID, err)
+		return
+	}
+	updated, ok := response.(shared.GameRoom)
+	if !ok {
+		return
+	}
+
+	notifyPlayerResult(server, nc, &updated, "ROUND_RESULT", resultP1, updated.Player1.UserId, updated.Server1ID)
+	notifyPlayerResult(server, nc, &updated, "ROUND_RESULT", resultP1, updated.Player2.UserId, updated.Server2ID)
+	log.Printf("[HOST] Rodada %d da sala %s finalizada (%d x %d)", updated.Round, updated.ID, updated.Score1, updated.Score2)
+
+	if updated.Status == shared.Finished {
+		matchResult := game.MatchResult(&updated)
+		notifyPlayerResult(server, nc, &updated, "MATCH_RESULT", matchResult, updated.Player1.UserId, updated.Server1ID)
+		notifyPlayerResult(server, nc, &updated, "MATCH_RESULT", matchResult, updated.Player2.UserId, updated.Server2ID)
+		go recordMatchResult(server, &updated, matchResult, true)
+	}
+}
+
+// Só no líder: passa as salas de hosts que pararam de responder para outro servidor
+func RunHostFailover(ctx context.Context, server *models.Server) {
+	failures := make(map[int]int)
+	leadership.Every(ctx, HostCheckInterval, func() {
+		checkRoomHosts(server, failures)
+	})
+}
+
+func checkRoomHosts(server *models.Server, failures map[int]int) {
+	rooms := server.FSM.ActiveRooms()
+	alive := make(map[int]bool)
+	isAlive := func(id int) bool {
+		if _, checked := alive[id]; !checked {
+			alive[id] = peerAlive(server, id)
+		}
+		return alive[id]
+	}
+
+	for _, room := range rooms {
+		if isAlive(room.ServerID) {
+			delete(failures, room.ServerID)
+		}
+	}
+	for id := range alive {
+		if !alive[id] {
+			failures[id]++
+		}
+	}
+
+	for _, room := range rooms {
+		if failures[room.ServerID] < hostFailureThreshold {
+			continue
+		}
+		newHost := chooseNewHost(room, isAlive, server.ID)
+		payload := sharedRaft.ReassignHostPayload{RoomID: room.ID, From: room.ServerID, To: newHost}
+		cmd := sharedRaft.Command{Type: sharedRaft.CommandReassignHost, Data: utils.MustMarshal(payload)}
+		if _, _, err := server.ApplyLocal(cmd); err != nil {
+			log.Printf("[%d] Erro ao trocar o host da sala %s: %v", server.ID, room.ID, err)
+			continue
+		}
+		log.Printf("[%d] Host server%d não responde, sala %s passada para server%d", server.ID, payload.From, room.ID, newHost)
+	}
+}
+
+// prefere o servidor de um dos jogadores, para as mensagens continuarem locais;
+// se nenhum estiver no ar, o próprio líder assume
+func chooseNewHost(room shared.GameRoom, isAlive func(int) bool, leaderID int) int {
+	for _, id := range []int{room.Server1ID, room.Server2ID} {
+		if id != room.ServerID && isAlive(id) {
+			return id
+		}
+	}
+	return leaderID
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+)
+
+// Líder aplica o comando encaminhado por um seguidor (ver models.Server.ApplyCommand).
+// A rota exige a assinatura dos servidores (auth.RequirePeer) e só aceita os tipos de sharedRaft.Forwardable
+func LeaderApplyHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var cmd sharedRaft.Command
+		if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+			http.Error(w, "Payload da requisição inválido", http.StatusBadRequest)
+			return
+		}
+		if !sharedRaft.Forwardable[cmd.Type] {
+			http.Error(w, fmt.Sprintf("Comando %s não pode ser encaminhado", cmd.Type), http.StatusForbidden)
+			return
+		}
+
+		response, index, err := server.ApplyLocal(cmd)
+		if err == models.ErrNotLeader {
+			http.Error(w, "Eu não sou o líder", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		applyResp := sharedRaft.ApplyResponse{Index: index}
+		if fsmErr, ok := response.(error); ok {
+			applyResp.Error = fsmErr.Error()
+		} else if response != nil {
+			applyResp.Data = utils.MustMarshal(response)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(applyResp)
+	}
+}
@@ -1,44 +1,31 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
-	"bytes"
-	"net/http"
 	"encoding/json"
 
 	"pbl/shared"
 	"pbl/server/game"
+	"pbl/server/leadership"
 	"pbl/server/utils"
 	"pbl/server/models"
 	sharedRaft "pbl/server/shared"
 
-	"github.com/hashicorp/raft"
 	"github.com/nats-io/nats.go"
 )
 
 // Colocar cliente na fila --> fila local
 func HandleJoinQueue(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
-	var entry shared.QueueEntry
-	if err := json.Unmarshal(request.Payload, &entry); err != nil {
-		log.Printf("Erro ao desserializar payload do JOIN_QUEUE: %v", err)
-		resp := shared.Response{
-			Status: "error",
-			Error:  "Payload inválido",
-		}
-		data, _ := json.Marshal(resp)
-		nc.Publish(msg.Reply, data)
+	entry, err := joinLocalQueue(server, request.ClientID, time.Now())
+	if err != nil {
+		respondWithError(nc, msg, err.Error())
 		return
 	}
 
-	entry.JoinTime = time.Now() //sobreescreve o horário que o do cliente pode estar com erro
-
-	//Adiciona na fila local
-	server.Matchmaking.Mutex.Lock()
-	server.Matchmaking.LocalQueue = append(server.Matchmaking.LocalQueue, entry)
-	server.Matchmaking.Mutex.Unlock()
-
 	log.Printf("Cliente %s entrou na fila local do servidor %d", entry.Player.UserName, server.ID)
 
 	log.Printf("[DEBUG] Fila local atual: %v", ListLocalQueue(server))
@@ -54,6 +41,40 @@ func HandleJoinQueue(server *models.Server, request shared.Request, nc *nats.Con
 	nc.Publish(msg.Reply, data)
 }
 
+// coloca na fila local o usuário da sessão. O jogador da fila vem do login, não do
+// payload do cliente, para ninguém entrar na fila (e jogar partidas valendo Elo) com
+// o nome de outra conta. Quem já está em uma fila ou em uma partida é recusado
+func joinLocalQueue(server *models.Server, clientID string, now time.Time) (shared.QueueEntry, error) {
+	user, loggedIn := sessionUser(server, clientID)
+	if !loggedIn {
+		return shared.QueueEntry{}, fmt.Errorf("Usuário não está logado.")
+	}
+	if _, _, playing := playerRoom(server, clientID); playing {
+		return shared.QueueEntry{}, fmt.Errorf("Você já está em uma partida.")
+	}
+
+	user.Status = "available"
+	entry := shared.QueueEntry{
+		Player:   user,
+		ServerID: strconv.Itoa(server.ID),
+		JoinTime: now,
+	}
+
+	// a trava da fila local também cobre a passagem para a fila global (MonitorLocalQueue)
+	server.Matchmaking.Mutex.Lock()
+	defer server.Matchmaking.Mutex.Unlock()
+	for _, queued := range server.Matchmaking.LocalQueue {
+		if queued.Player.UserName == user.UserName {
+			return shared.QueueEntry{}, fmt.Errorf("Você já está na fila.")
+		}
+	}
+	if server.FSM.InGlobalQueue(user.UserName) {
+		return shared.QueueEntry{}, fmt.Errorf("Você já está na fila.")
+	}
+	server.Matchmaking.LocalQueue = append(server.Matchmaking.LocalQueue, entry)
+	return entry, nil
+}
+
 // Monitora a fila local e move jogadores para a fila global se passarem de 10s
 func MonitorLocalQueue(server *models.Server, nc *nats.Conn) {
 	ticker := time.NewTicker(1 * time.Second)
@@ -156,74 +177,29 @@ func ListLocalQueue(server *models.Server) []string {
 }
 
 //Parte global
-func LeaderJoinGlobalQueueHandler(server *models.Server) http.HandlerFunc {
-    return func(w http.ResponseWriter, r *http.Request) {
-        // só o líder processa
-        if server.Raft.State() != raft.Leader {
-            http.Error(w, "Não sou o líder", http.StatusBadRequest)
-            return
-        }
-
-        var entry shared.QueueEntry
-        if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
-            http.Error(w, "Payload inválido", http.StatusBadRequest)
-            return
-        }
-
-        // Cria o comando que será aplicado no FSM via Raft
-        cmd := sharedRaft.Command{
-            Type: sharedRaft.CommandQueueJoinGlobal,
-            Data: utils.MustMarshal(entry),
-        }
-
-        cmdBytes := utils.MustMarshal(cmd)
-
-        future := server.Raft.Apply(cmdBytes, 5*time.Second)
-        if err := future.Error(); err != nil {
-            http.Error(w, "Erro ao aplicar comando via Raft", http.StatusInternalServerError)
-            return
-        }
-
-        w.WriteHeader(http.StatusOK)
-        w.Write([]byte("Cliente adicionado à fila global"))
-    }
-}
-
 func SendToGlobalQueue(entry shared.QueueEntry, server *models.Server) {
-    // Se é líder, aplica direto via Raft
-    if server.Matchmaking.IsLeader {
-        cmdData, _ := json.Marshal(sharedRaft.Command{
-            Type: sharedRaft.CommandQueueJoinGlobal,
-            Data: utils.MustMarshal(entry),
-        })
-        future := server.Raft.Apply(cmdData, 5*time.Second)
-        if err := future.Error(); err != nil {
-            log.Printf("[Líder] Erro ao replicar fila global via Raft: %v", err)
-        }
-        return
+    cmd := sharedRaft.Command{
+        Type: sharedRaft.CommandQueueJoinGlobal,
+        Data: utils.MustMarshal(entry),
     }
 
-    // Caso contrário, envia para o líder via HTTP
-    leaderAddr := string(server.Raft.Leader())
-    if leaderAddr == "" {
-        log.Printf("[Follower] Nenhum líder disponível no momento")
-        return
+    // Aplica direto se for líder ou encaminha para o líder
+    err := models.ErrNotLeader
+    if server.Matchmaking.IsLeader.Load() {
+        _, _, err = server.ApplyLocal(cmd)
+    }
+    // seguidor (ou líder que acabou de perder a liderança): encaminha
+    if err == models.ErrNotLeader {
+        _, err = server.ApplyCommand(cmd)
     }
-
-	url := fmt.Sprintf("http://%s/leader/join-global-queue", leaderAddr)
-
-    payload := utils.MustMarshal(entry)
-    resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
     if err != nil {
-        log.Printf("[Follower] Erro ao enviar cliente %s para líder: %v", entry.Player.UserName, err)
+        log.Printf("[%d] Erro ao enviar cliente %s para a fila global: %v", server.ID, entry.Player.UserName, err)
         return
     }
-    defer resp.Body.Close()
-
-    if resp.StatusCode != http.StatusOK {
-        log.Printf("[Follower] Resposta inválida do líder: %d", resp.StatusCode)
-    } else {
-        log.Printf("[Follower] Cliente %s enviado para líder (server%d)", entry.Player.UserName, leaderAddr)
-    }
+    log.Printf("[%d] Cliente %s enviado para a fila global", server.ID, entry.Player.UserName)
 }
 
+// Só no líder: forma partidas com os jogadores da fila global a cada 500ms
+func RunGlobalMatchmaking(ctx context.Context, server *models.Server) {
+	leadership.Every(ctx, 500*time.Millisecond, server.FSM.TryMatchPlayers)
+}
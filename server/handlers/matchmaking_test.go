@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"pbl/shared"
+)
+
+// o jogador da fila é o da sessão, e quem já está na fila ou jogando é recusado
+func TestJoinLocalQueueUsesSessionUser(t *testing.T) {
+	server := newTestServer()
+	server.Users["cliente1"] = shared.User{UserName: "alice", UserId: "cliente1", ServerID: server.ID}
+
+	if _, err := joinLocalQueue(server, "cliente-sem-login", time.Unix(100, 0)); err == nil {
+		t.Fatal("cliente sem login não deveria entrar na fila")
+	}
+
+	entry, err := joinLocalQueue(server, "cliente1", time.Unix(100, 0))
+	if err != nil {
+		t.Fatalf("alice deveria entrar na fila: %v", err)
+	}
+	if entry.Player.UserName != "alice" || entry.Player.UserId != "cliente1" || entry.ServerID != "1" {
+		t.Errorf("a entrada da fila deveria vir da sessão: %+v", entry)
+	}
+	if _, err := joinLocalQueue(server, "cliente1", time.Unix(101, 0)); err == nil {
+		t.Error("alice não deveria entrar duas vezes na fila local")
+	}
+	if len(server.Matchmaking.LocalQueue) != 1 {
+		t.Errorf("esperava 1 jogador na fila local, obteve %d", len(server.Matchmaking.LocalQueue))
+	}
+
+	// já na fila global
+	server.Matchmaking.LocalQueue = nil
+	server.FSM.GlobalQueue = []shared.QueueEntry{entry}
+	if _, err := joinLocalQueue(server, "cliente1", time.Unix(102, 0)); err == nil {
+		t.Error("alice não deveria entrar na fila estando na fila global")
+	}
+
+	// já em uma partida
+	server.FSM.GlobalQueue = nil
+	bob := &shared.User{UserName: "bob", UserId: "cliente2"}
+	server.FSM.GlobalRooms["sala-global"] = &shared.GameRoom{ID: "sala-global", Player1: &entry.Player, Player2: bob, Status: shared.InProgress}
+	if _, err := joinLocalQueue(server, "cliente1", time.Unix(103, 0)); err == nil {
+		t.Error("alice não deveria entrar na fila durante uma partida")
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"pbl/server/models"
+	"pbl/shared"
+)
+
+// mensagem para um jogador que pode estar logado em outro servidor
+type UserNotification struct {
+	UserName string          `json:"username"`
+	Response shared.Response `json:"response"`
+}
+
+var notifyClient = &http.Client{Timeout: 3 * time.Second}
+
+// ClientID da sessão do jogador neste servidor
+func localClientID(server *models.Server, userName string) (string, bool) {
+	server.Mu.Lock()
+	defer server.Mu.Unlock()
+
+	for clientID, user := range server.Users {
+		if user.UserName == userName {
+			return clientID, true
+		}
+	}
+	return "", false
+}
+
+// publica a mensagem na inbox do jogador, se ele estiver logado neste servidor
+func deliverLocal(server *models.Server, userName string, resp shared.Response) bool {
+	clientID, online := localClientID(server, userName)
+	if !online {
+		return false
+	}
+	data, _ := json.Marshal(resp)
+	server.Matchmaking.Nc.Publish(fmt.Sprintf("client.%s.inbox", clientID), data)
+	return true
+}
+
+// verifica se o jogador está logado neste ou em algum outro servidor do cluster
+func IsUserOnlineAnywhere(server *models.Server, userName string) bool {
+	if _, online := localClientID(server, userName); online {
+		return true
+	}
+	for _, peer := range server.PeerList() {
+		resp, err := notifyClient.Get(peer.URL + "/online-user?username=" + url.QueryEscape(userName))
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return true
+		}
+	}
+	return false
+}
+
+// entrega a mensagem ao jogador no servidor em que ele estiver logado
+func NotifyUser(server *models.Server, userName string, resp shared.Response) bool {
+	if deliverLocal(server, userName, resp) {
+		return true
+	}
+
+	payload, _ := json.Marshal(UserNotification{UserName: userName, Response: resp})
+	for _, peer := range server.PeerList() {
+		httpResp, err := notifyClient.Post(peer.URL+"/notify-user", "application/json", bytes.NewBuffer(payload))
+		if err != nil {
+			log.Printf("[%d] Erro ao notificar %s via %s: %v", server.ID, userName, peer.URL, err)
+			continue
+		}
+		httpResp.Body.Close()
+		if httpResp.StatusCode == http.StatusOK {
+			return true
+		}
+	}
+	log.Printf("[%d] Usuário %s não está online em nenhum servidor, notificação %s descartada", server.ID, userName, resp.Action)
+	return false
+}
+
+// responde 200 se o jogador está logado neste servidor e 404 se não está
+func OnlineUserHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, online := localClientID(server, r.URL.Query().Get("username")); !online {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// recebe de outro servidor uma mensagem para um jogador logado aqui
+func NotifyUserHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var notification UserNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			http.Error(w, "Payload inválido", http.StatusBadRequest)
+			return
+		}
+		if !deliverLocal(server, notification.UserName, notification.Response) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+
+	"pbl/server/models"
+	"pbl/shared"
+
+	"github.com/nats-io/nats.go"
+)
+
+// avisa o cliente que a jogada foi recusada. O tópico é o mesmo em que ele recebe as mensagens da partida
+func rejectPlay(nc *nats.Conn, topic string, roomID string, rejection *shared.PlayRejection) {
+	rejectionData, _ := json.Marshal(rejection)
+	msg := shared.GameMessage{
+		Type:   "PLAY_REJECTED",
+		From:   "SERVER",
+		RoomID: roomID,
+		Data:   rejectionData,
+	}
+	data, _ := json.Marshal(msg)
+	nc.Publish(topic, data)
+	log.Printf("Jogada recusada na sala %s: %s (%s)", roomID, rejection.Code, rejection.Message)
+}
+
+// quem enviou a jogada: precisa estar logado e jogar em nome próprio
+func playSender(server *models.Server, request shared.Request, gameMsg shared.GameMessage) (shared.User, *shared.PlayRejection) {
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		return user, &shared.PlayRejection{Code: shared.PlayNotLoggedIn, Message: "usuário não está logado"}
+	}
+	if gameMsg.From != request.ClientID {
+		return user, &shared.PlayRejection{Code: shared.PlayNotInRoom, Message: "não é possível jogar por outro jogador"}
+	}
+	return user, nil
+}
+
+// deck registrado no servidor, usado para conferir as jogadas
+func registeredDeck(server *models.Server, userName string) []shared.Card {
+	account, _ := server.FSM.GetUser(userName)
+	return account.Deck
+}
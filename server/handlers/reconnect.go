@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"pbl/server/game"
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+	"pbl/shared"
+
+	"github.com/nats-io/nats.go"
+)
+
+// o cliente parou de mandar heartbeat: pausa as partidas dele e avisa os adversários.
+// Retorna quantas partidas foram pausadas; sem nenhuma, a sessão pode ser encerrada
+func pausePlayerRooms(server *models.Server, nc *nats.Conn, clientID string) int {
+	reconnectBy := time.Now().Add(game.ReconnectGrace)
+	paused := 0
+
+	for _, room := range game.ActiveRooms() {
+		if game.RoomPlayer(&room, clientID) == nil {
+			continue
+		}
+		game.GameRoomsMu.Lock()
+		current, exists := game.GameRooms[room.ID]
+		ok := exists && game.Pause(current, clientID, reconnectBy)
+		if ok {
+			// a cópia é lida depois de destravar
+			room = *game.CopyRoom(current)
+		}
+		game.GameRoomsMu.Unlock()
+		if ok {
+			notifyLocalPlayer(nc, &room, "OPPONENT_RECONNECTING", game.Opponent(&room, clientID).UserId)
+			paused++
+		}
+	}
+
+	for _, room := range server.FSM.ActiveRooms() {
+		if game.RoomPlayer(&room, clientID) == nil {
+			continue
+		}
+		payload := sharedRaft.PauseRoomPayload{RoomID: room.ID, PlayerID: clientID, ReconnectBy: reconnectBy}
+		cmd := sharedRaft.Command{Type: sharedRaft.CommandPauseRoom, Data: utils.MustMarshal(payload)}
+		response, err := server.ApplyCommand(cmd)
+		if err != nil {
+			log.Printf("[%d] Erro ao pausar a sala %s: %v", server.ID, room.ID, err)
+			continue
+		}
+		if updated, ok := response.(shared.GameRoom); ok {
+			notifyGlobalOpponent(server, nc, &updated, "OPPONENT_RECONNECTING", clientID)
+			paused++
+		}
+	}
+
+	if paused > 0 {
+		log.Printf("[%d] Cliente '%s' caiu durante a partida, aguardando até %s", server.ID, clientID, reconnectBy.Format(time.TimeOnly))
+	}
+	return paused
+}
+
+// o cliente voltou dentro do prazo: as partidas pausadas continuam
+func resumePlayerRooms(server *models.Server, nc *nats.Conn, clientID string) {
+	now := time.Now()
+
+	for _, room := range game.ActiveRooms() {
+		if room.PausedFor != clientID {
+			continue
+		}
+		game.GameRoomsMu.Lock()
+		current, exists := game.GameRooms[room.ID]
+		ok := exists && game.Resume(current, clientID, now)
+		if ok {
+			// a cópia é lida depois de destravar
+			room = *game.CopyRoom(current)
+		}
+		game.GameRoomsMu.Unlock()
+		if ok {
+			notifyLocalPlayer(nc, &room, "OPPONENT_RECONNECTED", game.Opponent(&room, clientID).UserId)
+		}
+	}
+
+	for _, room := range server.FSM.ActiveRooms() {
+		if room.PausedFor != clientID {
+			continue
+		}
+		payload := sharedRaft.ResumeRoomPayload{RoomID: room.ID, PlayerID: clientID, At: now}
+		cmd := sharedRaft.Command{Type: sharedRaft.CommandResumeRoom, Data: utils.MustMarshal(payload)}
+		response, err := server.ApplyCommand(cmd)
+		if err != nil {
+			log.Printf("[%d] Erro ao retomar a sala %s: %v", server.ID, room.ID, err)
+			continue
+		}
+		if updated, ok := response.(shared.GameRoom); ok {
+			notifyGlobalOpponent(server, nc, &updated, "OPPONENT_RECONNECTED", clientID)
+		}
+	}
+	log.Printf("[%d] Cliente '%s' voltou", server.ID, clientID)
+}
+
+// envia um aviso da sala local a um só jogador
+func notifyLocalPlayer(nc *nats.Conn, room *shared.GameRoom, msgType string, playerID string) {
+	nc.Publish(fmt.Sprintf("client.%s.inbox", playerID), localPlayerNotice(room, msgType, playerID))
+}
+
+// aviso com a sala em Data como playerID pode vê-la: se o adversário já jogou
+// na rodada, a carta dele fica de fora
+func localPlayerNotice(room *shared.GameRoom, msgType string, playerID string) []byte {
+	msg := shared.GameMessage{
+		Type:   msgType,
+		From:   "SERVER",
+		RoomID: room.ID,
+		Data:   utils.MustMarshal(game.RoomView(room, playerID)),
+	}
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+// envia um aviso da sala global ao adversário de playerID, no servidor dele
+func notifyGlobalOpponent(server *models.Server, nc *nats.Conn, room *shared.GameRoom, msgType string, playerID string) {
+	opponent := game.Opponent(room, playerID)
+	if opponent == nil {
+		return
+	}
+	opponentServerID := room.Server1ID
+	if opponent.UserId == room.Player2.UserId {
+		opponentServerID = room.Server2ID
+	}
+	notifyPlayerResult(server, nc, room, msgType, "", opponent.UserId, opponentServerID)
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"bytes"
+	"testing"
+
+	"pbl/shared"
+)
+
+// quem caiu já tinha jogado: o aviso ao adversário não leva a carta
+func TestLocalPlayerNoticeHidesDroppedPlayerCard(t *testing.T) {
+	alice := &shared.User{UserName: "alice", UserId: "cliente1"}
+	bob := &shared.User{UserName: "bob", UserId: "cliente2"}
+	room := &shared.GameRoom{
+		ID:           "sala-local",
+		Player1:      alice,
+		Player2:      bob,
+		Turn:         alice.UserId,
+		Status:       shared.InProgress,
+		PlayersCards: map[string]shared.Card{bob.UserId: {Id: "carta-secreta-do-bob"}},
+	}
+
+	for _, msgType := range []string{"OPPONENT_RECONNECTING", "OPPONENT_RECONNECTED"} {
+		if data := localPlayerNotice(room, msgType, alice.UserId); bytes.Contains(data, []byte("carta-secreta-do-bob")) {
+			t.Errorf("%s mostra a carta do adversário: %s", msgType, data)
+		}
+	}
+	if _, kept := room.PlayersCards[bob.UserId]; !kept {
+		t.Error("o aviso não deveria apagar a jogada da sala")
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"pbl/server/leadership"
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+)
+
+// intervalo em que o líder procura reservas vencidas
+const ReservationReapInterval = 5 * time.Second
+
+// devolve ao estoque as cartas de reservas vencidas. Deve ser chamada só pelo líder;
+// o horário de corte vai no comando para todas as réplicas removerem as mesmas reservas
+func ReapExpiredReservations(server *models.Server) {
+	now := time.Now()
+	if !server.FSM.HasExpiredReservations(now) {
+		return
+	}
+
+	payload := sharedRaft.ReapReservationsPayload{Now: now}
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandReapReservations, Data: utils.MustMarshal(payload)}
+	response, _, err := server.ApplyLocal(cmd)
+	if err != nil {
+		log.Printf("[%d] Erro ao recolher reservas expiradas: %v", server.ID, err)
+		return
+	}
+	if reaped, ok := response.(int); ok && reaped > 0 {
+		log.Printf("[%d] %d reserva(s) expirada(s) devolvida(s) ao estoque", server.ID, reaped)
+	}
+}
+
+// Só no líder: procura reservas vencidas a cada ReservationReapInterval
+func RunReservationReaper(ctx context.Context, server *models.Server) {
+	leadership.Every(ctx, ReservationReapInterval, func() {
+		ReapExpiredReservations(server)
+	})
+}
+
+// lista as reservas de cartas ainda não entregues
+func AdminReservationsHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(server.FSM.Reservations())
+	}
+}
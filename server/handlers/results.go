@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+	"pbl/shared"
+
+	"github.com/nats-io/nats.go"
+)
+
+// registra no log do Raft o resultado da partida (resultado do ponto de vista do player1).
+// Feito em segundo plano para não atrasar o aviso aos jogadores
+func recordMatchResult(server *models.Server, room *shared.GameRoom, resultP1 string, global bool) {
+	match := shared.MatchRecord{
+		// uma partida por sala: se um host novo recalcular a rodada, o resultado não conta duas vezes
+		MatchID: room.ID,
+		Player1: room.Player1.UserName,
+		Player2: room.Player2.UserName,
+		Result:  resultP1,
+		Global:  global,
+		At:      time.Now(),
+	}
+	cmd := sharedRaft.Command{
+		Type: sharedRaft.CommandRecordMatch,
+		Data: utils.MustMarshal(sharedRaft.RecordMatchPayload{Match: match}),
+	}
+	if _, err := server.ApplyCommand(cmd); err != nil {
+		log.Printf("[%d] Erro ao registrar o resultado da partida %s: %v", server.ID, match.MatchID, err)
+		return
+	}
+	log.Printf("[%d] Resultado da partida %s registrado", server.ID, match.MatchID)
+}
+
+// nota Elo e estatísticas do jogador. Sem payload, retorna o perfil de quem pediu
+func HandleSeeProfile(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		respondWithError(nc, msg, "Usuário não está logado.")
+		return
+	}
+
+	var payload struct {
+		UserName string `json:"username"`
+	}
+	if len(request.Payload) > 0 {
+		json.Unmarshal(request.Payload, &payload)
+	}
+	if payload.UserName == "" {
+		payload.UserName = user.UserName
+	}
+
+	profile, exists := server.FSM.GetProfile(payload.UserName)
+	if !exists {
+		respondWithError(nc, msg, "Jogador não encontrado.")
+		return
+	}
+	respondData(server, nc, msg, "SEE_PROFILE", profile)
+}
+
+const (
+	defaultLeaderboardPageSize = 10
+	maxLeaderboardPageSize     = 50
+)
+
+// ranking paginado dos jogadores, com a posição de quem pediu
+func HandleLeaderboard(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		respondWithError(nc, msg, "Usuário não está logado.")
+		return
+	}
+
+	var req shared.LeaderboardRequest
+	if len(request.Payload) > 0 {
+		if err := json.Unmarshal(request.Payload, &req); err != nil {
+			respondWithError(nc, msg, "Payload inválido")
+			return
+		}
+	}
+	switch req.SortBy {
+	case "":
+		req.SortBy = shared.LeaderboardByRating
+	case shared.LeaderboardByRating, shared.LeaderboardByWins:
+	default:
+		respondWithError(nc, msg, "Ordenação inválida, use \"rating\" ou \"wins\".")
+		return
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 {
+		req.PageSize = defaultLeaderboardPageSize
+	}
+	if req.PageSize > maxLeaderboardPageSize {
+		req.PageSize = maxLeaderboardPageSize
+	}
+
+	ranking := server.FSM.Ranking(req.SortBy)
+	board := shared.Leaderboard{
+		SortBy:   req.SortBy,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+		Total:    len(ranking),
+		Entries:  []shared.LeaderboardEntry{},
+	}
+	for i, profile := range ranking {
+		if profile.UserName == user.UserName {
+			board.MyRank = i + 1
+		}
+	}
+	start := (req.Page - 1) * req.PageSize
+	for i := start; i < len(ranking) && i < start+req.PageSize; i++ {
+		board.Entries = append(board.Entries, shared.LeaderboardEntry{Rank: i + 1, PlayerProfile: ranking[i]})
+	}
+	respondData(server, nc, msg, "LEADERBOARD", board)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"pbl/server/game"
+	"pbl/server/leadership"
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+	"pbl/shared"
+)
+
+const (
+	// intervalo da coleta de salas terminadas ou abandonadas
+	RoomCollectInterval = 30 * time.Second
+
+	// por quanto tempo a sala terminada continua guardada (para respostas atrasadas)
+	FinishedRoomRetention = 1 * time.Minute
+
+	// salas que não terminam nesse tempo são consideradas abandonadas
+	AbandonedRoomTTL = 10 * time.Minute
+)
+
+// jogador vencedor a partir do resultado do ponto de vista do player1; nil no empate
+func roomWinner(room *shared.GameRoom, resultP1 string) *shared.User {
+	switch resultP1 {
+	case "GANHOU":
+		return room.Player1
+	case "PERDEU":
+		return room.Player2
+	}
+	return nil
+}
+
+// Só no líder: remove do estado replicado as salas globais terminadas ou abandonadas
+func RunRoomCollector(ctx context.Context, server *models.Server) {
+	leadership.Every(ctx, RoomCollectInterval, func() {
+		collectGlobalRooms(server)
+	})
+}
+
+func collectGlobalRooms(server *models.Server) {
+	ids := server.FSM.ExpiredRooms(time.Now(), FinishedRoomRetention, AbandonedRoomTTL)
+	if len(ids) == 0 {
+		return
+	}
+
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandRemoveRoom, Data: utils.MustMarshal(sharedRaft.RemoveRoomPayload{RoomIDs: ids})}
+	response, _, err := server.ApplyLocal(cmd)
+	if err != nil {
+		log.Printf("[%d] Erro ao remover salas globais: %v", server.ID, err)
+		return
+	}
+	log.Printf("[%d] %v sala(s) global(is) removida(s)", server.ID, response)
+}
+
+// Em todos os servidores: as salas locais não são replicadas, cada servidor limpa as suas
+func RunLocalRoomCollector(ctx context.Context) {
+	leadership.Every(ctx, RoomCollectInterval, func() {
+		game.CollectRooms(time.Now(), FinishedRoomRetention, AbandonedRoomTTL)
+	})
+}
+
+// sala listada em /admin/rooms. A rota não exige assinatura, então leva só o placar,
+// a situação e os jogadores: as jogadas da rodada em andamento ficam de fora
+type RoomSummary struct {
+	ID      string            `json:"id"`
+	Status  shared.GameStatus `json:"status"`
+	Player1 string            `json:"player1"`
+	Player2 string            `json:"player2"`
+	Score1  int               `json:"score1"`
+	Score2  int               `json:"score2"`
+	Round   int               `json:"round"`
+	BestOf  int               `json:"bestOf"`
+}
+
+func summarizeRooms(rooms []shared.GameRoom) []RoomSummary {
+	summaries := make([]RoomSummary, 0, len(rooms))
+	for _, room := range rooms {
+		summary := RoomSummary{
+			ID:     room.ID,
+			Status: room.Status,
+			Score1: room.Score1,
+			Score2: room.Score2,
+			Round:  room.Round,
+			BestOf: room.BestOf,
+		}
+		if room.Player1 != nil {
+			summary.Player1 = room.Player1.UserName
+		}
+		if room.Player2 != nil {
+			summary.Player2 = room.Player2.UserName
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// lista as salas em andamento, globais (replicadas) e locais deste servidor
+func AdminRoomsHandler(server *models.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rooms := struct {
+			Global []RoomSummary `json:"global"`
+			Local  []RoomSummary `json:"local"`
+		}{
+			Global: summarizeRooms(server.FSM.ActiveRooms()),
+			Local:  summarizeRooms(game.ActiveRooms()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rooms)
+	}
+}
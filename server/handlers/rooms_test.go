@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pbl/server/game"
+	"pbl/shared"
+)
+
+// /admin/rooms não exige assinatura: a carta jogada na rodada não pode aparecer
+func TestAdminRoomsHidesPlays(t *testing.T) {
+	server := newTestServer()
+	alice := &shared.User{UserName: "alice", UserId: "cliente1"}
+	bob := &shared.User{UserName: "bob", UserId: "cliente2"}
+
+	game.GameRoomsMu.Lock()
+	game.GameRooms["sala-local"] = &shared.GameRoom{
+		ID:           "sala-local",
+		Player1:      alice,
+		Player2:      bob,
+		Status:       shared.InProgress,
+		Score1:       1,
+		PlayersCards: map[string]shared.Card{bob.UserId: {Id: "carta-secreta-do-bob"}},
+	}
+	game.GameRoomsMu.Unlock()
+	defer func() {
+		game.GameRoomsMu.Lock()
+		delete(game.GameRooms, "sala-local")
+		game.GameRoomsMu.Unlock()
+	}()
+	server.FSM.GlobalRooms["sala-global"] = &shared.GameRoom{
+		ID:          "sala-global",
+		Player1:     alice,
+		Player2:     bob,
+		Status:      shared.InProgress,
+		Commitments: map[string]string{bob.UserId: "hash-do-bob"},
+	}
+
+	recorder := httptest.NewRecorder()
+	AdminRoomsHandler(server)(recorder, httptest.NewRequest(http.MethodGet, "/admin/rooms", nil))
+	body := recorder.Body.Bytes()
+
+	for _, secret := range []string{"carta-secreta-do-bob", "hash-do-bob"} {
+		if bytes.Contains(body, []byte(secret)) {
+			t.Errorf("/admin/rooms mostra a jogada %q: %s", secret, body)
+		}
+	}
+	for _, expected := range []string{`"sala-local"`, `"sala-global"`, `"player2":"bob"`, `"score1":1`} {
+		if !bytes.Contains(body, []byte(expected)) {
+			t.Errorf("esperava %s na resposta: %s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"pbl/server/auth"
+	"pbl/server/game"
+	"pbl/server/models"
+	"pbl/server/utils"
+	"pbl/shared"
+
+	"github.com/nats-io/nats.go"
+)
+
+// por quanto tempo a sessão de um cliente que caiu ainda pode ser retomada
+const SessionTTL = 10 * time.Minute
+
+// sessão emitida no login. O token é assinado pelo servidor e vai em todo pedido;
+// a sessão guardada aqui permite invalidá-lo no logout. Ela só existe na memória
+// deste servidor: o cliente sempre retoma a sessão no servidor em que fez login
+type clientSession struct {
+	Token     string
+	UserName  string
+	DroppedAt time.Time // zero enquanto o cliente está conectado
+}
+
+var (
+	sessions   = make(map[string]*clientSession) // por ClientID
+	sessionsMu sync.Mutex
+)
+
+// cria a sessão do cliente e retorna o token que ele deve guardar
+func startSession(clientID, userName string, now time.Time) string {
+	token := auth.IssueToken(auth.Claims{UserName: userName, ClientID: clientID, ExpiresAt: now.Add(auth.TokenTTL)})
+
+	sessionsMu.Lock()
+	sessions[clientID] = &clientSession{Token: token, UserName: userName}
+	sessionsMu.Unlock()
+	return token
+}
+
+// o servidor deixou de ver o cliente; a sessão fica guardada por SessionTTL
+func dropSession(clientID string, now time.Time) {
+	sessionsMu.Lock()
+	if session, ok := sessions[clientID]; ok {
+		session.DroppedAt = now
+	}
+	sessionsMu.Unlock()
+}
+
+// logout: o token deixa de valer
+func endSession(clientID string) {
+	sessionsMu.Lock()
+	delete(sessions, clientID)
+	sessionsMu.Unlock()
+}
+
+// apaga as sessões que caíram há mais de SessionTTL
+func purgeSessions(now time.Time) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	for clientID, session := range sessions {
+		if !session.DroppedAt.IsZero() && now.Sub(session.DroppedAt) > SessionTTL {
+			delete(sessions, clientID)
+		}
+	}
+}
+
+// nome do usuário da sessão, se o token tem a assinatura do servidor, é do
+// mesmo cliente, não venceu e não foi encerrado por logout
+func checkSession(clientID, token string, now time.Time) (string, bool) {
+	claims, err := auth.VerifyToken(token, now)
+	if err != nil || claims.ClientID != clientID {
+		return "", false
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	session, ok := sessions[clientID]
+	if !ok || session.Token != token {
+		return "", false
+	}
+	if !session.DroppedAt.IsZero() && now.Sub(session.DroppedAt) > SessionTTL {
+		return "", false
+	}
+	return session.UserName, true
+}
+
+// o cliente voltou: a sessão deixa de contar o prazo da queda
+func reviveSession(clientID string) {
+	sessionsMu.Lock()
+	if session, ok := sessions[clientID]; ok {
+		session.DroppedAt = time.Time{}
+	}
+	sessionsMu.Unlock()
+}
+
+// confere o token do pedido antes de despachá-lo. Pedidos sem token válido
+// recebem AUTH_ERROR (quando esperam resposta) e não chegam ao handler
+func Authenticate(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) bool {
+	userName, ok := checkSession(request.ClientID, request.Token, time.Now())
+	if ok {
+		server.Mu.Lock()
+		user, loggedIn := server.Users[request.ClientID]
+		server.Mu.Unlock()
+		// o ClientID pode estar com outro usuário se a sessão foi retomada em outro login
+		ok = !loggedIn || user.UserName == userName
+	}
+	if ok {
+		return true
+	}
+
+	if request.Token != "" {
+		log.Printf("[%d] - Pedido %s de %s recusado: token inválido", server.ID, request.Action, request.ClientID)
+	}
+	if msg.Reply != "" {
+		resp := shared.Response{
+			Status: "error",
+			Action: "AUTH_ERROR",
+			Error:  "Sessão inválida ou expirada. Faça login novamente.",
+			Server: server.ID,
+		}
+		data, _ := json.Marshal(resp)
+		nc.Publish(msg.Reply, data)
+	}
+	return false
+}
+
+// o cliente reconectou ao NATS e quer continuar de onde parou: restaura o login
+// se o servidor já tinha encerrado a sessão, retoma a partida pausada e reenvia
+// o estado da sala, já que as mensagens publicadas durante a queda se perderam
+func HandleResumeSession(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	// o token já foi conferido no despacho
+	userName, ok := checkSession(request.ClientID, request.Token, time.Now())
+	if !ok {
+		respondWithError(nc, msg, "Sessão expirada. Faça login novamente.")
+		return
+	}
+	reviveSession(request.ClientID)
+
+	server.Mu.Lock()
+	user, loggedIn := server.Users[request.ClientID]
+	server.Mu.Unlock()
+	if !loggedIn {
+		// outro cliente pode ter entrado com o mesmo nome enquanto este estava fora
+		if isUserOnline(server, userName) {
+			endSession(request.ClientID)
+			respondWithError(nc, msg, "Usuário já está logado em outro cliente.")
+			return
+		}
+		user, _ = server.FSM.GetUser(userName)
+		user.UserId = request.ClientID
+		user.ServerID = server.ID
+		server.Mu.Lock()
+		server.Users[request.ClientID] = user
+		server.Mu.Unlock()
+		log.Printf("[%d] - Sessão de '%s' restaurada (ClientID: %s)", server.ID, userName, request.ClientID)
+	}
+
+	clientSeen(server, nc, request.ClientID)
+
+	state := shared.SessionState{User: user}
+	if room, global, messages := resumeRoom(server, request.ClientID); room != nil {
+		state.Room = room
+		state.Global = global
+		topic := clientTopic(server, request.ClientID, global)
+		for _, data := range messages {
+			nc.Publish(topic, data)
+		}
+	}
+	respondData(server, nc, msg, "RESUME_SESSION", state)
+}
+
+// partida em andamento do jogador, local ou global. A sala é uma cópia completa
+// (ActiveRooms), então resumeRoom pode ler os mapas dela sem trava
+func playerRoom(server *models.Server, clientID string) (shared.GameRoom, bool, bool) {
+	for _, room := range game.ActiveRooms() {
+		if game.RoomPlayer(&room, clientID) != nil {
+			return room, false, true
+		}
+	}
+	for _, room := range server.FSM.ActiveRooms() {
+		if game.RoomPlayer(&room, clientID) != nil {
+			return room, true, true
+		}
+	}
+	return shared.GameRoom{}, false, false
+}
+
+// sala do jogador como ele pode vê-la (sem a jogada do adversário) e o que ele pode
+// ter perdido durante a queda: o aviso de partida criada, se ele ainda não jogou
+// nela, e o estado atual da sala (MATCH_RESUMED). Sala nil se ele não está em partida
+func resumeRoom(server *models.Server, clientID string) (*shared.GameRoom, bool, [][]byte) {
+	found, global, ok := playerRoom(server, clientID)
+	if !ok {
+		return nil, false, nil
+	}
+	room := game.RoomView(&found, clientID)
+
+	var messages [][]byte
+	_, played := room.PlayersCards[clientID]
+	_, committed := room.Commitments[clientID]
+	if room.Round == 0 && !played && !committed {
+		var created []byte
+		if global {
+			created, _ = json.Marshal(shared.GameMessage{Type: "GLOBAL_MATCH_CREATED", Data: utils.MustMarshal(room)})
+		} else {
+			created, _ = json.Marshal(shared.Response{Status: "success", Action: "MATCH", Data: utils.MustMarshal(room), Server: server.ID})
+		}
+		messages = append(messages, created)
+	}
+
+	resumed, _ := json.Marshal(shared.GameMessage{
+		Type:   "MATCH_RESUMED",
+		From:   "SERVER",
+		RoomID: room.ID,
+		Turn:   room.Turn,
+		Data:   utils.MustMarshal(room),
+	})
+	return room, global, append(messages, resumed)
+}
+
+// assunto em que o cliente recebe os avisos da sala: a inbox nas salas locais
+// e o assunto do servidor dele nas globais
+func clientTopic(server *models.Server, clientID string, global bool) string {
+	if global {
+		return fmt.Sprintf("server.%d.client.%s", server.ID, clientID)
+	}
+	return fmt.Sprintf("client.%s.inbox", clientID)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"pbl/server/fsm"
+	"pbl/server/game"
+	"pbl/server/models"
+	"pbl/shared"
+)
+
+func newTestServer() *models.Server {
+	server := models.NewServer(1, "8001", nil)
+	server.FSM = fsm.NewFSM()
+	return server
+}
+
+// o adversário já jogou na rodada: a retomada não pode mostrar a carta dele
+func TestResumeRoomHidesOpponentPlay(t *testing.T) {
+	server := newTestServer()
+	alice := &shared.User{UserName: "alice", UserId: "cliente1"}
+	bob := &shared.User{UserName: "bob", UserId: "cliente2"}
+	secret := shared.Card{Id: "carta-secreta-do-bob", Element: "FOGO", Type: "NORMAL"}
+
+	game.GameRoomsMu.Lock()
+	game.GameRooms["sala-local"] = &shared.GameRoom{
+		ID:           "sala-local",
+		Player1:      alice,
+		Player2:      bob,
+		Turn:         alice.UserId,
+		Status:       shared.InProgress,
+		PlayersCards: map[string]shared.Card{bob.UserId: secret},
+	}
+	game.GameRoomsMu.Unlock()
+	defer func() {
+		game.GameRoomsMu.Lock()
+		delete(game.GameRooms, "sala-local")
+		game.GameRoomsMu.Unlock()
+	}()
+
+	room, global, messages := resumeRoom(server, alice.UserId)
+	if room == nil || global {
+		t.Fatalf("esperava a sala local de alice, obteve %+v (global %v)", room, global)
+	}
+	if _, leaked := room.PlayersCards[bob.UserId]; leaked {
+		t.Errorf("o estado da sessão mostra a carta do adversário: %+v", room.PlayersCards)
+	}
+	state, _ := json.Marshal(shared.SessionState{User: *alice, Room: room})
+	for _, data := range append(messages, state) {
+		if bytes.Contains(data, []byte(secret.Id)) {
+			t.Errorf("a retomada mostra a carta do adversário: %s", data)
+		}
+	}
+
+	// a sala guardada no servidor continua com a jogada do bob
+	game.GameRoomsMu.RLock()
+	_, kept := game.GameRooms["sala-local"].PlayersCards[bob.UserId]
+	game.GameRoomsMu.RUnlock()
+	if !kept {
+		t.Error("a retomada não deveria apagar a jogada da sala do servidor")
+	}
+
+	// quem jogou continua vendo a própria carta
+	room, _, _ = resumeRoom(server, bob.UserId)
+	if room == nil || room.PlayersCards[bob.UserId].Id != secret.Id {
+		t.Errorf("bob deveria ver a própria jogada: %+v", room)
+	}
+}
+
+// na sala global o compromisso do adversário também fica de fora
+func TestResumeRoomHidesOpponentCommitment(t *testing.T) {
+	server := newTestServer()
+	alice := &shared.User{UserName: "alice", UserId: "cliente1"}
+	bob := &shared.User{UserName: "bob", UserId: "cliente2"}
+	server.FSM.GlobalRooms["sala-global"] = &shared.GameRoom{
+		ID:          "sala-global",
+		Player1:     alice,
+		Player2:     bob,
+		Turn:        alice.UserId,
+		Status:      shared.InProgress,
+		Commitments: map[string]string{bob.UserId: "hash-do-bob"},
+	}
+
+	room, global, messages := resumeRoom(server, alice.UserId)
+	if room == nil || !global {
+		t.Fatalf("esperava a sala global de alice, obteve %+v (global %v)", room, global)
+	}
+	for _, data := range messages {
+		if bytes.Contains(data, []byte("hash-do-bob")) {
+			t.Errorf("a retomada mostra o compromisso do adversário: %s", data)
+		}
+	}
+}
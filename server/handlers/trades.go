@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"pbl/server/leadership"
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+	"pbl/shared"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+)
+
+// intervalo em que o líder procura propostas de troca vencidas
+const TradeReapInterval = 30 * time.Second
+
+// mostra as cartas de outro jogador, para escolher qual pedir na troca
+func HandleSeePlayerCards(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	if _, loggedIn := sessionUser(server, request.ClientID); !loggedIn {
+		respondWithError(nc, msg, "Usuário não está logado.")
+		return
+	}
+
+	var payload struct {
+		UserName string `json:"username"`
+	}
+	if err := json.Unmarshal(request.Payload, &payload); err != nil {
+		respondWithError(nc, msg, "Payload inválido")
+		return
+	}
+
+	account, exists := server.FSM.GetUser(payload.UserName)
+	if !exists {
+		respondWithError(nc, msg, "Jogador não encontrado.")
+		return
+	}
+	respondData(server, nc, msg, "SEE_PLAYER_CARDS", shared.Cards{Cards: account.Cards})
+}
+
+func HandleProposeTrade(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		respondWithError(nc, msg, "Usuário não está logado.")
+		return
+	}
+
+	var proposal shared.TradeProposal
+	if err := json.Unmarshal(request.Payload, &proposal); err != nil {
+		respondWithError(nc, msg, "Payload inválido")
+		return
+	}
+	if !IsUserOnlineAnywhere(server, proposal.To) {
+		respondWithError(nc, msg, "O jogador "+proposal.To+" não está online.")
+		return
+	}
+
+	now := time.Now()
+	trade := shared.Trade{
+		ID:              uuid.New().String(),
+		From:            user.UserName,
+		To:              proposal.To,
+		OfferedCardID:   proposal.OfferedCardID,
+		RequestedCardID: proposal.RequestedCardID,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(sharedRaft.TradeTTL),
+	}
+	cmd := sharedRaft.Command{
+		Type: sharedRaft.CommandProposeTrade,
+		Data: utils.MustMarshal(sharedRaft.ProposeTradePayload{Trade: trade}),
+	}
+	response, err := server.ApplyCommand(cmd)
+	if err != nil {
+		respondWithError(nc, msg, err.Error())
+		return
+	}
+	trade, ok := response.(shared.Trade)
+	if !ok {
+		respondWithError(nc, msg, "Resposta inesperada ao propor a troca.")
+		return
+	}
+	log.Printf("[%d] Troca %s proposta por %s para %s", server.ID, trade.ID, trade.From, trade.To)
+
+	NotifyUser(server, trade.To, shared.Response{
+		Status: "success",
+		Action: "TRADE_PROPOSED",
+		Data:   utils.MustMarshal(trade),
+		Server: server.ID,
+	})
+	respondData(server, nc, msg, "PROPOSE_TRADE", trade)
+}
+
+// propostas pendentes feitas ou recebidas pelo jogador
+func HandleListTrades(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		respondWithError(nc, msg, "Usuário não está logado.")
+		return
+	}
+	respondData(server, nc, msg, "LIST_TRADES", shared.Trades{Trades: server.FSM.PendingTrades(user.UserName)})
+}
+
+func HandleAnswerTrade(server *models.Server, request shared.Request, nc *nats.Conn, msg *nats.Msg) {
+	user, loggedIn := sessionUser(server, request.ClientID)
+	if !loggedIn {
+		respondWithError(nc, msg, "Usuário não está logado.")
+		return
+	}
+
+	var answer shared.TradeAnswer
+	if err := json.Unmarshal(request.Payload, &answer); err != nil {
+		respondWithError(nc, msg, "Payload inválido")
+		return
+	}
+
+	payload := sharedRaft.AnswerTradePayload{TradeID: answer.TradeID, UserName: user.UserName, Accept: answer.Accept, At: time.Now()}
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandAnswerTrade, Data: utils.MustMarshal(payload)}
+	response, err := server.ApplyCommand(cmd)
+	if err != nil {
+		respondWithError(nc, msg, err.Error())
+		return
+	}
+	trade, ok := response.(shared.Trade)
+	if !ok {
+		respondWithError(nc, msg, "Resposta inesperada ao responder a troca.")
+		return
+	}
+
+	action := "TRADE_REJECTED"
+	if trade.Status == shared.TradeAccepted {
+		action = "TRADE_ACCEPTED"
+	}
+	log.Printf("[%d] Troca %s respondida por %s: %s", server.ID, trade.ID, user.UserName, trade.Status)
+
+	NotifyUser(server, trade.From, shared.Response{
+		Status: "success",
+		Action: action,
+		Data:   utils.MustMarshal(trade),
+		Server: server.ID,
+	})
+	respondData(server, nc, msg, "ANSWER_TRADE", trade)
+}
+
+// descarta as propostas de troca que venceram sem resposta. Deve ser chamada só pelo
+// líder; o horário de corte vai no comando para todas as réplicas descartarem as mesmas
+func ReapExpiredTrades(server *models.Server) {
+	now := time.Now()
+	if !server.FSM.HasExpiredTrades(now) {
+		return
+	}
+
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandReapTrades, Data: utils.MustMarshal(sharedRaft.ReapTradesPayload{Now: now})}
+	response, _, err := server.ApplyLocal(cmd)
+	if err != nil {
+		log.Printf("[%d] Erro ao recolher propostas de troca expiradas: %v", server.ID, err)
+		return
+	}
+	if reaped, ok := response.(int); ok && reaped > 0 {
+		log.Printf("[%d] %d proposta(s) de troca expirada(s) descartada(s)", server.ID, reaped)
+	}
+}
+
+// Só no líder: procura propostas de troca vencidas a cada TradeReapInterval
+func RunTradeReaper(ctx context.Context, server *models.Server) {
+	leadership.Every(ctx, TradeReapInterval, func() {
+		ReapExpiredTrades(server)
+	})
+}
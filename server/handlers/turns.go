@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"pbl/server/game"
+	"pbl/server/leadership"
+	"pbl/server/models"
+	sharedRaft "pbl/server/shared"
+	"pbl/server/utils"
+	"pbl/shared"
+
+	"github.com/nats-io/nats.go"
+)
+
+// intervalo em que o servidor confere o tempo da vez nas partidas
+const TurnCheckInterval = 1 * time.Second
+
+// Em todos os servidores: encerra as partidas em que o jogador da vez não jogou
+// a tempo ou em que o jogador que caiu não voltou dentro do prazo. Cada servidor
+// cuida das suas salas locais e das globais que hospeda
+func RunTurnTimer(ctx context.Context, server *models.Server, nc *nats.Conn) {
+	leadership.Every(ctx, TurnCheckInterval, func() {
+		checkTurnTimers(server, nc, time.Now())
+	})
+}
+
+func checkTurnTimers(server *models.Server, nc *nats.Conn, now time.Time) {
+	for _, room := range game.ActiveRooms() {
+		if _, expired := game.ReconnectExpired(&room, now); expired {
+			finishLocalMatch(server, nc, room.ID, shared.EndDisconnect, func(room *shared.GameRoom) (string, bool) {
+				return game.ReconnectExpired(room, now)
+			})
+			continue
+		}
+		if _, expired := game.TimedOut(&room, now, shared.TurnTimeout); expired {
+			finishLocalMatch(server, nc, room.ID, shared.EndTurnTimeout, func(room *shared.GameRoom) (string, bool) {
+				// a sala pode ter mudado desde a cópia
+				return game.TimedOut(room, now, shared.TurnTimeout)
+			})
+		}
+	}
+
+	for _, room := range server.FSM.ActiveRooms() {
+		if room.ServerID != server.ID {
+			continue
+		}
+		if loser, expired := game.ReconnectExpired(&room, now); expired {
+			finishGlobalMatch(server, nc, sharedRaft.ForfeitMatchPayload{RoomID: room.ID, PlayerID: loser, Reason: shared.EndDisconnect, At: now})
+			continue
+		}
+		if loser, expired := game.TimedOut(&room, now, shared.TurnTimeout); expired {
+			finishGlobalMatch(server, nc, sharedRaft.ForfeitMatchPayload{RoomID: room.ID, PlayerID: loser, Reason: shared.EndTurnTimeout, At: now})
+		}
+	}
+}
+
+// encerra a partida local antes do fim das rodadas. decide, com a sala travada,
+// quem perdeu; se retornar false a partida continua. Os jogadores recebem o aviso
+// com o motivo e depois o MATCH_RESULT
+func finishLocalMatch(server *models.Server, nc *nats.Conn, roomID string, reason string, decide func(room *shared.GameRoom) (string, bool)) bool {
+	game.GameRoomsMu.Lock()
+	room, exists := game.GameRooms[roomID]
+	if !exists || room.Status == shared.Finished {
+		game.GameRoomsMu.Unlock()
+		return false
+	}
+	loser, ok := decide(room)
+	if !ok {
+		game.GameRoomsMu.Unlock()
+		return false
+	}
+	game.Forfeit(room, loser, reason, time.Now())
+	finished := game.CopyRoom(room)
+	game.GameRoomsMu.Unlock()
+
+	log.Printf("[%d] Sala %s encerrada (%s de %s)", server.ID, finished.ID, reason, loser)
+	result := game.WinnerResult(finished)
+	NotifyResult(nc, finished, reason, result)
+	NotifyResult(nc, finished, "MATCH_RESULT", result)
+	go recordMatchResult(server, finished, result, false)
+	return true
+}
+
+// encerra a partida global pelo estado replicado e avisa os dois jogadores.
+// A FSM ignora o pedido se a partida já terminou ou se a vez não expirou
+func finishGlobalMatch(server *models.Server, nc *nats.Conn, payload sharedRaft.ForfeitMatchPayload) bool {
+	cmd := sharedRaft.Command{Type: sharedRaft.CommandForfeitMatch, Data: utils.MustMarshal(payload)}
+	response, err := server.ApplyCommand(cmd)
+	if err != nil {
+		log.Printf("[%d] Erro ao encerrar a sala %s: %v", server.ID, payload.RoomID, err)
+		return false
+	}
+	updated, ok := response.(shared.GameRoom)
+	if !ok {
+		return false
+	}
+
+	log.Printf("[%d] Sala %s encerrada (%s de %s)", server.ID, updated.ID, payload.Reason, payload.PlayerID)
+	result := game.WinnerResult(&updated)
+	for _, msgType := range []string{payload.Reason, "MATCH_RESULT"} {
+		notifyPlayerResult(server, nc, &updated, msgType, result, updated.Player1.UserId, updated.Server1ID)
+		notifyPlayerResult(server, nc, &updated, msgType, result, updated.Player2.UserId, updated.Server2ID)
+	}
+	go recordMatchResult(server, &updated, result, true)
+	return true
+}
+
+// o jogador desistiu da partida local: o adversário vence
+func handleLocalSurrender(server *models.Server, nc *nats.Conn, clientTopic string, gameMsg shared.GameMessage) {
+	rejection := &shared.PlayRejection{Code: shared.PlayRoomNotFound, Message: "sala não encontrada"}
+	finished := finishLocalMatch(server, nc, gameMsg.RoomID, shared.EndSurrender, func(room *shared.GameRoom) (string, bool) {
+		rejection = game.ValidateSurrender(room, gameMsg.From)
+		return gameMsg.From, rejection == nil
+	})
+	if !finished {
+		if rejection == nil {
+			rejection = &shared.PlayRejection{Code: shared.PlayMatchFinished, Message: "a partida já terminou"}
+		}
+		rejectPlay(nc, clientTopic, gameMsg.RoomID, rejection)
+	}
+}
+
+// o jogador desistiu da partida global. Qualquer servidor pode encerrar a sala,
+// já que a decisão passa pelo Raft; os dois jogadores são avisados nos seus servidores
+func processClientSurrender(server *models.Server, gameMsg shared.GameMessage, nc *nats.Conn) {
+	clientTopic := fmt.Sprintf("server.%d.client.%s", server.ID, gameMsg.From)
+
+	_, rejection := validateOnReplica(server, gameMsg.RoomID, func(room *shared.GameRoom) *shared.PlayRejection {
+		return game.ValidateSurrender(room, gameMsg.From)
+	})
+	if rejection != nil {
+		rejectPlay(nc, clientTopic, gameMsg.RoomID, rejection)
+		return
+	}
+
+	payload := sharedRaft.ForfeitMatchPayload{RoomID: gameMsg.RoomID, PlayerID: gameMsg.From, Reason: shared.EndSurrender, At: time.Now()}
+	if !finishGlobalMatch(server, nc, payload) {
+		rejectPlay(nc, clientTopic, gameMsg.RoomID, &shared.PlayRejection{Code: shared.PlayFailed, Message: "não foi possível encerrar a partida"})
+	}
+}
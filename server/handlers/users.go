@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"pbl/server/models"
+	"pbl/shared"
+)
+
+// retorna o usuário logado com o ClientID informado
+func sessionUser(server *models.Server, clientID string) (shared.User, bool) {
+	server.Mu.Lock()
+	defer server.Mu.Unlock()
+
+	user, exists := server.Users[clientID]
+	return user, exists
+}
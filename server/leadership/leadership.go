@@ -0,0 +1,199 @@
+package leadership
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// assunto NATS onde as mudanças de liderança são publicadas para monitoramento
+const Subject = "cluster.leadership"
+
+// mudança de liderança vista por este servidor
+type Event struct {
+	ServerID      string    `json:"server_id"`
+	IsLeader      bool      `json:"is_leader"` // este servidor é o líder
+	LeaderID      string    `json:"leader_id"` // vazio quando o cluster está sem líder
+	LeaderAddress string    `json:"leader_address"`
+	At            time.Time `json:"at"`
+}
+
+// tarefa que só roda no líder. Deve retornar assim que o ctx for cancelado
+type LeaderFunc func(ctx context.Context)
+
+type component struct {
+	name string
+	run  LeaderFunc
+}
+
+// Monitor acompanha a liderança do Raft deste servidor. Enquanto ele for o líder,
+// os componentes registrados ficam rodando; ao perder a liderança eles são cancelados
+// e o Monitor espera todos terminarem antes de seguir.
+type Monitor struct {
+	raft     *raft.Raft
+	serverID string
+
+	mu         sync.Mutex
+	isLeader   bool
+	components []component
+	listeners  []func(Event)
+	lastEvent  Event
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+
+	stopCh chan struct{}
+}
+
+func NewMonitor(r *raft.Raft, serverID string) *Monitor {
+	return &Monitor{
+		raft:     r,
+		serverID: serverID,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// registra uma tarefa que roda só enquanto este servidor for o líder.
+// Deve ser chamado antes do Run
+func (m *Monitor) Register(name string, run LeaderFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, component{name: name, run: run})
+}
+
+// registra uma função chamada a cada mudança de liderança
+func (m *Monitor) OnChange(listener func(Event)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+func (m *Monitor) IsLeader() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.isLeader
+}
+
+// Run escuta o Raft até o Stop. O LeaderCh avisa quando este servidor ganha ou perde
+// a liderança; o observer avisa quando o líder do cluster muda
+func (m *Monitor) Run() {
+	observations := make(chan raft.Observation, 16)
+	observer := raft.NewObserver(observations, false, func(o *raft.Observation) bool {
+		_, ok := o.Data.(raft.LeaderObservation)
+		return ok
+	})
+	m.raft.RegisterObserver(observer)
+	defer m.raft.DeregisterObserver(observer)
+
+	m.setLeader(m.raft.State() == raft.Leader)
+
+	for {
+		select {
+		case isLeader := <-m.raft.LeaderCh():
+			m.setLeader(isLeader)
+
+		case <-observations:
+			m.publish()
+
+		case <-m.stopCh:
+			m.setLeader(false)
+			return
+		}
+	}
+}
+
+// encerra o Run e para os componentes que estiverem rodando
+func (m *Monitor) Stop() {
+	close(m.stopCh)
+}
+
+func (m *Monitor) setLeader(isLeader bool) {
+	m.mu.Lock()
+	wasLeader := m.isLeader
+	m.isLeader = isLeader
+	m.mu.Unlock()
+
+	if isLeader && !wasLeader {
+		m.startComponents()
+	} else if !isLeader && wasLeader {
+		m.stopComponents()
+	}
+	m.publish()
+}
+
+func (m *Monitor) startComponents() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	for _, c := range m.components {
+		m.wg.Add(1)
+		go func(c component) {
+			defer m.wg.Done()
+			log.Printf("[Liderança] Iniciando %s", c.name)
+			c.run(ctx)
+			log.Printf("[Liderança] %s encerrado", c.name)
+		}(c)
+	}
+}
+
+func (m *Monitor) stopComponents() {
+	m.mu.Lock()
+	cancel := m.cancel
+	m.cancel = nil
+	m.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	m.wg.Wait()
+}
+
+// avisa os listeners, ignorando eventos que não mudam nada
+func (m *Monitor) publish() {
+	leaderAddr, leaderID := m.raft.LeaderWithID()
+
+	m.mu.Lock()
+	event := Event{
+		ServerID:      m.serverID,
+		IsLeader:      m.isLeader,
+		LeaderID:      string(leaderID),
+		LeaderAddress: string(leaderAddr),
+	}
+	last := m.lastEvent
+	last.At = time.Time{}
+	if event == last {
+		m.mu.Unlock()
+		return
+	}
+	event.At = time.Now()
+	m.lastEvent = event
+	listeners := append([]func(Event){}, m.listeners...)
+	m.mu.Unlock()
+
+	if event.IsLeader {
+		log.Printf("[Liderança] Servidor %s é o líder", m.serverID)
+	} else {
+		log.Printf("[Liderança] Servidor %s é seguidor (líder: %q)", m.serverID, event.LeaderID)
+	}
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// executa fn a cada intervalo até o ctx ser cancelado
+func Every(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
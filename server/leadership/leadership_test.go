@@ -0,0 +1,103 @@
+package leadership
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+type nopFSM struct{}
+
+func (nopFSM) Apply(*raft.Log) interface{}         { return nil }
+func (nopFSM) Snapshot() (raft.FSMSnapshot, error) { return nil, io.ErrUnexpectedEOF }
+func (nopFSM) Restore(io.ReadCloser) error         { return nil }
+
+// nó único em memória, que vira líder logo depois do bootstrap
+func newSingleNode(t *testing.T) *raft.Raft {
+	t.Helper()
+	config := raft.DefaultConfig()
+	config.LocalID = "1"
+	config.HeartbeatTimeout = 50 * time.Millisecond
+	config.ElectionTimeout = 50 * time.Millisecond
+	config.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.LogOutput = io.Discard
+
+	addr, transport := raft.NewInmemTransport("")
+	store := raft.NewInmemStore()
+	r, err := raft.NewRaft(config, nopFSM{}, store, store, raft.NewInmemSnapshotStore(), transport)
+	if err != nil {
+		t.Fatalf("erro ao criar raft: %v", err)
+	}
+	t.Cleanup(func() { r.Shutdown().Error() })
+
+	bootstrap := raft.Configuration{Servers: []raft.Server{{ID: config.LocalID, Address: addr}}}
+	if err := r.BootstrapCluster(bootstrap).Error(); err != nil {
+		t.Fatalf("erro no bootstrap: %v", err)
+	}
+	return r
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout esperando %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMonitorStartsAndStopsComponents(t *testing.T) {
+	monitor := NewMonitor(newSingleNode(t), "1")
+
+	var running, stopped atomic.Int32
+	monitor.Register("teste", func(ctx context.Context) {
+		running.Add(1)
+		<-ctx.Done()
+		stopped.Add(1)
+	})
+
+	events := make(chan Event, 10)
+	monitor.OnChange(func(event Event) { events <- event })
+
+	done := make(chan struct{})
+	go func() {
+		monitor.Run()
+		close(done)
+	}()
+
+	waitFor(t, "componente iniciar", func() bool { return running.Load() == 1 })
+	if !monitor.IsLeader() {
+		t.Error("monitor deveria indicar liderança")
+	}
+
+	var leaderEvent Event
+	waitFor(t, "evento de liderança", func() bool {
+		select {
+		case leaderEvent = <-events:
+		default:
+		}
+		return leaderEvent.IsLeader
+	})
+	if leaderEvent.ServerID != "1" || leaderEvent.LeaderID != "1" {
+		t.Errorf("evento inesperado: %+v", leaderEvent)
+	}
+
+	// ao parar, o componente é cancelado antes do Run retornar
+	monitor.Stop()
+	<-done
+	if stopped.Load() != 1 {
+		t.Error("componente não foi encerrado")
+	}
+	if monitor.IsLeader() {
+		t.Error("monitor parado não deveria indicar liderança")
+	}
+	if running.Load() != 1 {
+		t.Errorf("componente iniciado %d vezes, esperado 1", running.Load())
+	}
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"pbl/server/auth"
+	sharedRaft "pbl/server/shared"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	applyTimeout      = 5 * time.Second
+	maxApplyAttempts  = 5
+	applyRetryBackoff = 300 * time.Millisecond
+)
+
+var (
+	// o nó não é (mais) o líder; quem chamou pode tentar de novo no novo líder
+	ErrNotLeader = errors.New("este servidor não é o líder")
+	errNoLeader  = errors.New("líder não disponível no momento")
+)
+
+var forwardClient = &http.Client{Timeout: 10 * time.Second}
+
+// ApplyCommand aplica o comando no log do Raft: direto, se este servidor é o líder,
+// ou encaminhando ao líder via /leader/apply. Troca de líder no meio do caminho é
+// tratada com novas tentativas.
+//
+// A resposta tem o mesmo tipo que a FSM retorna para o comando (ver sharedRaft.DecodeResponse),
+// e o erro retornado pela FSM vira o erro desta função. Ao retornar, a FSM local
+// já aplicou o comando, então leituras logo em seguida enxergam o resultado.
+func (s *Server) ApplyCommand(cmd sharedRaft.Command) (interface{}, error) {
+	var lastErr error
+	for attempt := 1; attempt <= maxApplyAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(applyRetryBackoff)
+		}
+
+		if s.Raft.State() == raft.Leader {
+			response, _, err := s.ApplyLocal(cmd)
+			if err == ErrNotLeader {
+				lastErr = err
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if fsmErr, ok := response.(error); ok {
+				return nil, fsmErr
+			}
+			return response, nil
+		}
+
+		leaderAddr := string(s.Raft.Leader())
+		if leaderAddr == "" {
+			lastErr = errNoLeader
+			continue
+		}
+
+		response, retry, err := s.forwardCommand(leaderAddr, cmd)
+		if retry {
+			log.Printf("[%d] Tentativa %d de encaminhar '%s' ao líder %s falhou: %v", s.ID, attempt, cmd.Type, leaderAddr, err)
+			lastErr = err
+			continue
+		}
+		return response, err
+	}
+	return nil, fmt.Errorf("não foi possível aplicar o comando %s: %v", cmd.Type, lastErr)
+}
+
+// ApplyLocal aplica o comando no Raft deste servidor, que deve ser o líder.
+// O erro retornado é do Raft; erros da FSM vêm como resposta do tipo error.
+func (s *Server) ApplyLocal(cmd sharedRaft.Command) (interface{}, uint64, error) {
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	future := s.Raft.Apply(cmdBytes, applyTimeout)
+	if err := future.Error(); err != nil {
+		if err == raft.ErrNotLeader || err == raft.ErrLeadershipLost || err == raft.ErrLeadershipTransferInProgress {
+			return nil, 0, ErrNotLeader
+		}
+		log.Printf("[%d] Erro ao aplicar comando Raft '%s': %v", s.ID, cmd.Type, err)
+		return nil, 0, fmt.Errorf("erro interno ao aplicar o comando %s", cmd.Type)
+	}
+	return future.Response(), future.Index(), nil
+}
+
+// envia o comando ao líder. retry indica que vale tentar de novo (líder mudou ou caiu)
+func (s *Server) forwardCommand(leaderAddr string, cmd sharedRaft.Command) (interface{}, bool, error) {
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, false, err
+	}
+
+	url := fmt.Sprintf("http://%s/leader/apply", leaderAddr)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth.SignPeerRequest(req, payload)
+	resp, err := forwardClient.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("falha ao se comunicar com o líder: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return nil, true, ErrNotLeader
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("líder respondeu com status %d", resp.StatusCode)
+	}
+
+	var applyResp sharedRaft.ApplyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&applyResp); err != nil {
+		return nil, false, fmt.Errorf("resposta inválida do líder")
+	}
+	s.WaitForIndex(applyResp.Index)
+
+	if applyResp.Error != "" {
+		return nil, false, errors.New(applyResp.Error)
+	}
+	response, err := sharedRaft.DecodeResponse(cmd.Type, applyResp.Data)
+	if err != nil {
+		return nil, false, fmt.Errorf("resposta inválida do líder para %s: %v", cmd.Type, err)
+	}
+	return response, false, nil
+}
+
+// WaitForIndex espera a FSM local aplicar o índice informado pelo líder (leitura após escrita)
+func (s *Server) WaitForIndex(index uint64) {
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Raft.AppliedIndex() < index {
+		if time.Now().After(deadline) {
+			log.Printf("[%d] Aviso: FSM local não alcançou o índice %d a tempo", s.ID, index)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
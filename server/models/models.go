@@ -4,6 +4,7 @@ import (
 	"pbl/server/fsm"
 	"pbl/shared"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hashicorp/raft"
 	"github.com/nats-io/nats.go"
@@ -43,5 +44,5 @@ type Matchmaking struct {
 	GlobalQueue []shared.QueueEntry //só o líder vai usar
 	Mutex       sync.Mutex
 	Nc          *nats.Conn   // conexão com NATS
-	IsLeader    bool         // indica se este servidor é o líder
+	IsLeader    atomic.Bool  // indica se este servidor é o líder, atualizado pelo monitor de liderança
 }
@@ -1,6 +1,10 @@
 package models
 
 import (
+    "fmt"
+    "strconv"
+    "strings"
+
     "pbl/shared"
 )
 
@@ -13,3 +17,43 @@ func NewServer(id int, port string, peers []PeerInfo) *Server {
     }
 }
 
+// PeerList retorna os outros servidores do cluster.
+// A configuração do Raft é a fonte da verdade, já que servidores podem entrar e sair
+// em tempo de execução; a lista do PEERS só é usada antes do Raft subir.
+func (s *Server) PeerList() []PeerInfo {
+    if s.Raft == nil {
+        return s.Peers
+    }
+    future := s.Raft.GetConfiguration()
+    if err := future.Error(); err != nil {
+        return s.Peers
+    }
+
+    var peers []PeerInfo
+    for _, member := range future.Configuration().Servers {
+        id, err := strconv.Atoi(string(member.ID))
+        if err != nil || id == s.ID {
+            continue
+        }
+        peers = append(peers, PeerInfo{ID: id, URL: peerURL(string(member.Address))})
+    }
+    return peers
+}
+
+// PeerURL retorna a URL HTTP do servidor com o ID informado
+func (s *Server) PeerURL(id int) (string, error) {
+    for _, peer := range s.PeerList() {
+        if peer.ID == id {
+            return peer.URL, nil
+        }
+    }
+    return "", fmt.Errorf("peer com ID %d não encontrado no cluster", id)
+}
+
+// o HTTP e o Raft usam a mesma porta, então a URL vem do endereço Raft
+func peerURL(address string) string {
+    if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+        return address
+    }
+    return "http://" + address
+}
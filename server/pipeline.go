@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// número máximo de AppendEntries enviados sem resposta em um pipeline
+const maxPipelineInFlight = 128
+
+// resposta de um AppendEntries dentro do stream do pipeline
+type pipelineResponse struct {
+	Error    string
+	Response raft.AppendEntriesResponse
+}
+
+// httpPipeline mantém um único POST aberto com o seguidor: os pedidos vão
+// no corpo da requisição e as respostas voltam, na mesma ordem, no corpo da resposta.
+type httpPipeline struct {
+	target raft.ServerAddress
+	body   *io.PipeWriter
+	enc    *gob.Encoder
+	resp   *http.Response
+
+	inflight chan *appendFuture
+	doneCh   chan raft.AppendFuture
+
+	shutdown     bool
+	shutdownCh   chan struct{}
+	shutdownLock sync.Mutex
+}
+
+// appendFuture implementa raft.AppendFuture
+type appendFuture struct {
+	start time.Time
+	args  *raft.AppendEntriesRequest
+	resp  *raft.AppendEntriesResponse
+	err   error
+	done  chan struct{}
+}
+
+func (f *appendFuture) Error() error {
+	<-f.done
+	return f.err
+}
+
+func (f *appendFuture) Start() time.Time                      { return f.start }
+func (f *appendFuture) Request() *raft.AppendEntriesRequest   { return f.args }
+func (f *appendFuture) Response() *raft.AppendEntriesResponse { return f.resp }
+
+func (f *appendFuture) respond(err error) {
+	f.err = err
+	close(f.done)
+}
+
+// AppendEntriesPipeline abre o stream de replicação com o seguidor
+func (t *HTTPTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+	pr, pw := io.Pipe()
+
+	url := fmt.Sprintf("http://%s/raft", target)
+	req, err := http.NewRequest("POST", url, pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(rpcTypeHeader, "AppendEntriesPipeline")
+
+	// o seguidor responde os cabeçalhos antes de ler o corpo, então o Do retorna logo
+	resp, err := t.pipelineClient.Do(req)
+	if err != nil {
+		pw.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		pw.Close()
+		resp.Body.Close()
+		return nil, fmt.Errorf("pipeline to %s failed with status: %d", target, resp.StatusCode)
+	}
+
+	p := &httpPipeline{
+		target:     target,
+		body:       pw,
+		enc:        gob.NewEncoder(pw),
+		resp:       resp,
+		inflight:   make(chan *appendFuture, maxPipelineInFlight),
+		doneCh:     make(chan raft.AppendFuture, maxPipelineInFlight),
+		shutdownCh: make(chan struct{}),
+	}
+	go p.decodeResponses()
+	return p, nil
+}
+
+func (p *httpPipeline) AppendEntries(args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) (raft.AppendFuture, error) {
+	future := &appendFuture{
+		start: time.Now(),
+		args:  args,
+		resp:  resp,
+		done:  make(chan struct{}),
+	}
+
+	if err := p.enc.Encode(args); err != nil {
+		return nil, err
+	}
+
+	// bloqueia quando há pedidos demais sem resposta (back-pressure)
+	select {
+	case p.inflight <- future:
+		return future, nil
+	case <-p.shutdownCh:
+		return nil, raft.ErrPipelineShutdown
+	}
+}
+
+func (p *httpPipeline) Consumer() <-chan raft.AppendFuture {
+	return p.doneCh
+}
+
+func (p *httpPipeline) Close() error {
+	p.shutdownLock.Lock()
+	defer p.shutdownLock.Unlock()
+	if p.shutdown {
+		return nil
+	}
+	p.shutdown = true
+	close(p.shutdownCh)
+
+	// fechar o corpo encerra o loop do seguidor
+	p.body.Close()
+	return p.resp.Body.Close()
+}
+
+// lê as respostas na ordem em que os pedidos foram enviados
+func (p *httpPipeline) decodeResponses() {
+	dec := gob.NewDecoder(p.resp.Body)
+	var streamErr error
+
+	for {
+		select {
+		case future := <-p.inflight:
+			// depois de um erro no stream, todos os pedidos pendentes falham
+			err := streamErr
+			if err == nil {
+				var frame pipelineResponse
+				if err = dec.Decode(&frame); err != nil {
+					streamErr = err
+				} else if frame.Error != "" {
+					err = errors.New(frame.Error)
+				} else {
+					*future.resp = frame.Response
+				}
+			}
+			future.respond(err)
+
+			select {
+			case p.doneCh <- future:
+			case <-p.shutdownCh:
+				return
+			}
+
+		case <-p.shutdownCh:
+			return
+		}
+	}
+}
+
+// Seguidor: processa os pedidos do stream um a um e responde cada um assim que o raft termina
+func (t *HTTPTransport) handlePipeline(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); err != nil {
+		http.Error(w, "pipeline not supported", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	dec := gob.NewDecoder(r.Body)
+	enc := gob.NewEncoder(w)
+	for {
+		req := &raft.AppendEntriesRequest{}
+		if err := dec.Decode(req); err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				log.Printf("[Pipeline] Stream encerrado: %v", err)
+			}
+			return
+		}
+
+		respChan := make(chan raft.RPCResponse, 1)
+		t.rpcChan <- raft.RPC{Command: req, RespChan: respChan}
+		rpcResp := <-respChan
+
+		var frame pipelineResponse
+		if rpcResp.Error != nil {
+			frame.Error = rpcResp.Error.Error()
+		} else if resp, ok := rpcResp.Response.(*raft.AppendEntriesResponse); ok {
+			frame.Response = *resp
+		}
+
+		if err := enc.Encode(&frame); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
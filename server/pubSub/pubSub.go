@@ -14,6 +14,13 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+// ações aceitas sem token de sessão
+var publicActions = map[string]bool{
+	"CHOOSE_SERVER": true,
+	"LOGIN":         true,
+	"REGISTER":      true,
+}
+
 func StartNats(server *models.Server) (*nats.Conn, error) {
 	opts := []nats.Option{
 		nats.RetryOnFailedConnect(true),
@@ -35,16 +42,27 @@ func StartNats(server *models.Server) (*nats.Conn, error) {
 			return
 		}
 	
+		// só a escolha de servidor, o cadastro e o login dispensam o token de sessão
+		if !publicActions[req.Action] && !handlers.Authenticate(server, req, nc, msg) {
+			return
+		}
+
 		//Chama o handler correto
 		switch req.Action {
 		case "CHOOSE_SERVER":
 			handlers.HandleChooseServer(server, req, nc, msg)
 
+		case "REGISTER":
+			handlers.HandleRegister(server, req, nc, msg)
+
 		case "LOGIN":
 			handlers.HandleLogin(server, req, nc, msg)
 
+		case "RESUME_SESSION":
+			handlers.HandleResumeSession(server, req, nc, msg)
+
 		case "HEARTBEAT":
-			handlers.HandleHeartbeat(server.ID, req, nc, msg)
+			handlers.HandleHeartbeat(server, req, nc, msg)
 
 		case "LOGOUT":
 			handlers.HandleLogout(server, req, nc, msg)
@@ -74,6 +92,24 @@ func StartNats(server *models.Server) (*nats.Conn, error) {
 			handlers.HandleChangeDeck(server, req, nc, msg)
 		case "SEE_DECK":
 			handlers.HandleSeeDeck(server, req, nc, msg)
+		case "SEE_PLAYER_CARDS":
+			handlers.HandleSeePlayerCards(server, req, nc, msg)
+		case "PROPOSE_TRADE":
+			handlers.HandleProposeTrade(server, req, nc, msg)
+		case "LIST_TRADES":
+			handlers.HandleListTrades(server, req, nc, msg)
+		case "ANSWER_TRADE":
+			handlers.HandleAnswerTrade(server, req, nc, msg)
+		case "LIST_AUCTIONS":
+			handlers.HandleListAuctions(server, req, nc, msg)
+		case "CREATE_AUCTION":
+			handlers.HandleCreateAuction(server, req, nc, msg)
+		case "BID":
+			handlers.HandleBid(server, req, nc, msg)
+		case "SEE_PROFILE":
+			handlers.HandleSeeProfile(server, req, nc, msg)
+		case "LEADERBOARD":
+			handlers.HandleLeaderboard(server, req, nc, msg)
 		}
 
 	})
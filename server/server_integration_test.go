@@ -34,6 +34,7 @@ type TestClient struct {
 	inbox    chan *nats.Msg   // Canal para onde o NATS envia mensagens
 	sub      *nats.Subscription // A inscrição NATS
 	user     shared.User      // Dados do usuário após o login
+	token    string           // token de sessão recebido no login
 }
 
 // cria e conecta um novo cliente falso.
@@ -78,6 +79,7 @@ func (c *TestClient) logout() {
 	req := shared.Request{
 		ClientID: c.clientID,
 		Action:   "LOGOUT",
+		Token:    c.token,
 	}
 	reqData, _ := json.Marshal(req)
 
@@ -116,10 +118,30 @@ func (c *TestClient) waitForMessage(timeout time.Duration) (*nats.Msg, error) {
 }
 
 
-// simula um cliente fazendo login.
+// senha dos usuários de teste, dentro da política de cadastro
+const testPassword = "senha123"
+
+// cadastra a conta; se ela já existe de uma execução anterior o erro é ignorado
+func (c *TestClient) register(username string) {
+	payload, _ := json.Marshal(shared.User{UserName: username, Password: testPassword})
+	req := shared.Request{
+		ClientID: c.clientID,
+		Action:   "REGISTER",
+		Payload:  payload,
+	}
+	reqData, _ := json.Marshal(req)
+
+	if _, err := c.nc.Request(testServerTopic, reqData, testTimeout); err != nil {
+		c.t.Logf("[%s] Aviso: erro na requisição de REGISTER: %v", c.clientID, err)
+	}
+}
+
+// simula um cliente fazendo login (cadastrando a conta antes, se preciso).
 // Retorna 'true' em sucesso, 'false' em falha.
 func (c *TestClient) login(username string) bool {
-	creds := shared.User{UserName: username, Password: "123"}
+	c.register(username)
+
+	creds := shared.User{UserName: username, Password: testPassword}
 	payload, _ := json.Marshal(creds)
 	req := shared.Request{
 		ClientID: c.clientID,
@@ -142,6 +164,7 @@ func (c *TestClient) login(username string) bool {
 	}
 
 	json.Unmarshal(resp.Data, &c.user)
+	c.token = c.user.SessionToken
 	c.user.UserId = c.clientID
 	c.user.ServerID = 1 // Hardcoded para o server 1
 	// c.t.Logf("[%s] Login como '%s' bem-sucedido", c.clientID, c.user.UserName)
@@ -154,6 +177,7 @@ func (c *TestClient) openPack() bool {
 	req := shared.Request{
 		ClientID: c.clientID,
 		Action:   "OPEN_PACK",
+		Token:    c.token,
 	}
 	reqData, _ := json.Marshal(req)
 
@@ -200,6 +224,7 @@ func (c *TestClient) joinQueue() bool {
 		Action:   "JOIN_QUEUE",
 		ClientID: c.clientID,
 		Payload:  json.RawMessage(payload),
+		Token:    c.token,
 	}
 	reqData, _ := json.Marshal(req)
 
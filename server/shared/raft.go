@@ -1,6 +1,12 @@
 package sharedRaft
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"pbl/shared"
+)
 
 // tipos de comando que podemos usar no log do Raft
 const(
@@ -10,18 +16,112 @@ const(
 	CommandQueueLeave = "QUEUE_LEAVE"
 	CommandCreateRoom = "CREATE_ROOM"
 	CommandRemoveRoom   = "REMOVE_ROOM"
+	CommandCreateUser = "CREATE_USER"
+	CommandGrantCard  = "GRANT_CARD"
+	CommandChangeDeck = "CHANGE_DECK"
+	CommandRestock    = "REPOR_ESTOQUE"
+	CommandReapReservations = "RECOLHER_RESERVAS"
+	CommandProposeTrade = "PROPOR_TROCA"
+	CommandAnswerTrade  = "RESPONDER_TROCA"
+	CommandReapTrades   = "RECOLHER_TROCAS"
+	CommandCreateAuction  = "CRIAR_LEILAO"
+	CommandBid            = "DAR_LANCE"
+	CommandSettleAuctions = "ENCERRAR_LEILOES"
+	CommandRecordMatch    = "REGISTRAR_PARTIDA"
+	CommandFinishRoom     = "FINALIZAR_SALA"
+	CommandPlayCard       = "JOGAR_CARTA"
+	CommandReassignHost   = "TROCAR_HOST"
+	CommandFinishRound    = "FINALIZAR_RODADA"
+	CommandCommitPlay     = "COMPROMETER_JOGADA"
+	CommandRevealPlay     = "REVELAR_JOGADA"
+	CommandForfeitMatch   = "ENCERRAR_PARTIDA"
+	CommandPauseRoom      = "PAUSAR_SALA"
+	CommandResumeRoom     = "RETOMAR_SALA"
+	CommandSetPassword    = "DEFINIR_SENHA"
 )
 
+// comandos que um seguidor pode encaminhar ao líder via /leader/apply: os que os
+// handlers propõem em qualquer servidor. Tarefas só do líder (coletas, leilões
+// vencidos, troca de host), a senha definida pela administração e comandos antigos ficam de fora
+var Forwardable = map[string]bool{
+	CommandOpenPack:        true,
+	CommandRestock:         true,
+	CommandGrantCard:       true,
+	CommandCreateUser:      true,
+	CommandChangeDeck:      true,
+	CommandQueueJoinGlobal: true,
+	CommandProposeTrade:    true,
+	CommandAnswerTrade:     true,
+	CommandCreateAuction:   true,
+	CommandBid:             true,
+	CommandRecordMatch:     true,
+	CommandFinishRound:     true,
+	CommandCommitPlay:      true,
+	CommandRevealPlay:      true,
+	CommandForfeitMatch:    true,
+	CommandPauseRoom:       true,
+	CommandResumeRoom:      true,
+}
+
+// retornado pela FSM quando não há cartas para abrir um pacote.
+// Quem recebe deve repor o estoque com CommandRestock e tentar de novo.
+var ErrStockEmpty = errors.New("STOCK_EMPTY")
+
+// compara pelo texto porque o erro pode ter vindo do líder via HTTP
+func IsStockEmpty(err error) bool {
+	return err != nil && err.Error() == ErrStockEmpty.Error()
+}
+
+// retornado no GRANT_CARD quando a reserva já expirou e a carta voltou ao estoque
+var ErrReservationExpired = errors.New("RESERVATION_EXPIRED")
+
+func IsReservationExpired(err error) bool {
+	return err != nil && err.Error() == ErrReservationExpired.Error()
+}
+
+// retornado no CREATE_USER quando o nome já pertence a outra conta
+var ErrUserExists = errors.New("USERNAME_TAKEN")
+
+func IsUserExists(err error) bool {
+	return err != nil && err.Error() == ErrUserExists.Error()
+}
+
 // command representa uma ação a ser aplicada na maquina de estados
 type Command struct {
 	Type string          `json:"type"`
 	Data json.RawMessage `json:"data"`
 }
 
+// tempo que uma carta fica reservada esperando o GRANT_CARD antes de voltar ao estoque
+const ReservationTTL = 30 * time.Second
+
+// tempo que uma proposta de troca espera a resposta antes de ser descartada
+const TradeTTL = 10 * time.Minute
+
 // informações sobre um pedido de reservar carta
 type DrawCardPayload struct {
-	PlayerID  string `json:"player_id"`
-	RequestID string `json:"request_id"` // identifica o pedido e garante idempotencia
+	PlayerID  string    `json:"player_id"`
+	RequestID string    `json:"request_id"` // identifica o pedido e garante idempotencia
+	ExpiresAt time.Time `json:"expires_at"` // definido por quem propõe, para todas as réplicas usarem o mesmo valor
+}
+
+// carta retirada do estoque que ainda não foi entregue ao jogador
+type Reservation struct {
+	Card      shared.Card `json:"card"`
+	PlayerID  string      `json:"player_id"`
+	ExpiresAt time.Time   `json:"expires_at"` // zero nas reservas vindas de snapshots antigos: expiram na próxima coleta
+}
+
+// reserva pendente junto com o pedido que a criou, usada em /admin/reservations
+type ReservationInfo struct {
+	RequestID string `json:"request_id"`
+	Reservation
+}
+
+// devolve ao estoque as reservas que expiraram antes de Now.
+// O horário vem do líder para que o Apply seja determinístico
+type ReapReservationsPayload struct {
+	Now time.Time `json:"now"`
 }
 
 // informações sobre um pedido de pegar a carta
@@ -46,3 +146,215 @@ type GlobalRoomPayload struct{
 	Server1 string `json:"server1"`
 	Server2 string `json:"server2"`
 }
+
+// informações para criar a conta de um jogador.
+// O hash da senha é calculado por quem propõe; a senha nunca entra no log
+type CreateUserPayload struct {
+	UserName   string     `json:"username"`
+	Credential Credential `json:"credential"`
+}
+
+// senha definida pela administração (/admin/set-password) para uma conta que já
+// existe, como as criadas antes das senhas. O hash é calculado por quem propõe
+type SetPasswordPayload struct {
+	UserName   string     `json:"username"`
+	Credential Credential `json:"credential"`
+}
+
+// senha do jogador guardada no estado replicado
+type Credential struct {
+	Salt string `json:"salt"`
+	Hash string `json:"hash"`
+}
+
+// entrega ao jogador a carta reservada pelo pedido RequestID
+type GrantCardPayload struct {
+	UserName  string `json:"username"`
+	RequestID string `json:"request_id"`
+	CardID    string `json:"card_id"` // permite reconhecer um GRANT_CARD repetido depois que a reserva foi removida
+}
+
+// novo deck escolhido pelo jogador
+type ChangeDeckPayload struct {
+	UserName string        `json:"username"`
+	Deck     []shared.Card `json:"deck"`
+}
+
+// novo lote de cartas para o estoque. As cartas são geradas a partir da seed
+// durante o Apply, então todas as réplicas terminam com o mesmo estoque
+type RestockPayload struct {
+	Batch uint64 `json:"batch"` // deve ser o lote seguinte ao último aplicado
+	Seed  int64  `json:"seed"`
+}
+
+// nova proposta de troca. ID e CreatedAt são definidos por quem propõe
+type ProposeTradePayload struct {
+	Trade shared.Trade `json:"trade"`
+}
+
+// resposta do jogador que recebeu a proposta. Se aceita, a troca das
+// duas cartas acontece inteira dentro do Apply deste comando
+type AnswerTradePayload struct {
+	TradeID  string    `json:"trade_id"`
+	UserName string    `json:"username"` // quem está respondendo, deve ser o destinatário da proposta
+	Accept   bool      `json:"accept"`
+	At       time.Time `json:"at"` // horário da resposta, para conferir se a proposta já venceu
+}
+
+// horário de corte escolhido pelo líder: propostas de troca vencidas até ele são descartadas.
+// A resposta é quantas foram descartadas
+type ReapTradesPayload struct {
+	Now time.Time `json:"now"`
+}
+
+// novo leilão. ID, CreatedAt e EndsAt são definidos por quem propõe
+type CreateAuctionPayload struct {
+	Auction shared.Auction `json:"auction"`
+}
+
+// lance em um leilão. At é o horário do lance, comparado com o fim do leilão
+type BidPayload struct {
+	AuctionID string    `json:"auction_id"`
+	UserName  string    `json:"username"`
+	Amount    int       `json:"amount"`
+	At        time.Time `json:"at"`
+}
+
+// resultado de um lance aceito
+type BidResult struct {
+	Auction shared.Auction `json:"auction"`
+	Outbid  string         `json:"outbid,omitempty"` // jogador que tinha o maior lance e foi reembolsado
+}
+
+// encerra os leilões que terminaram antes de Now (enviado pelo líder)
+type SettleAuctionsPayload struct {
+	Now time.Time `json:"now"`
+}
+
+// resultado de uma partida terminada. Repetir o mesmo MatchID não altera nada
+type RecordMatchPayload struct {
+	Match shared.MatchRecord `json:"match"`
+}
+
+// marca a sala global como terminada. At é o horário do fim, usado na coleta das salas
+type FinishRoomPayload struct {
+	RoomID string       `json:"roomID"`
+	Winner *shared.User `json:"winner,omitempty"`
+	At     time.Time    `json:"at"`
+}
+
+// carta jogada numa sala global. Fica no estado replicado para que outro
+// servidor possa terminar a rodada se o host cair. Substituído pelo
+// commit-reveal, mantido para reaplicar logs antigos
+type PlayCardPayload struct {
+	RoomID   string      `json:"roomID"`
+	PlayerID string      `json:"playerID"`
+	Card     shared.Card `json:"card"`
+}
+
+// hash da carta escolhida numa sala global. Os servidores só veem a carta
+// depois que os dois jogadores se comprometeram
+type CommitPlayPayload struct {
+	RoomID     string `json:"roomID"`
+	PlayerID   string `json:"playerID"`
+	Commitment string    `json:"commitment"`
+	At         time.Time `json:"at"` // começo da vez do adversário
+}
+
+// partida global encerrada antes do fim das rodadas. PlayerID é quem perdeu
+// (vazio se os dois deixaram o tempo acabar)
+type ForfeitMatchPayload struct {
+	RoomID   string    `json:"roomID"`
+	PlayerID string    `json:"playerID"`
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+}
+
+// carta e nonce revelados pelo jogador, conferidos contra o hash registrado
+type RevealPlayPayload struct {
+	RoomID   string `json:"roomID"`
+	PlayerID string `json:"playerID"`
+	CardID   string `json:"cardID"`
+	Nonce    string `json:"nonce"`
+}
+
+// jogador caiu no meio da partida global; ReconnectBy é calculado por quem detectou a queda
+type PauseRoomPayload struct {
+	RoomID      string    `json:"roomID"`
+	PlayerID    string    `json:"playerID"`
+	ReconnectBy time.Time `json:"reconnectBy"`
+}
+
+// jogador voltou dentro do prazo
+type ResumeRoomPayload struct {
+	RoomID   string    `json:"roomID"`
+	PlayerID string    `json:"playerID"`
+	At       time.Time `json:"at"`
+}
+
+// resultado de uma rodada da sala global, calculado pelo host. Round é o número
+// da rodada terminada, para que a mesma rodada não seja contada duas vezes.
+// Se a partida acabar, a sala é finalizada com o horário At
+type FinishRoundPayload struct {
+	RoomID   string    `json:"roomID"`
+	Round    int       `json:"round"`
+	ResultP1 string    `json:"resultP1"`
+	At       time.Time `json:"at"`
+}
+
+// passa a sala do host From para o servidor To. Não faz nada se o host já mudou
+type ReassignHostPayload struct {
+	RoomID string `json:"roomID"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+}
+
+// salas globais a remover, escolhidas pelo líder. A resposta é quantas foram removidas
+type RemoveRoomPayload struct {
+	RoomIDs []string `json:"roomIDs"`
+}
+
+// resposta do líder para um comando encaminhado via /leader/apply
+type ApplyResponse struct {
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"` // erro retornado pela FSM ao aplicar o comando
+	Index uint64          `json:"index"`           // índice do log em que o comando foi aplicado
+}
+
+// tipo da resposta que a FSM retorna para cada comando.
+// Comandos que não estão aqui respondem nil.
+var responseDecoders = map[string]func(json.RawMessage) (interface{}, error){
+	CommandOpenPack:   decodeAs[shared.Card],
+	CommandCreateUser: decodeAs[shared.User],
+	CommandGrantCard:  decodeAs[shared.Card],
+	CommandReapReservations: decodeAs[int],
+	CommandProposeTrade:     decodeAs[shared.Trade],
+	CommandAnswerTrade:      decodeAs[shared.Trade],
+	CommandReapTrades:       decodeAs[int],
+	CommandCreateAuction:    decodeAs[shared.Auction],
+	CommandBid:              decodeAs[BidResult],
+	CommandSettleAuctions:   decodeAs[[]shared.Auction],
+	CommandRemoveRoom:       decodeAs[int],
+	CommandFinishRound:      decodeAs[shared.GameRoom],
+	CommandForfeitMatch:     decodeAs[shared.GameRoom],
+	CommandPauseRoom:        decodeAs[shared.GameRoom],
+	CommandResumeRoom:       decodeAs[shared.GameRoom],
+}
+
+// DecodeResponse converte a resposta recebida do líder no mesmo tipo
+// que a FSM local teria retornado para o comando
+func DecodeResponse(cmdType string, data json.RawMessage) (interface{}, error) {
+	decode, ok := responseDecoders[cmdType]
+	if !ok || len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	return decode(data)
+}
+
+func decodeAs[T any](data json.RawMessage) (interface{}, error) {
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -11,8 +13,11 @@ import (
 	"strings"
 	"time"
 
+	"pbl/server/auth"
 	"pbl/server/fsm"
+	"pbl/server/game"
 	"pbl/server/handlers"
+	"pbl/server/leadership"
 	"pbl/server/models"
 	"pbl/server/pubSub"
 	"pbl/server/utils"
@@ -23,7 +28,9 @@ import (
 	raftboltdb "github.com/hashicorp/raft-boltdb"
 )
 
-func StartServer(idString, port, peersEnv, natsURL string) error {
+// joinAddr vazio: o servidor faz o bootstrap do cluster com os PEERS (ou sozinho, se não houver PEERS).
+// joinAddr preenchido (ex: "10.0.0.1:8001"): o servidor pede para entrar em um cluster que já existe.
+func StartServer(idString, port, peersEnv, natsURL, joinAddr string) error {
 	style.Clear()
 	id, _ := strconv.Atoi(idString)
 	if port == "" {
@@ -33,7 +40,15 @@ func StartServer(idString, port, peersEnv, natsURL string) error {
 	peerInfos := parsePeers(peersEnv)
 	server := models.NewServer(id, port, peerInfos)
 
-	
+	// configurações do jogo e da autenticação
+	if err := game.SetBestOf(os.Getenv("MATCH_BEST_OF")); err != nil {
+		log.Fatalf("Configuração inválida: %v", err)
+	}
+	if err := game.SetReconnectGrace(os.Getenv("RECONNECT_GRACE")); err != nil {
+		log.Fatalf("Configuração inválida: %v", err)
+	}
+	auth.SetSecret()
+
 	// Configuração Raft
 	config := raft.DefaultConfig()
 	config.HeartbeatTimeout = 2000 * time.Millisecond 
@@ -43,11 +58,11 @@ func StartServer(idString, port, peersEnv, natsURL string) error {
 	config.LocalID = raft.ServerID(idString)
 
 	raftAdvAddr := os.Getenv("RAFT_ADVERTISE_ADDR")
-		if raftAdvAddr == "" {
-			// Fallback para localhost se não estiver no Docker (para rodar local)
-			log.Printf("RAFT_ADVERTISE_ADDR não definida, usando fallback para localhost:%s", port)
-			raftAdvAddr = "localhost:" + port
-		}
+	if raftAdvAddr == "" {
+		// Fallback para localhost se não estiver no Docker (para rodar local)
+		log.Printf("RAFT_ADVERTISE_ADDR não definida, usando fallback para localhost:%s", port)
+		raftAdvAddr = "localhost:" + port
+	}
 
 	//raftListenAddr := "0.0.0.0:" + port
 	transport := NewHTTPTransport(raft.ServerAddress(raftAdvAddr))
@@ -77,24 +92,32 @@ func StartServer(idString, port, peersEnv, natsURL string) error {
 	fsm.Raft = ra // FSM precisa do Raft para checar se é líder
 
 
-	// Bootstrap cluster
-	var configuration raft.Configuration
-	
-	selfAddr := raftAdvAddr 
-	configuration.Servers = []raft.Server{
-		{ID: raft.ServerID(idString), Address: raft.ServerAddress(selfAddr)},
-	}
-	
-	for _, peer := range peerInfos {
-		raftPeerAddr := strings.TrimPrefix(peer.URL, "http://")
-		raftPeerAddr = strings.TrimPrefix(raftPeerAddr, "https://") 
-		
-		configuration.Servers = append(configuration.Servers, raft.Server{
-			ID:      raft.ServerID(strconv.Itoa(peer.ID)),
-			Address: raft.ServerAddress(raftPeerAddr),
-		})
+	if joinAddr != "" {
+		// Entra em um cluster existente: o líder adiciona este servidor à configuração
+		go joinCluster(joinAddr, idString, raftAdvAddr, os.Getenv("JOIN_AS_NONVOTER") == "true")
+	} else {
+		// Bootstrap cluster
+		var configuration raft.Configuration
+
+		selfAddr := raftAdvAddr
+		configuration.Servers = []raft.Server{
+			{ID: raft.ServerID(idString), Address: raft.ServerAddress(selfAddr)},
+		}
+
+		for _, peer := range peerInfos {
+			raftPeerAddr := strings.TrimPrefix(peer.URL, "http://")
+			raftPeerAddr = strings.TrimPrefix(raftPeerAddr, "https://")
+
+			configuration.Servers = append(configuration.Servers, raft.Server{
+				ID:      raft.ServerID(strconv.Itoa(peer.ID)),
+				Address: raft.ServerAddress(raftPeerAddr),
+			})
+		}
+		// se já existe estado salvo em raft_data o bootstrap é ignorado
+		if err := ra.BootstrapCluster(configuration).Error(); err != nil && err != raft.ErrCantBootstrap {
+			log.Printf("Erro no bootstrap do cluster: %v", err)
+		}
 	}
-	ra.BootstrapCluster(configuration)
 
 	// Inicia NATS
 	nc, err := pubSub.StartNats(server)
@@ -107,34 +130,39 @@ func StartServer(idString, port, peersEnv, natsURL string) error {
 	go handlers.MonitorLocalQueue(server, nc)
 	//log.Printf("[Servidor %d] Monitor de matchmaking local iniciado.", server.ID)
 	handlers.StartHeartbeatMonitor(server, nc)
+	go handlers.RunLocalRoomCollector(context.Background())
+	go handlers.RunRoundResolver(context.Background(), server, nc)
+	go handlers.RunTurnTimer(context.Background(), server, nc)
 
-	// Ticker para o líder tentar criar partidas a cada 500ms
-	go func() {
-		ticker := time.NewTicker(500 * time.Millisecond)
-		defer ticker.Stop()
-		for range ticker.C {
-			if server.Raft != nil && server.Raft.State() == raft.Leader {
-				//log.Println("[LÍDER] Verificando fila global para criar partidas...")
-				fsm.TryMatchPlayers()
-			}
-		}
-	}()
-
-	// Goroutine para escutar salas criadas e notificar outros servidores
-	go func() {
-		for room := range server.FSM.CreatedRooms {
-			// Apenas o líder envia notificações
-			if server.FSM.Raft != nil && server.FSM.Raft.State() == raft.Leader {
-				go notifyServersAboutMatch(room, server)
-				go utils.NotifyClients(*room, server)
-			}
-		}
-	}()
+	// Tarefas que só o líder executa. O monitor liga e desliga cada uma conforme a liderança muda
+	monitor := leadership.NewMonitor(ra, idString)
+	monitor.Register("matchmaking global", func(ctx context.Context) { handlers.RunGlobalMatchmaking(ctx, server) })
+	monitor.Register("notificação de salas", func(ctx context.Context) { runRoomNotifier(ctx, server) })
+	monitor.Register("coleta de reservas", func(ctx context.Context) { handlers.RunReservationReaper(ctx, server) })
+	monitor.Register("coleta de trocas", func(ctx context.Context) { handlers.RunTradeReaper(ctx, server) })
+	monitor.Register("encerramento de leilões", func(ctx context.Context) { handlers.RunAuctionSettler(ctx, server) })
+	monitor.Register("coleta de salas", func(ctx context.Context) { handlers.RunRoomCollector(ctx, server) })
+	monitor.Register("failover de hosts", func(ctx context.Context) { handlers.RunHostFailover(ctx, server) })
+	monitor.OnChange(func(event leadership.Event) {
+		fsm.SetLeader(event.IsLeader)
+		server.Matchmaking.IsLeader.Store(event.IsLeader)
+		nc.Publish(leadership.Subject, utils.MustMarshal(event))
+	})
+	go monitor.Run()
 
 	// HTTP handlers
 	http.HandleFunc("/raft", transport.HandleRaftRequest)
-	http.HandleFunc("/leader/draw-card", handlers.LeaderDrawCardHandler(server))
-	http.HandleFunc("/leader/join-global-queue", handlers.LeaderJoinGlobalQueueHandler(server))
+	http.HandleFunc("/leader/apply", auth.RequirePeer(handlers.LeaderApplyHandler(server)))
+
+	// administração do cluster
+	http.HandleFunc("/admin/cluster", handlers.AdminClusterHandler(server))
+	// mudar os membros do cluster exige a mesma assinatura dos servidores
+	http.HandleFunc("/admin/add-voter", auth.RequirePeer(handlers.AdminAddVoterHandler(server)))
+	http.HandleFunc("/admin/add-nonvoter", auth.RequirePeer(handlers.AdminAddNonvoterHandler(server)))
+	http.HandleFunc("/admin/remove-server", auth.RequirePeer(handlers.AdminRemoveServerHandler(server)))
+	http.HandleFunc("/admin/set-password", auth.RequirePeer(handlers.AdminSetPasswordHandler(server)))
+	http.HandleFunc("/admin/reservations", handlers.AdminReservationsHandler(server))
+	http.HandleFunc("/admin/rooms", handlers.AdminRoomsHandler(server))
 	
 	http.HandleFunc("/notify-match", func(w http.ResponseWriter, r *http.Request) {
 		var room shared.GameRoom
@@ -148,7 +176,9 @@ func StartServer(idString, port, peersEnv, natsURL string) error {
 	})
 	http.HandleFunc("/forward-card", handlers.HandleForwardCard(server, nc))
 	http.HandleFunc("/forward-result", handlers.HandleForwardCard(server, nc))
-	http.HandleFunc("/forward-to-host", handlers.HandleForwardToHost(server, nc))
+	http.HandleFunc("/health", handlers.HealthHandler)
+	http.HandleFunc("/online-user", handlers.OnlineUserHandler(server))
+	http.HandleFunc("/notify-user", handlers.NotifyUserHandler(server))
 
 
 	log.Printf("[Servidor %d] HTTP iniciado na porta %s, pronto para Raft e NATS", server.ID, server.Port)
@@ -176,6 +206,58 @@ func parsePeers(peersEnv string) []models.PeerInfo {
 	return peers
 }
 
+// pede a um servidor do cluster (que redireciona ao líder) para adicionar este servidor.
+// Tenta até conseguir, já que o cluster pode estar no meio de uma eleição.
+func joinCluster(joinAddr, idString, raftAdvAddr string, nonvoter bool) {
+	path := "/admin/add-voter"
+	if nonvoter {
+		path = "/admin/add-nonvoter"
+	}
+	url := "http://" + strings.TrimPrefix(joinAddr, "http://") + path
+
+	payload, _ := json.Marshal(handlers.MembershipRequest{ID: idString, Address: raftAdvAddr})
+	for attempt := 1; ; attempt++ {
+		// assinada a cada tentativa, para o timestamp não vencer; o redirecionamento
+		// ao líder repete os cabeçalhos e o caminho, então a assinatura continua valendo
+		req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		auth.SignPeerRequest(req, payload)
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				log.Printf("[Join] Servidor %s adicionado ao cluster via %s", idString, joinAddr)
+				return
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		log.Printf("[Join] Tentativa %d de entrar no cluster via %s falhou: %v", attempt, joinAddr, err)
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// Só no líder: avisa os servidores e os jogadores sobre as salas globais criadas pela FSM
+func runRoomNotifier(ctx context.Context, server *models.Server) {
+	// salas que ficaram no canal antes desta liderança já foram avisadas pelo líder anterior
+	for drained := false; !drained; {
+		select {
+		case <-server.FSM.CreatedRooms:
+		default:
+			drained = true
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case room := <-server.FSM.CreatedRooms:
+			go notifyServersAboutMatch(room, server)
+			go utils.NotifyClients(*room, server)
+		}
+	}
+}
+
 func notifyServersAboutMatch(room *shared.GameRoom, server *models.Server) {
     payload, err := json.Marshal(room)
     if err != nil {
@@ -183,7 +265,7 @@ func notifyServersAboutMatch(room *shared.GameRoom, server *models.Server) {
         return
     }
 
-    for _, peer := range server.Peers {
+    for _, peer := range server.PeerList() {
         url := peer.URL + "/notify-match"
         go func(url string) {
             resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
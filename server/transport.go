@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/gob"
 	"fmt"
 	"io"
@@ -12,19 +13,34 @@ import (
 	"github.com/hashicorp/raft"
 )
 
+// Cabeçalhos HTTP usados pelo transporte
+const (
+	rpcTypeHeader      = "X-Raft-RPC-Type"
+	snapshotMetaHeader = "X-Raft-Snapshot-Meta" // InstallSnapshotRequest em gob+base64
+)
+
 // HTTPTransport implementa a interface raft.Transport sobre HTTP.
 type HTTPTransport struct {
-	localAddr raft.ServerAddress
-	rpcChan   chan raft.RPC
-	client    *http.Client
+	localAddr      raft.ServerAddress
+	rpcChan        chan raft.RPC
+	client         *http.Client
+	snapshotClient *http.Client // sem timeout curto: snapshots grandes demoram para ser enviados
+	pipelineClient *http.Client // sem timeout: o stream do pipeline fica aberto enquanto o líder replica
 }
 
 // NewHTTPTransport cria um novo transporte.
 func NewHTTPTransport(localAddr raft.ServerAddress) *HTTPTransport {
+	// reaproveita as conexões com os peers em vez de abrir uma nova por RPC
+	httpTransport := &http.Transport{
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	}
 	return &HTTPTransport{
-		localAddr: localAddr,
-		rpcChan:   make(chan raft.RPC),
-		client:    &http.Client{Timeout: 10 * time.Second},
+		localAddr:      localAddr,
+		rpcChan:        make(chan raft.RPC),
+		client:         &http.Client{Timeout: 10 * time.Second, Transport: httpTransport},
+		snapshotClient: &http.Client{Timeout: 10 * time.Minute, Transport: httpTransport},
+		pipelineClient: &http.Client{Transport: httpTransport},
 	}
 }
 
@@ -42,17 +58,39 @@ func (t *HTTPTransport) RequestVote(id raft.ServerID, target raft.ServerAddress,
 	return t.sendRPC(target, "RequestVote", args, resp)
 }
 
-func (t *HTTPTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
-	return nil, raft.ErrPipelineReplicationNotSupported
-}
-
 func (t *HTTPTransport) TimeoutNow(id raft.ServerID, target raft.ServerAddress, args *raft.TimeoutNowRequest, resp *raft.TimeoutNowResponse) error {
 	return t.sendRPC(target, "TimeoutNow", args, resp)
 }
 
 
+// InstallSnapshot envia os metadados do snapshot no cabeçalho e o conteúdo como corpo da requisição
 func (t *HTTPTransport) InstallSnapshot(id raft.ServerID, target raft.ServerAddress, args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse, data io.Reader) error {
-	return fmt.Errorf("InstallSnapshot not implemented")
+	var meta bytes.Buffer
+	if err := gob.NewEncoder(&meta).Encode(args); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("http://%s/raft", target)
+	req, err := http.NewRequest("POST", url, io.LimitReader(data, args.Size))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = args.Size
+	req.Header.Set(rpcTypeHeader, "InstallSnapshot")
+	req.Header.Set(snapshotMetaHeader, base64.StdEncoding.EncodeToString(meta.Bytes()))
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	httpResp, err := t.snapshotClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("snapshot to %s failed with status: %d", target, httpResp.StatusCode)
+	}
+
+	return gob.NewDecoder(httpResp.Body).Decode(resp)
 }
 
 func (t *HTTPTransport) EncodePeer(id raft.ServerID, addr raft.ServerAddress) []byte {
@@ -84,7 +122,7 @@ func (t *HTTPTransport) sendRPC(target raft.ServerAddress, rpcType string, args
 	if err != nil {
 		return err
 	}
-	req.Header.Set("X-Raft-RPC-Type", rpcType)
+	req.Header.Set(rpcTypeHeader, rpcType)
 
 	httpResp, err := t.client.Do(req)
 	if err != nil {
@@ -99,12 +137,15 @@ func (t *HTTPTransport) sendRPC(target raft.ServerAddress, rpcType string, args
 	if err := gob.NewDecoder(httpResp.Body).Decode(resp); err != nil {
 		return err
 	}
+	// lê o resto do corpo para a conexão voltar ao pool
+	io.Copy(io.Discard, httpResp.Body)
 	return nil
 }
 
 func (t *HTTPTransport) HandleRaftRequest(w http.ResponseWriter, r *http.Request) {
 	var req interface{}
-	rpcType := r.Header.Get("X-Raft-RPC-Type")
+	var body io.Reader
+	rpcType := r.Header.Get(rpcTypeHeader)
 
 	switch rpcType {
 	case "AppendEntries":
@@ -113,20 +154,36 @@ func (t *HTTPTransport) HandleRaftRequest(w http.ResponseWriter, r *http.Request
 		req = &raft.RequestVoteRequest{}
 	case "TimeoutNow":
 		req = &raft.TimeoutNowRequest{}
+	case "AppendEntriesPipeline":
+		t.handlePipeline(w, r)
+		return
+	case "InstallSnapshot":
+		args, err := decodeSnapshotMeta(r.Header.Get(snapshotMetaHeader))
+		if err != nil {
+			log.Printf("ERROR: invalid snapshot metadata: %v", err)
+			http.Error(w, "invalid snapshot metadata", http.StatusBadRequest)
+			return
+		}
+		req = args
+		// o raft lê o snapshot direto do corpo da requisição
+		body = io.LimitReader(r.Body, args.Size)
 	default:
 		log.Printf("ERROR: invalid rpc type: %s", rpcType)
 		http.Error(w, "invalid rpc type", http.StatusBadRequest)
 		return
 	}
 
-	if err := gob.NewDecoder(r.Body).Decode(req); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if body == nil {
+		if err := gob.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	respChan := make(chan raft.RPCResponse, 1)
 	rpc := raft.RPC{
 		Command:  req,
+		Reader:   body,
 		RespChan: respChan,
 	}
 	t.rpcChan <- rpc
@@ -141,4 +198,17 @@ func (t *HTTPTransport) HandleRaftRequest(w http.ResponseWriter, r *http.Request
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-}
\ No newline at end of file
+}
+
+// decodifica os metadados do InstallSnapshot enviados no cabeçalho
+func decodeSnapshotMeta(header string) (*raft.InstallSnapshotRequest, error) {
+	raw, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, err
+	}
+	args := &raft.InstallSnapshotRequest{}
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// sobe um transporte atrás de um servidor HTTP de teste e retorna o endereço Raft dele
+func newTestTransportServer(t testing.TB) (*HTTPTransport, raft.ServerAddress) {
+	return newLatencyTransportServer(t, 0)
+}
+
+// como newTestTransportServer, mas as respostas do servidor chegam com atraso,
+// simulando a latência de rede entre máquinas diferentes
+func newLatencyTransportServer(t testing.TB, delay time.Duration) (*HTTPTransport, raft.ServerAddress) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(nil)
+	if delay > 0 {
+		srv.Listener = &latencyListener{Listener: srv.Listener, delay: delay}
+	}
+	addr := raft.ServerAddress(srv.Listener.Addr().String())
+	transport := NewHTTPTransport(addr)
+	srv.Config.Handler = http.HandlerFunc(transport.HandleRaftRequest)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return transport, addr
+}
+
+type latencyListener struct {
+	net.Listener
+	delay time.Duration
+}
+
+func (l *latencyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	lc := &latencyConn{Conn: conn, delay: l.delay, writes: make(chan delayedWrite, 1024)}
+	go lc.deliver()
+	return lc, nil
+}
+
+type delayedWrite struct {
+	data []byte
+	at   time.Time
+}
+
+// latencyConn atrasa cada escrita sem bloquear quem escreve, mantendo a ordem
+type latencyConn struct {
+	net.Conn
+	delay  time.Duration
+	writes chan delayedWrite
+	once   sync.Once
+}
+
+func (c *latencyConn) Write(b []byte) (int, error) {
+	c.writes <- delayedWrite{data: append([]byte(nil), b...), at: time.Now().Add(c.delay)}
+	return len(b), nil
+}
+
+func (c *latencyConn) deliver() {
+	for w := range c.writes {
+		time.Sleep(time.Until(w.at))
+		if _, err := c.Conn.Write(w.data); err != nil {
+			c.Conn.Close()
+		}
+	}
+	c.Conn.Close()
+}
+
+func (c *latencyConn) Close() error {
+	c.once.Do(func() { close(c.writes) })
+	return nil
+}
+
+func TestHTTPTransport_InstallSnapshot(t *testing.T) {
+	follower, followerAddr := newTestTransportServer(t)
+	leader := NewHTTPTransport("leader:0")
+
+	snapshot := bytes.Repeat([]byte("estado-da-fsm;"), 100000)
+	received := make(chan []byte, 1)
+
+	go func() {
+		rpc := <-follower.Consumer()
+		args, ok := rpc.Command.(*raft.InstallSnapshotRequest)
+		if !ok {
+			rpc.Respond(nil, io.ErrUnexpectedEOF)
+			return
+		}
+		data, err := io.ReadAll(rpc.Reader)
+		if err != nil {
+			rpc.Respond(nil, err)
+			return
+		}
+		received <- data
+		rpc.Respond(&raft.InstallSnapshotResponse{Term: args.Term, Success: true}, nil)
+	}()
+
+	args := &raft.InstallSnapshotRequest{
+		Term:         3,
+		Leader:       []byte("leader:0"),
+		LastLogIndex: 42,
+		LastLogTerm:  3,
+		Size:         int64(len(snapshot)),
+	}
+	var resp raft.InstallSnapshotResponse
+	if err := leader.InstallSnapshot("2", followerAddr, args, &resp, bytes.NewReader(snapshot)); err != nil {
+		t.Fatalf("InstallSnapshot falhou: %v", err)
+	}
+
+	if !resp.Success || resp.Term != 3 {
+		t.Errorf("resposta inesperada: %+v", resp)
+	}
+	if got := <-received; !bytes.Equal(got, snapshot) {
+		t.Errorf("snapshot recebido difere do enviado (%d bytes, esperado %d)", len(got), len(snapshot))
+	}
+}
+
+func TestHTTPTransport_InstallSnapshotFollowerError(t *testing.T) {
+	follower, followerAddr := newTestTransportServer(t)
+	leader := NewHTTPTransport("leader:0")
+
+	go func() {
+		rpc := <-follower.Consumer()
+		io.Copy(io.Discard, rpc.Reader)
+		rpc.Respond(nil, io.ErrUnexpectedEOF)
+	}()
+
+	args := &raft.InstallSnapshotRequest{Term: 1, Size: 4}
+	var resp raft.InstallSnapshotResponse
+	err := leader.InstallSnapshot("2", followerAddr, args, &resp, strings.NewReader("data"))
+	if err == nil {
+		t.Fatal("esperava erro quando o seguidor falha ao instalar o snapshot")
+	}
+}
+
+// responde todo AppendEntries com sucesso, como um seguidor em dia com o log
+func serveAppendEntries(transport *HTTPTransport, done <-chan struct{}) {
+	for {
+		select {
+		case rpc := <-transport.Consumer():
+			args := rpc.Command.(*raft.AppendEntriesRequest)
+			rpc.Respond(&raft.AppendEntriesResponse{Term: args.Term, LastLog: args.PrevLogEntry + uint64(len(args.Entries)), Success: true}, nil)
+		case <-done:
+			return
+		}
+	}
+}
+
+func TestHTTPTransport_AppendEntriesPipeline(t *testing.T) {
+	follower, followerAddr := newTestTransportServer(t)
+	done := make(chan struct{})
+	defer close(done)
+	go serveAppendEntries(follower, done)
+
+	leader := NewHTTPTransport("leader:0")
+	pipeline, err := leader.AppendEntriesPipeline("2", followerAddr)
+	if err != nil {
+		t.Fatalf("erro ao abrir pipeline: %v", err)
+	}
+	defer pipeline.Close()
+
+	const total = 50
+	for i := 0; i < total; i++ {
+		args := &raft.AppendEntriesRequest{Term: 1, PrevLogEntry: uint64(i), Entries: []*raft.Log{{Index: uint64(i + 1), Data: []byte("cmd")}}}
+		if _, err := pipeline.AppendEntries(args, &raft.AppendEntriesResponse{}); err != nil {
+			t.Fatalf("erro ao enviar pedido %d: %v", i, err)
+		}
+	}
+
+	// as respostas chegam na mesma ordem dos pedidos
+	for i := 0; i < total; i++ {
+		select {
+		case future := <-pipeline.Consumer():
+			if err := future.Error(); err != nil {
+				t.Fatalf("pedido %d falhou: %v", i, err)
+			}
+			if got := future.Response().LastLog; got != uint64(i+1) {
+				t.Fatalf("resposta fora de ordem: esperado LastLog %d, obteve %d", i+1, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout esperando resposta %d", i)
+		}
+	}
+}
+
+func TestHTTPTransport_PipelineClose(t *testing.T) {
+	follower, followerAddr := newTestTransportServer(t)
+	done := make(chan struct{})
+	defer close(done)
+	go serveAppendEntries(follower, done)
+
+	leader := NewHTTPTransport("leader:0")
+	pipeline, err := leader.AppendEntriesPipeline("2", followerAddr)
+	if err != nil {
+		t.Fatalf("erro ao abrir pipeline: %v", err)
+	}
+	if err := pipeline.Close(); err != nil {
+		t.Fatalf("erro ao fechar pipeline: %v", err)
+	}
+	if _, err := pipeline.AppendEntries(&raft.AppendEntriesRequest{Term: 1}, &raft.AppendEntriesResponse{}); err == nil {
+		t.Fatal("esperava erro ao usar pipeline fechado")
+	}
+}
+
+// transporte como era antes do pipeline: um POST por AppendEntries
+type sequentialTransport struct {
+	*HTTPTransport
+}
+
+func (t sequentialTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+	return nil, raft.ErrPipelineReplicationNotSupported
+}
+
+// FSM mínima: o benchmark mede só a replicação
+type countingFSM struct{ applied uint64 }
+
+func (f *countingFSM) Apply(*raft.Log) interface{}       { f.applied++; return nil }
+func (f *countingFSM) Snapshot() (raft.FSMSnapshot, error) { return nil, io.ErrUnexpectedEOF }
+func (f *countingFSM) Restore(io.ReadCloser) error         { return nil }
+
+// sobe um cluster Raft de 3 nós sobre o HTTPTransport e retorna o líder
+func newBenchmarkCluster(b *testing.B, pipelined bool, latency time.Duration) *raft.Raft {
+	b.Helper()
+	const nodes = 3
+
+	transports := make([]raft.Transport, nodes)
+	var configuration raft.Configuration
+	for i := 0; i < nodes; i++ {
+		transport, addr := newLatencyTransportServer(b, latency)
+		transports[i] = transport
+		if !pipelined {
+			transports[i] = sequentialTransport{transport}
+		}
+		configuration.Servers = append(configuration.Servers, raft.Server{
+			ID:      raft.ServerID(fmt.Sprintf("%d", i+1)),
+			Address: addr,
+		})
+	}
+
+	var rafts []*raft.Raft
+	for i := 0; i < nodes; i++ {
+		config := raft.DefaultConfig()
+		config.LocalID = configuration.Servers[i].ID
+		config.HeartbeatTimeout = 100 * time.Millisecond
+		config.ElectionTimeout = 100 * time.Millisecond
+		config.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.CommitTimeout = 5 * time.Millisecond
+		config.LogOutput = io.Discard
+
+		store := raft.NewInmemStore()
+		r, err := raft.NewRaft(config, &countingFSM{}, store, store, raft.NewInmemSnapshotStore(), transports[i])
+		if err != nil {
+			b.Fatalf("erro ao criar nó %d: %v", i+1, err)
+		}
+		rafts = append(rafts, r)
+	}
+	b.Cleanup(func() {
+		for _, r := range rafts {
+			r.Shutdown().Error()
+		}
+	})
+
+	if err := rafts[0].BootstrapCluster(configuration).Error(); err != nil {
+		b.Fatalf("erro no bootstrap: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, r := range rafts {
+			if r.State() == raft.Leader {
+				return r
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	b.Fatal("nenhum líder eleito")
+	return nil
+}
+
+// Compara a latência de commit com e sem pipeline, com 2ms de latência simulada
+// entre os nós. Vários comandos ficam em voo ao mesmo tempo, como no
+// TestIntegration_StressOpenPack.
+//
+//	go test ./server/ -run '^$' -bench RaftCommit -short
+func BenchmarkRaftCommit(b *testing.B) {
+	for _, mode := range []struct {
+		name      string
+		pipelined bool
+	}{
+		{"sequencial", false},
+		{"pipeline", true},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			leader := newBenchmarkCluster(b, mode.pipelined, 2*time.Millisecond)
+			b.ResetTimer()
+
+			var latency time.Duration
+			type timedFuture struct {
+				future raft.ApplyFuture
+				start  time.Time
+			}
+			futures := make(chan timedFuture, 64)
+			go func() {
+				for i := 0; i < b.N; i++ {
+					futures <- timedFuture{leader.Apply([]byte("ABRIR_PACOTE"), 5*time.Second), time.Now()}
+				}
+				close(futures)
+			}()
+			for f := range futures {
+				if err := f.future.Error(); err != nil {
+					b.Fatalf("erro ao aplicar comando: %v", err)
+				}
+				latency += time.Since(f.start)
+			}
+			b.ReportMetric(float64(latency.Microseconds())/float64(b.N), "us/commit")
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// compromisso de uma jogada global: só o hash da carta é enviado ao servidor
+type PlayCommit struct {
+	Commitment string `json:"commitment"`
+}
+
+// revelação da jogada, enviada depois que os dois jogadores se comprometeram
+type PlayReveal struct {
+	CardID string `json:"cardID"`
+	Nonce  string `json:"nonce"`
+}
+
+// hash que liga o jogador à carta sem revelá-la. O nonce aleatório impede
+// que o adversário descubra a carta testando os IDs do deck
+func CommitCard(cardID, nonce string) string {
+	sum := sha256.Sum256([]byte(cardID + ":" + nonce))
+	return hex.EncodeToString(sum[:])
+}
@@ -24,6 +24,17 @@ type User struct {
 	Deck     []Card `json:"deck"`
 	Status   string `json:"status"`
 	ServerID int    `json:"server_id"`
+	Coins    int    `json:"coins"`
+
+	// só na resposta do LOGIN: token que o cliente envia em todos os pedidos
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+// resposta do RESUME_SESSION: o usuário logado e a partida em andamento, se houver
+type SessionState struct {
+	User   User      `json:"user"`
+	Room   *GameRoom `json:"room,omitempty"`
+	Global bool      `json:"global"`
 }
 
 type Card struct {
@@ -36,6 +47,7 @@ type Request struct {
 	ClientID string          `json:"client_id"`
 	Action   string          `json:"action"`
 	Payload  json.RawMessage `json:"payload"`
+	Token    string          `json:"token,omitempty"` // token de sessão recebido no LOGIN
 }
 
 type Response struct {
@@ -72,6 +84,25 @@ type GameRoom struct {
 	Winner          *User      `json:"winner,omitempty"`
 	ServerID        int        `json:"server_id"`
 	PlayersCards    map[string]Card
+	CreatedAt       time.Time `json:"createdAt"`
+	FinishedAt      time.Time `json:"finishedAt"` // zero enquanto a partida não termina
+
+	// partida em melhor de BestOf rodadas
+	BestOf       int    `json:"bestOf"`
+	Round        int    `json:"round"` // rodadas já terminadas
+	Score1       int    `json:"score1"`
+	Score2       int    `json:"score2"`
+	RoundStarter string `json:"roundStarter"` // quem começa a rodada atual
+	TurnStartedAt time.Time `json:"turnStartedAt"` // início da vez atual, para o tempo limite
+	EndReason    string `json:"endReason,omitempty"` // vazio quando a partida terminou nas rodadas
+
+	// jogador que caiu e o prazo para ele voltar; o tempo da vez fica parado até lá
+	PausedFor   string    `json:"pausedFor,omitempty"`
+	ReconnectBy time.Time `json:"reconnectBy"`
+
+	// salas globais: hash da carta de cada jogador, até os dois revelarem
+	Commitments map[string]string `json:"commitments,omitempty"`
+	LastRound   map[string]Card   `json:"lastRound,omitempty"` // cartas da última rodada, mostradas no resultado
 
 	//para a parte "global"
 	MasterServerID int `json:"master_server_id,omitempty"`
@@ -87,3 +118,188 @@ type CardDrawnData struct {
 type Cards struct {
 	Cards []Card `json:"cards"`
 }
+
+// número de cartas do deck
+const DeckSize = 4
+
+// códigos de erro na validação do deck
+const (
+	DeckWrongSize     = "DECK_WRONG_SIZE"
+	DeckDuplicateCard = "DECK_DUPLICATE_CARD"
+	DeckCardNotOwned  = "DECK_CARD_NOT_OWNED"
+)
+
+// motivos de recusa de uma jogada
+const (
+	PlayNotLoggedIn   = "NOT_LOGGED_IN"
+	PlayRoomNotFound  = "ROOM_NOT_FOUND"
+	PlayNotInRoom     = "NOT_IN_ROOM"
+	PlayMatchFinished = "MATCH_FINISHED"
+	PlayAlreadyPlayed = "ALREADY_PLAYED"
+	PlayNotYourTurn   = "NOT_YOUR_TURN"
+	PlayCardNotInDeck = "CARD_NOT_IN_DECK"
+	PlayFailed        = "PLAY_FAILED" // o servidor não conseguiu registrar a jogada
+	PlayInvalid       = "INVALID_PLAY" // jogada global sem o hash da carta
+	PlayNotCommitted  = "NOT_COMMITTED"
+	PlayBadReveal     = "BAD_REVEAL" // a carta revelada não confere com o hash
+	PlayOpponentPending = "OPPONENT_NOT_COMMITTED" // revelação antes do adversário jogar
+)
+
+// tempo que o jogador tem para jogar (ou revelar a carta) antes de perder a partida
+const TurnTimeout = 30 * time.Second
+
+// motivos para uma partida terminar antes das rodadas acabarem.
+// Também é o Type do aviso enviado aos jogadores antes do MATCH_RESULT
+const (
+	EndTurnTimeout = "TURN_TIMEOUT"
+	EndSurrender   = "SURRENDER" // também é o Type da mensagem de desistência enviada pelo cliente
+	EndDisconnect  = "DISCONNECT" // o jogador caiu e não voltou dentro do prazo
+)
+
+// enviada em GameMessage.Data quando o servidor recusa uma jogada (Type PLAY_REJECTED)
+type PlayRejection struct {
+	Code    string `json:"code"`
+	CardID  string `json:"cardID,omitempty"`
+	Message string `json:"message"`
+}
+
+// códigos de erro no cadastro
+const (
+	AccountInvalidName  = "INVALID_USERNAME"
+	AccountWeakPassword = "WEAK_PASSWORD"
+	AccountNameTaken    = "USERNAME_TAKEN"
+)
+
+// motivo da recusa de um REGISTER, enviado em Response.Data
+type AccountError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// motivo da recusa de um CHANGE_DECK, enviado em Response.Data
+type DeckError struct {
+	Code    string `json:"code"`
+	CardID  string `json:"cardID,omitempty"` // carta que causou o erro, quando houver
+	Message string `json:"message"`
+}
+
+// proposta de troca de cartas entre dois jogadores
+type Trade struct {
+	ID              string    `json:"id"`
+	From            string    `json:"from"` // username de quem propôs
+	To              string    `json:"to"`   // username de quem recebe a proposta
+	OfferedCardID   string    `json:"offered_card_id"`
+	RequestedCardID string    `json:"requested_card_id"`
+	OfferedCard     Card      `json:"offered_card"`
+	RequestedCard   Card      `json:"requested_card"`
+	Status          string    `json:"status"`
+	CreatedAt       time.Time `json:"created_at"`
+	ExpiresAt       time.Time `json:"expires_at"` // depois disso a proposta é descartada sem resposta
+}
+
+const (
+	TradePending  = "PENDING"
+	TradeAccepted = "ACCEPTED"
+	TradeRejected = "REJECTED"
+)
+
+// payload do PROPOSE_TRADE
+type TradeProposal struct {
+	To              string `json:"to"`
+	OfferedCardID   string `json:"offered_card_id"`
+	RequestedCardID string `json:"requested_card_id"`
+}
+
+// payload do ANSWER_TRADE
+type TradeAnswer struct {
+	TradeID string `json:"trade_id"`
+	Accept  bool   `json:"accept"`
+}
+
+type Trades struct {
+	Trades []Trade `json:"trades"`
+}
+
+// carta à venda na casa de leilões
+type Auction struct {
+	ID            string    `json:"id"`
+	Seller        string    `json:"seller"`
+	Card          Card      `json:"card"`
+	ReservePrice  int       `json:"reserve_price"` // lance mínimo
+	HighestBid    int       `json:"highest_bid"`
+	HighestBidder string    `json:"highest_bidder,omitempty"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	EndsAt        time.Time `json:"ends_at"`
+}
+
+const (
+	AuctionOpen   = "OPEN"
+	AuctionSold   = "SOLD"
+	AuctionUnsold = "UNSOLD"
+)
+
+// payload do CREATE_AUCTION
+type CreateAuctionRequest struct {
+	CardID          string `json:"card_id"`
+	ReservePrice    int    `json:"reserve_price"`
+	DurationSeconds int    `json:"duration_seconds"`
+}
+
+// payload do BID
+type BidRequest struct {
+	AuctionID string `json:"auction_id"`
+	Amount    int    `json:"amount"`
+}
+
+// resposta do LIST_AUCTIONS
+type AuctionHouse struct {
+	Auctions []Auction `json:"auctions"`
+	Coins    int       `json:"coins"` // moedas disponíveis do jogador que pediu a lista
+}
+
+// resultado de uma partida registrado no log do Raft
+type MatchRecord struct {
+	MatchID string    `json:"match_id"`
+	Player1 string    `json:"player1"`
+	Player2 string    `json:"player2"`
+	Result  string    `json:"result"` // resultado do ponto de vista do player1: GANHOU, PERDEU ou EMPATE
+	Global  bool      `json:"global"`
+	At      time.Time `json:"at"`
+}
+
+// estatísticas do jogador, calculadas a partir dos resultados registrados
+type PlayerProfile struct {
+	UserName string `json:"username"`
+	Rating   int    `json:"rating"` // Elo
+	Wins     int    `json:"wins"`
+	Losses   int    `json:"losses"`
+	Draws    int    `json:"draws"`
+}
+
+// critérios de ordenação do ranking
+const (
+	LeaderboardByRating = "rating"
+	LeaderboardByWins   = "wins"
+)
+
+// pedido de ranking; valores zerados usam o padrão (nota, página 1, 10 por página)
+type LeaderboardRequest struct {
+	SortBy   string `json:"sortBy,omitempty"`
+	Page     int    `json:"page,omitempty"`
+	PageSize int    `json:"pageSize,omitempty"`
+}
+
+type LeaderboardEntry struct {
+	Rank int `json:"rank"`
+	PlayerProfile
+}
+
+type Leaderboard struct {
+	SortBy   string             `json:"sortBy"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"pageSize"`
+	Total    int                `json:"total"` // jogadores no ranking
+	Entries  []LeaderboardEntry `json:"entries"`
+	MyRank   int                `json:"myRank"` // posição de quem pediu
+}